@@ -1,14 +1,19 @@
-package main
-
-import (
-	"context"
-	"os/signal"
-	"syscall"
-
-	"github.com/neymee/mdexbot/internal/app"
-)
-
-func main() {
-	ctx, _ := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	app.Run(ctx)
-}
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/neymee/mdexbot/internal/app"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "check-config" {
+		os.Exit(app.CheckConfig(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	ctx, _ := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	app.Run(ctx, os.Args[1:])
+}
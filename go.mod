@@ -3,11 +3,13 @@ module github.com/neymee/mdexbot
 go 1.18
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/prometheus/client_golang v1.14.0
 	github.com/rs/zerolog v1.26.1
 	github.com/stretchr/testify v1.8.1
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 	gopkg.in/telebot.v3 v3.0.0
+	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/driver/postgres v1.3.5
 	gorm.io/gorm v1.23.5
 )
@@ -37,5 +39,4 @@ require (
 	golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a // indirect
 	golang.org/x/text v0.3.7 // indirect
 	google.golang.org/protobuf v1.28.1 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
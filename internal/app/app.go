@@ -1,53 +1,85 @@
-package app
-
-import (
-	"context"
-
-	"github.com/neymee/mdexbot/internal/bot"
-	"github.com/neymee/mdexbot/internal/config"
-	"github.com/neymee/mdexbot/internal/database"
-	"github.com/neymee/mdexbot/internal/log"
-	"github.com/neymee/mdexbot/internal/metrics"
-	"github.com/neymee/mdexbot/internal/repo"
-	"github.com/neymee/mdexbot/internal/service"
-)
-
-func Run(ctx context.Context) {
-	const method = "app.Run"
-
-	cfg, err := config.Load()
-	if err != nil {
-		log.Error(ctx, method, err).Send()
-		return
-	}
-
-	log.Configure(cfg)
-
-	log.Log(ctx, method).Info().
-		Interface("config", cfg).
-		Msg("Starting with the following config")
-
-	db, err := database.New(ctx, cfg)
-	if err != nil {
-		log.Error(ctx, method, err).Send()
-		return
-	}
-
-	r := repo.New(db)
-	s := service.New(r.MDex, r.Storage, r.Storage)
-
-	err = bot.Start(ctx, cfg, s)
-	if err != nil {
-		log.Error(ctx, method, err).Send()
-		return
-	}
-
-	go metrics.HandleHTTP(ctx)
-
-	log.Log(ctx, method).Info().Msg("App started")
-
-	<-ctx.Done()
-
-	log.Log(ctx, method).Info().Msg("App is stopping...")
-	bot.Stop()
-}
+package app
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+
+	"github.com/neymee/mdexbot/internal/bot"
+	"github.com/neymee/mdexbot/internal/config"
+	"github.com/neymee/mdexbot/internal/database"
+	"github.com/neymee/mdexbot/internal/health"
+	"github.com/neymee/mdexbot/internal/log"
+	"github.com/neymee/mdexbot/internal/metrics"
+	"github.com/neymee/mdexbot/internal/repo"
+	"github.com/neymee/mdexbot/internal/service"
+	"github.com/neymee/mdexbot/internal/service/subscription"
+)
+
+// Run starts the bot, args are command-line arguments overriding the config
+func Run(ctx context.Context, args []string) {
+	const method = "app.Run"
+
+	cfg, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		log.Error(ctx, method, err).Send()
+		return
+	}
+
+	log.Configure(cfg)
+
+	log.Log(ctx, method).Info().
+		Interface("config", cfg.Redacted()).
+		Msg("Starting with the following config")
+
+	db, err := database.New(ctx, cfg)
+	if err != nil {
+		log.Error(ctx, method, err).Send()
+		return
+	}
+
+	r := repo.New(db)
+	s := service.New(
+		r.MDex,
+		r.Storage,
+		r.Storage,
+		r.Storage,
+		r.Storage,
+		r.Storage,
+		subscription.WithMaxSubscriptions(cfg.Bot.MaxSubscriptions),
+	)
+
+	mux := http.NewServeMux()
+
+	err = bot.Start(ctx, cfg, s, mux)
+	if err != nil {
+		log.Error(ctx, method, err).Send()
+		return
+	}
+
+	health.Handle(
+		mux,
+		[]health.Check{
+			{Name: "poller", Check: bot.CheckPoller},
+		},
+		[]health.Check{
+			{Name: "updates", Check: bot.CheckUpdates},
+			{Name: "database", Check: func(ctx context.Context) error { return database.Ping(ctx, db) }},
+			{Name: "telegram", Check: bot.CheckTelegram},
+		},
+		func() any { return bot.CurrentStatus() },
+	)
+
+	go metrics.HandleHTTP(ctx, cfg, mux)
+	go watchConfig(ctx, args, cfg)
+
+	log.Log(ctx, method).Info().Msg("App started")
+
+	<-ctx.Done()
+
+	log.Log(ctx, method).Info().Msg("App is stopping...")
+	bot.Stop()
+}
@@ -0,0 +1,34 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/neymee/mdexbot/internal/config"
+)
+
+// CheckConfig loads the config the same way Run does without starting the bot. It prints the effective
+// config with secrets redacted to stdout or every problem found to stderr and returns an exit code.
+func CheckConfig(args []string, stdout io.Writer, stderr io.Writer) int {
+	cfg, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	} else if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "    ")
+	err = enc.Encode(cfg.Redacted())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	fmt.Fprintln(stderr, "config is valid")
+	return 0
+}
@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/bot"
+	"github.com/neymee/mdexbot/internal/config"
+	"github.com/neymee/mdexbot/internal/log"
+)
+
+// configPollInterval is how often the config file is checked for changes if CONFIG_WATCH=true
+const configPollInterval = 5 * time.Second
+
+// liveSettings are config fields applied without a restart, a path ending with a dot is a whole section
+var liveSettings = []string{
+	"log.",
+	"bot.check_period_min",
+	"bot.rate_limit.",
+	"bot.command_rate_limit.",
+	"bot.admins",
+}
+
+func isLive(path string) bool {
+	for _, s := range liveSettings {
+		if path == s || (strings.HasSuffix(s, ".") && strings.HasPrefix(path, s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchConfig reloads the config on SIGHUP and, if CONFIG_WATCH=true, when the config file is modified
+func watchConfig(ctx context.Context, args []string, started *config.Config) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var (
+		poll    <-chan time.Time
+		modTime time.Time
+	)
+	if os.Getenv("CONFIG_WATCH") == "true" && started.Path() != "" {
+		t := time.NewTicker(configPollInterval)
+		defer t.Stop()
+		poll = t.C
+		modTime = fileModTime(started.Path())
+	}
+
+	applied := started
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-poll:
+			mt := fileModTime(started.Path())
+			if mt.Equal(modTime) {
+				continue
+			}
+			modTime = mt
+		}
+
+		applied = reloadConfig(ctx, args, started, applied)
+	}
+}
+
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// reloadConfig applies live settings of the reloaded config and returns it. Other changes are compared
+// to the config the app started with and logged until the app is restarted.
+// If the config is invalid, the applied one is kept.
+func reloadConfig(ctx context.Context, args []string, started *config.Config, applied *config.Config) *config.Config {
+	const method = "app.reloadConfig"
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		log.Error(ctx, method, err).Msg("Config reload error, the current config is kept")
+		return applied
+	}
+
+	live, logChanged := []string{}, false
+	for _, path := range config.Changed(applied, cfg) {
+		if isLive(path) {
+			live = append(live, path)
+			logChanged = logChanged || strings.HasPrefix(path, "log.")
+		}
+	}
+
+	restart := []string{}
+	for _, path := range config.Changed(started, cfg) {
+		if !isLive(path) {
+			restart = append(restart, path)
+		}
+	}
+
+	if logChanged {
+		log.Configure(cfg)
+	}
+	bot.Reload(ctx, applied, cfg)
+
+	log.Log(ctx, method).Info().
+		Strs("applied", live).
+		Msg("Config reloaded")
+
+	if len(restart) > 0 {
+		log.Log(ctx, method).Warn().
+			Strs("restart_required", restart).
+			Msg("Some changed settings are applied only after a restart")
+	}
+
+	return cfg
+}
@@ -0,0 +1,214 @@
+package bot
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/config"
+	"github.com/neymee/mdexbot/internal/domain"
+	"github.com/neymee/mdexbot/internal/log"
+	"github.com/neymee/mdexbot/internal/service"
+	"gopkg.in/telebot.v3"
+)
+
+// commandLimiter is a token bucket per chat. A chat gets tokens at the configured rate up to the burst,
+// a command takes a token.
+type commandLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	buckets map[int64]*tokenBucket
+	cleaned time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	// warned is set when the chat is told about the limit, so it's told only once
+	warned bool
+}
+
+func newCommandLimiter(cfg *config.Config) *commandLimiter {
+	l := &commandLimiter{buckets: map[int64]*tokenBucket{}}
+	l.setLimits(cfg.Bot.CommandRateLimit.PerMinute, cfg.Bot.CommandRateLimit.Burst)
+	return l
+}
+
+func (l *commandLimiter) setLimits(perMinute int, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = float64(perMinute) / 60
+	l.burst = float64(burst)
+}
+
+// allow takes a token of the chat. If there is none, warn reports whether the chat should be told about it.
+func (l *commandLimiter) allow(chatID int64, now time.Time) (allowed bool, warn bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cleanup(now)
+
+	b, ok := l.buckets[chatID]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[chatID] = b
+	}
+
+	b.tokens += now.Sub(b.updated).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.warned = false
+		return true, false
+	}
+
+	warn = !b.warned
+	b.warned = true
+	return false, warn
+}
+
+// cleanup forgets chats which buckets are full again, they are the same as new ones
+func (l *commandLimiter) cleanup(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.cleaned) < refill {
+		return
+	}
+
+	for id, b := range l.buckets {
+		if now.Sub(b.updated) >= refill {
+			delete(l.buckets, id)
+		}
+	}
+	l.cleaned = now
+}
+
+var (
+	limiter *commandLimiter
+
+	blockedMu sync.RWMutex
+	// blocked are chats and users the bot ignores, they are loaded on start
+	blocked = map[int64]bool{}
+)
+
+func loadBlocked(ctx context.Context, s *service.Services) error {
+	recipients, err := s.Admin.Blocked(ctx)
+	if err != nil {
+		return err
+	}
+
+	blockedMu.Lock()
+	defer blockedMu.Unlock()
+	blocked = make(map[int64]bool, len(recipients))
+	for _, rec := range recipients {
+		blocked[rec.AsInt64()] = true
+	}
+	return nil
+}
+
+func setBlocked(id int64, isBlocked bool) {
+	blockedMu.Lock()
+	defer blockedMu.Unlock()
+	if isBlocked {
+		blocked[id] = true
+	} else {
+		delete(blocked, id)
+	}
+}
+
+// isBlocked reports whether the chat or the user who sent the update is blocked
+func isBlocked(c telebot.Context) bool {
+	blockedMu.RLock()
+	defer blockedMu.RUnlock()
+	return blocked[c.Chat().ID] || (c.Sender() != nil && blocked[c.Sender().ID])
+}
+
+// abuseMiddleware ignores blocked chats and commands exceeding the rate limit of the chat.
+// Messages in groups not addressed to the bot aren't limited, admins of the bot aren't limited at all.
+func abuseMiddleware(s *service.Services, method Command) telebot.MiddlewareFunc {
+	return func(next telebot.HandlerFunc) telebot.HandlerFunc {
+		return func(c telebot.Context) error {
+			ctx := reqCtx(c)
+
+			if isBlocked(c) {
+				log.Log(ctx, method.String()).Debug().
+					Int64("chat_id", c.Chat().ID).
+					Msg("Update from a blocked chat ignored")
+				return nil
+			} else if isAdmin(c.Sender()) || (method == CmdText && isGroup(c.Chat())) {
+				return next(c)
+			}
+
+			allowed, warn := limiter.allow(c.Chat().ID, time.Now())
+			if allowed {
+				return next(c)
+			}
+
+			log.Log(ctx, method.String()).Debug().
+				Int64("chat_id", c.Chat().ID).
+				Msg("Command rate limit exceeded")
+
+			if !warn {
+				return nil
+			}
+
+			// the locale middleware hasn't run yet, the locale is resolved only for the warning
+			l := chatLocale(c, recipientSettings(ctx, s, chatRecipient(c)))
+			if c.Callback() != nil {
+				return c.Respond(&telebot.CallbackResponse{Text: l.ErrTooManyRequests(), ShowAlert: true})
+			}
+			return send(ctx, chatRecipient(c), l.ErrTooManyRequests())
+		}
+	}
+}
+
+// onBlock makes the bot ignore the chat
+func onBlock(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		id, err := strconv.ParseInt(strings.TrimSpace(c.Message().Payload), 10, 64)
+		if err != nil {
+			return send(ctx, rec, l.AdminBlockUsage(CmdBlock.String()))
+		} else if isAdmin(&telebot.User{ID: id}) {
+			return send(ctx, rec, l.AdminBlockAdmin())
+		}
+
+		err = s.Admin.Block(ctx, domain.RecipientFromInt64(id))
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+		setBlocked(id, true)
+
+		return send(ctx, rec, l.AdminBlocked(id))
+	}
+}
+
+func onUnblock(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		id, err := strconv.ParseInt(strings.TrimSpace(c.Message().Payload), 10, 64)
+		if err != nil {
+			return send(ctx, rec, l.AdminBlockUsage(CmdUnblock.String()))
+		}
+
+		err = s.Admin.Unblock(ctx, domain.RecipientFromInt64(id))
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+		setBlocked(id, false)
+
+		return send(ctx, rec, l.AdminUnblocked(id))
+	}
+}
@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandLimiter(t *testing.T) {
+	type call struct {
+		at      time.Duration
+		allowed bool
+		warn    bool
+	}
+
+	for _, tc := range []struct {
+		name      string
+		perMinute int
+		burst     int
+		calls     []call
+	}{
+		{
+			name:      "burst then warn once",
+			perMinute: 60,
+			burst:     2,
+			calls: []call{
+				{0, true, false},
+				{0, true, false},
+				{0, false, true},
+				{500 * time.Millisecond, false, false},
+			},
+		},
+		{
+			name:      "tokens refill at the rate",
+			perMinute: 60,
+			burst:     2,
+			calls: []call{
+				{0, true, false},
+				{0, true, false},
+				{0, false, true},
+				{time.Second, true, false},
+				{time.Second, false, true},
+			},
+		},
+		{
+			name:      "refill is limited by the burst",
+			perMinute: 60,
+			burst:     2,
+			calls: []call{
+				{0, true, false},
+				{time.Minute, true, false},
+				{time.Minute, true, false},
+				{time.Minute, false, true},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Bot.CommandRateLimit.PerMinute = tc.perMinute
+			cfg.Bot.CommandRateLimit.Burst = tc.burst
+			l := newCommandLimiter(cfg)
+
+			start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			for i, c := range tc.calls {
+				allowed, warn := l.allow(1, start.Add(c.at))
+				assert.Equal(t, c.allowed, allowed, "call %d", i)
+				assert.Equal(t, c.warn, warn, "call %d", i)
+			}
+		})
+	}
+}
+
+func TestCommandLimiter_Cleanup(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Bot.CommandRateLimit.PerMinute = 60
+	cfg.Bot.CommandRateLimit.Burst = 2
+	l := newCommandLimiter(cfg)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.allow(1, start)
+	l.allow(2, start.Add(time.Second))
+	assert.Len(t, l.buckets, 2)
+
+	// the bucket of chat 1 is full again after 2 seconds, chat 2 still has a token to get back
+	l.allow(3, start.Add(2*time.Second))
+	assert.Len(t, l.buckets, 2)
+	assert.NotContains(t, l.buckets, int64(1))
+}
@@ -0,0 +1,335 @@
+package bot
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/neymee/mdexbot/internal/bot/lang"
+	"github.com/neymee/mdexbot/internal/domain"
+	"github.com/neymee/mdexbot/internal/log"
+	"github.com/neymee/mdexbot/internal/service"
+	"gopkg.in/telebot.v3"
+)
+
+const (
+	stateBroadcastText    domain.ConversationState = "broadcast:text"
+	stateBroadcastConfirm domain.ConversationState = "broadcast:confirm"
+
+	broadcastSend   = "send"
+	broadcastCancel = "cancel"
+)
+
+var (
+	adminsMu sync.RWMutex
+	admins   = map[int64]bool{}
+
+	// checkNow makes the updates checker start a cycle at once
+	checkNow = make(chan struct{}, 1)
+)
+
+// setAdmins replaces the users allowed to use the admin console
+func setAdmins(ids []int64) {
+	adminsMu.Lock()
+	defer adminsMu.Unlock()
+
+	admins = make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		admins[id] = true
+	}
+}
+
+func isAdmin(user *telebot.User) bool {
+	adminsMu.RLock()
+	defer adminsMu.RUnlock()
+	return user != nil && admins[user.ID]
+}
+
+// adminIDs returns the users allowed to use the admin console
+func adminIDs() []int64 {
+	adminsMu.RLock()
+	defer adminsMu.RUnlock()
+
+	ids := make([]int64, 0, len(admins))
+	for id := range admins {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// diffAdmins returns admins which are added to the list and removed from it
+func diffAdmins(prev []int64, cur []int64) (added []int64, removed []int64) {
+	was := make(map[int64]bool, len(prev))
+	for _, id := range prev {
+		was[id] = true
+	}
+	is := make(map[int64]bool, len(cur))
+	for _, id := range cur {
+		is[id] = true
+		if !was[id] {
+			added = append(added, id)
+		}
+	}
+	for _, id := range prev {
+		if !is[id] {
+			removed = append(removed, id)
+		}
+	}
+	return added, removed
+}
+
+// consoleMiddleware ignores console commands sent by anyone except the admins in private chats,
+// the console isn't revealed to other users
+func consoleMiddleware(method Command) telebot.MiddlewareFunc {
+	return func(next telebot.HandlerFunc) telebot.HandlerFunc {
+		return func(c telebot.Context) error {
+			if method.ConsoleOnly() && (c.Chat().Type != telebot.ChatPrivate || !isAdmin(c.Sender())) {
+				log.Log(reqCtx(c), method.String()).Warn().
+					Int64("chat_id", c.Chat().ID).
+					Msg("Console command from a non-admin ignored")
+				return nil
+			}
+			return next(c)
+		}
+	}
+}
+
+func onStats(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		stats, err := s.Admin.Stats(ctx)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		start, duration := lastCycle()
+
+		return send(ctx, rec, l.AdminStats(
+			stats.Recipients,
+			stats.Subscriptions,
+			stats.Topics,
+			stats.Sent,
+			stats.Failed,
+			stats.Pending,
+			start,
+			duration,
+		))
+	}
+}
+
+// onUser shows subscriptions and settings of the recipient
+func onUser(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		id, err := strconv.ParseInt(strings.TrimSpace(c.Message().Payload), 10, 64)
+		if err != nil {
+			return send(ctx, rec, l.AdminUserUsage())
+		}
+		user := domain.RecipientFromInt64(id)
+
+		subs, err := s.Subscription.List(ctx, user)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		userSettings, err := s.Settings.Settings(ctx, user)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		lines := make([]string, 0, len(subs))
+		for _, sub := range subs {
+			lines = append(lines, l.AdminUserSubscription(sub.MangaTitle, lang.GetFlagOrLang(sub.Language)))
+		}
+
+		header := l.AdminUser(
+			id,
+			valueOr(userSettings.Language, "-"),
+			userSettings.TimeZone,
+			userSettings.DigestMode,
+			len(subs),
+		)
+		for _, text := range splitMessage(header, lines, "", messageLimit) {
+			err = send(ctx, rec, text)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// valueOr returns the fallback if the value is empty
+func valueOr(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func onCheckNow(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		select {
+		case checkNow <- struct{}{}:
+			return send(ctx, rec, l.AdminCheckStarted())
+		default:
+			return send(ctx, rec, l.AdminCheckQueued())
+		}
+	}
+}
+
+// broadcastPayload is the announcement waiting for the confirmation
+type broadcastPayload struct {
+	Text string `json:"text"`
+}
+
+// onBroadcast starts composing an announcement, the text can be given right after the command
+func onBroadcast(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		if text := strings.TrimSpace(c.Message().Payload); text != "" {
+			return previewBroadcast(s, c, text)
+		}
+
+		err := startFlow(ctx, s, c, stateBroadcastText, nil)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+		return send(ctx, rec, l.AdminBroadcastInit())
+	}
+}
+
+func onBroadcastText(s *service.Services, c telebot.Context, _ domain.Conversation) error {
+	return previewBroadcast(s, c, c.Message().Text)
+}
+
+// previewBroadcast shows the announcement as recipients will see it and asks to confirm sending
+func previewBroadcast(s *service.Services, c telebot.Context, text string) error {
+	ctx := reqCtx(c)
+	rec := chatRecipient(c)
+	l := locale(c)
+
+	recipients, err := s.Admin.Recipients(ctx)
+	if err != nil {
+		return handleInternalError(c, rec, err)
+	}
+
+	err = send(ctx, rec, text)
+	if err != nil {
+		// most likely the markup is invalid, the admin can fix the text
+		return send(ctx, rec, l.AdminBroadcastInvalid(err.Error()))
+	}
+
+	err = startFlow(ctx, s, c, stateBroadcastConfirm, broadcastPayload{Text: text})
+	if err != nil {
+		return handleInternalError(c, rec, err)
+	}
+
+	keyboard := [][]telebot.InlineButton{
+		{
+			{Text: l.BtnBroadcastSend(), Data: broadcastSend, Unique: CmdBroadcastBtn.String()},
+			{Text: l.BtnBroadcastCancel(), Data: broadcastCancel, Unique: CmdBroadcastBtn.String()},
+		},
+	}
+	return send(ctx, rec, l.AdminBroadcastConfirm(len(recipients)), withKeyboard(keyboard))
+}
+
+// onBroadcastConfirmText reminds that the announcement is waiting for the confirmation
+func onBroadcastConfirmText(s *service.Services, c telebot.Context, _ domain.Conversation) error {
+	return send(reqCtx(c), chatRecipient(c), locale(c).AdminBroadcastPending())
+}
+
+// onBroadcastBtn sends the confirmed announcement to every recipient
+func onBroadcastBtn(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		conv, err := s.Conversation.Conversation(ctx, convRecipient(c))
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		} else if conv == nil || conv.State != stateBroadcastConfirm {
+			return send(ctx, rec, l.AdminBroadcastExpired())
+		}
+
+		var payload broadcastPayload
+		err = conv.Decode(&payload)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		err = finishFlow(ctx, s, c)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		// the confirmation can't be pressed twice
+		err = editKeyboard(ctx, c.Callback().Message, [][]telebot.InlineButton{})
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		if c.Callback().Data != broadcastSend {
+			return send(ctx, rec, l.CancelSuccessful(CmdBroadcast.String()))
+		}
+
+		recipients, err := s.Admin.Recipients(ctx)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		go broadcast(ctx, s, rec, l, payload.Text, recipients)
+
+		return send(ctx, rec, l.AdminBroadcastStarted(len(recipients)))
+	}
+}
+
+// broadcast sends the announcement and reports the result to the admin.
+// Messages are queued as notifications, so they are rate limited and don't delay replies to users.
+func broadcast(
+	ctx context.Context,
+	s *service.Services,
+	admin domain.Recipient,
+	l *lang.Locale,
+	text string,
+	recipients []domain.Recipient,
+) {
+	notifications := make([]notification, 0, len(recipients))
+	for _, rec := range recipients {
+		notifications = append(notifications, notification{rec: rec, result: sendBulk(ctx, rec, text)})
+	}
+
+	var failed int
+	for _, n := range notifications {
+		err := waitResult(ctx, n.result).err
+		if err != nil {
+			failed++
+		}
+		handleNotifyError(ctx, s, n.rec, err)
+	}
+
+	log.Log(ctx, "bot.broadcast").Info().
+		Int("recipients", len(recipients)).
+		Int("failed", failed).
+		Msg("Announcement sent")
+
+	err := send(ctx, admin, l.AdminBroadcastDone(len(recipients)-failed, failed))
+	if err != nil {
+		log.Error(ctx, "bot.broadcast", err).Msg("Reporting the announcement result error")
+	}
+}
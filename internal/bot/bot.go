@@ -2,41 +2,110 @@ package bot
 
 import (
 	"context"
+	"net/http"
 	"time"
 
 	"github.com/neymee/mdexbot/internal/config"
+	"github.com/neymee/mdexbot/internal/log"
 	"github.com/neymee/mdexbot/internal/service"
 	"gopkg.in/telebot.v3"
 )
 
 var (
-	bot *telebot.Bot
+	bot   *telebot.Bot
+	queue *sendQueue
+
+	// checkPeriodChanged passes a new period of update checks to the checker
+	checkPeriodChanged = make(chan time.Duration, 1)
 )
 
+// Start runs the bot. In webhook mode the handler receiving updates is registered on the mux.
 func Start(
 	ctx context.Context,
 	cfg *config.Config,
 	services *service.Services,
+	mux *http.ServeMux,
 ) error {
+	var poller telebot.Poller = &telebot.LongPoller{Timeout: 30 * time.Second}
+	if cfg.Bot.Webhook.Enabled() {
+		webhook := newWebhookPoller(cfg)
+		mux.Handle(webhook.Path(), webhook)
+		poller = webhook
+	}
+
+	statusMu.Lock()
+	startedAt, webhookMode = time.Now(), cfg.Bot.Webhook.Enabled()
+	statusMu.Unlock()
+
 	var err error
 	bot, err = telebot.NewBot(
 		telebot.Settings{
 			Token:  cfg.Bot.Token,
-			Poller: &telebot.LongPoller{Timeout: 30 * time.Second},
+			Poller: statusPoller{poller},
 		},
 	)
 	if err != nil {
 		return err
 	}
 
+	if !cfg.Bot.Webhook.Enabled() {
+		// updates can't be polled while a webhook is set
+		err = bot.RemoveWebhook()
+		if err != nil {
+			return err
+		}
+	}
+
+	queue = newSendQueue(cfg, deliver)
+	go queue.run(ctx)
+
+	setAdmins(cfg.Bot.Admins)
+	limiter = newCommandLimiter(cfg)
+	err = loadBlocked(ctx, services)
+	if err != nil {
+		return err
+	}
+
 	initHandlers(bot, services)
 
+	err = registerCommands(ctx)
+	if err != nil {
+		// the commands still work, they just aren't suggested
+		log.Error(ctx, "bot.Start", err).Msg("Registering commands error")
+	}
+
 	go bot.Start()
 	go runUpdatesChecker(ctx, cfg, services)
 
 	return nil
 }
 
+// Reload applies settings of a reloaded config which can be changed without a restart:
+// the check period, rate limits and admins. The checker and the console commands are updated only on changes.
+func Reload(ctx context.Context, applied *config.Config, cfg *config.Config) {
+	limiter.setLimits(cfg.Bot.CommandRateLimit.PerMinute, cfg.Bot.CommandRateLimit.Burst)
+	queue.setLimits(cfg)
+
+	added, removed := diffAdmins(applied.Bot.Admins, cfg.Bot.Admins)
+	if len(added) > 0 || len(removed) > 0 {
+		setAdmins(cfg.Bot.Admins)
+		err := updateConsoleCommands(ctx, added, removed)
+		if err != nil {
+			// the console still works, it just isn't suggested
+			log.Error(ctx, "bot.Reload", err).Msg("Updating console commands error")
+		}
+	}
+
+	if cfg.Bot.CheckPeriodMin != applied.Bot.CheckPeriodMin {
+		// only the latest period matters
+		select {
+		case <-checkPeriodChanged:
+		default:
+		}
+		checkPeriodChanged <- time.Duration(cfg.Bot.CheckPeriodMin) * time.Minute
+	}
+}
+
 func Stop() {
 	if bot != nil {
 		bot.Stop()
@@ -0,0 +1,293 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/domain"
+	"github.com/neymee/mdexbot/internal/errors"
+	"github.com/neymee/mdexbot/internal/log"
+	"github.com/neymee/mdexbot/internal/metrics"
+	"github.com/neymee/mdexbot/internal/service"
+	"gopkg.in/telebot.v3"
+)
+
+// adminCacheTTL is how long the result of chat administrator check is reused
+const adminCacheTTL = 5 * time.Minute
+
+// keyTarget is the key of the recipient which subscriptions the request manages
+const keyTarget = "target"
+
+type adminCacheEntry struct {
+	admin   bool
+	expires time.Time
+}
+
+var adminCache = struct {
+	sync.Mutex
+	entries map[string]adminCacheEntry
+}{entries: map[string]adminCacheEntry{}}
+
+// chatRecipient is the chat the request came from, replies are sent there
+func chatRecipient(c telebot.Context) domain.Recipient {
+	return domain.RecipientFromInt64(c.Chat().ID)
+}
+
+// targetRecipient is the chat which subscriptions the request manages.
+// It's the channel managed by the user or the chat the request came from.
+func targetRecipient(c telebot.Context) domain.Recipient {
+	if target, ok := c.Get(keyTarget).(domain.Recipient); ok {
+		return target
+	}
+	return chatRecipient(c)
+}
+
+// convRecipient keeps conversation context. Every member of a group has their own context.
+func convRecipient(c telebot.Context) domain.Recipient {
+	if c.Chat().Type == telebot.ChatPrivate || c.Sender() == nil {
+		return chatRecipient(c)
+	}
+	return domain.MemberRecipient(c.Chat().ID, c.Sender().ID)
+}
+
+func isGroup(chat *telebot.Chat) bool {
+	return chat.Type == telebot.ChatGroup || chat.Type == telebot.ChatSuperGroup
+}
+
+// isChatAdmin checks if the user is the creator or an administrator of the chat
+func isChatAdmin(ctx context.Context, chat *telebot.Chat, user *telebot.User) (bool, error) {
+	if user == nil {
+		// e.g. a channel post
+		return false, nil
+	}
+
+	defer func(start time.Time) {
+		log.Log(ctx, "bot.isChatAdmin").Trace().
+			Dur("duration", time.Since(start)).
+			Int64("chat_id", chat.ID).
+			Int64("user_id", user.ID).
+			Send()
+	}(time.Now())
+
+	key := fmt.Sprintf("%d:%d", chat.ID, user.ID)
+
+	adminCache.Lock()
+	entry, ok := adminCache.entries[key]
+	adminCache.Unlock()
+	if ok && entry.expires.After(time.Now()) {
+		return entry.admin, nil
+	}
+
+	member, err := bot.ChatMemberOf(chat, user)
+	if err != nil {
+		if failure, _ := classifySendError(err); failure == failureTransient {
+			metrics.ErrorsCounter(fmt.Errorf("%w: %w", errors.TelegramError, err)).Inc()
+			return false, err
+		}
+		// the chat is not available to the bot or the user is not a member
+		member = &telebot.ChatMember{Role: telebot.Left}
+	}
+
+	admin := member.Role == telebot.Creator || member.Role == telebot.Administrator
+
+	adminCache.Lock()
+	adminCache.entries[key] = adminCacheEntry{admin: admin, expires: time.Now().Add(adminCacheTTL)}
+	for k, e := range adminCache.entries {
+		if !e.expires.After(time.Now()) {
+			delete(adminCache.entries, k)
+		}
+	}
+	adminCache.Unlock()
+
+	return admin, nil
+}
+
+// isAnonymousAdmin reports whether the message is sent by an administrator on behalf of the group
+func isAnonymousAdmin(c telebot.Context) bool {
+	msg := c.Message()
+	return c.Callback() == nil && msg != nil && msg.SenderChat != nil && msg.SenderChat.ID == c.Chat().ID
+}
+
+// targetMiddleware resolves the recipient which subscriptions the request manages
+// and rejects changes of group subscriptions by non-administrators
+func targetMiddleware(s *service.Services, method Command) telebot.MiddlewareFunc {
+	return func(next telebot.HandlerFunc) telebot.HandlerFunc {
+		return func(c telebot.Context) error {
+			ctx := reqCtx(c)
+			rec := chatRecipient(c)
+			l := locale(c)
+
+			switch {
+			case isGroup(c.Chat()) && method.AdminOnly() && !isAnonymousAdmin(c):
+				admin, err := isChatAdmin(ctx, c.Chat(), c.Sender())
+				if err != nil {
+					return handleInternalError(c, rec, err)
+				} else if admin {
+					break
+				}
+
+				if c.Callback() != nil {
+					return c.Respond(&telebot.CallbackResponse{Text: l.ErrAdminOnly(), ShowAlert: true})
+				}
+				return send(ctx, rec, l.ErrAdminOnly(), withReplyTo(c.Message()))
+
+			case c.Chat().Type == telebot.ChatPrivate && method.ManagesChannel():
+				ok, err := redirectToChannel(s, c)
+				if err != nil {
+					return handleInternalError(c, rec, err)
+				} else if !ok {
+					return nil
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// redirectToChannel makes the channel linked by the user the target of the request.
+// It returns false if the user has lost the rights on the channel, the user is told so.
+func redirectToChannel(s *service.Services, c telebot.Context) (bool, error) {
+	ctx := reqCtx(c)
+	rec := chatRecipient(c)
+
+	managed, err := s.Conversation.ManagedChat(ctx, rec)
+	if err != nil || managed == nil {
+		return err == nil, err
+	}
+
+	// the user may have lost the rights since the channel was linked
+	admin, err := isChatAdmin(ctx, &telebot.Chat{ID: managed.Chat.AsInt64()}, c.Sender())
+	if err != nil {
+		return false, err
+	} else if !admin {
+		err = s.Conversation.DeleteManagedChat(ctx, rec)
+		if err != nil {
+			return false, err
+		}
+		return false, send(ctx, rec, locale(c).ChannelAdminLost(managed.Title))
+	}
+
+	c.Set(keyTarget, managed.Chat)
+	return true, nil
+}
+
+func onChannel(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		if c.Chat().Type != telebot.ChatPrivate {
+			return send(ctx, rec, l.ChannelPrivateOnly(), withReplyTo(c.Message()))
+		}
+
+		conv, err := s.Conversation.Conversation(ctx, convRecipient(c))
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		} else if conv != nil {
+			return send(ctx, rec, l.ErrWrongContext(conv.State.Command()))
+		}
+
+		managed, err := s.Conversation.ManagedChat(ctx, rec)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		} else if managed != nil {
+			keyboard := [][]telebot.InlineButton{
+				{
+					{
+						Text:   l.BtnChannelStop(),
+						Unique: CmdChannelStopBtn.String(),
+					},
+				},
+			}
+			return send(ctx, rec, l.ChannelCurrent(managed.Title), withKeyboard(keyboard))
+		}
+
+		err = startFlow(ctx, s, c, stateChannel, nil)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		return send(ctx, rec, l.ChannelInit())
+	}
+}
+
+// onChannelText links the channel from a forwarded post or a username to the user
+func onChannelText(s *service.Services, c telebot.Context, _ domain.Conversation) error {
+	ctx := reqCtx(c)
+	rec := chatRecipient(c)
+	l := locale(c)
+
+	channel := c.Message().OriginalChat
+	if channel == nil {
+		username := strings.TrimSpace(c.Text())
+		username = strings.TrimPrefix(username, "https://t.me/")
+		if !strings.HasPrefix(username, "@") {
+			username = "@" + username
+		}
+
+		var err error
+		channel, err = bot.ChatByUsername(username)
+		if err != nil {
+			if failure, _ := classifySendError(err); failure == failureTransient {
+				return handleInternalError(c, rec, err)
+			}
+			return send(ctx, rec, l.ChannelNotFound())
+		}
+	}
+
+	if channel.Type != telebot.ChatChannel {
+		return send(ctx, rec, l.ChannelNotChannel())
+	}
+
+	admin, err := isChatAdmin(ctx, channel, c.Sender())
+	if err != nil {
+		return handleInternalError(c, rec, err)
+	} else if !admin {
+		return send(ctx, rec, l.ChannelUserNotAdmin(channel.Title))
+	}
+
+	member, err := bot.ChatMemberOf(channel, bot.Me)
+	if err != nil {
+		if failure, _ := classifySendError(err); failure == failureTransient {
+			return handleInternalError(c, rec, err)
+		}
+		return send(ctx, rec, l.ChannelNotFound())
+	} else if member.Role != telebot.Administrator || !member.CanPostMessages {
+		return send(ctx, rec, l.ChannelBotNotAdmin(channel.Title))
+	}
+
+	err = s.Conversation.SetManagedChat(ctx, rec, domain.ManagedChat{
+		Chat:  domain.RecipientFromInt64(channel.ID),
+		Title: channel.Title,
+	})
+	if err != nil {
+		return handleInternalError(c, rec, err)
+	}
+
+	err = finishFlow(ctx, s, c)
+	if err != nil {
+		return handleInternalError(c, rec, err)
+	}
+
+	return send(ctx, rec, l.ChannelManaged(channel.Title))
+}
+
+func onChannelStopBtn(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		err := s.Conversation.DeleteManagedChat(ctx, rec)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		return send(ctx, rec, l.ChannelStopped())
+	}
+}
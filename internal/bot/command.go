@@ -1,30 +1,99 @@
-package bot
-
-type Command string
-
-func (c Command) Endpoint() string {
-	switch c {
-	case CmdSubscribeBtn, CmdUnsubscribeBtn:
-		return "\f" + string(c)
-	case CmdText:
-		return "\a" + string(c)
-	default:
-		return "/" + string(c)
-	}
-}
-
-func (c Command) String() string {
-	return string(c)
-}
-
-const (
-	CmdText           Command = "text"
-	CmdStart          Command = "start"
-	CmdCancel         Command = "cancel"
-	CmdList           Command = "list"
-	CmdSubscribe      Command = "subscribe"
-	CmdSubscribeBtn   Command = "subscribeBtn"
-	CmdUnsubscribe    Command = "unsubscribe"
-	CmdUnsubscribeBtn Command = "unsubscribeBtn"
-	CmdTest           Command = "test"
-)
+package bot
+
+type Command string
+
+func (c Command) Endpoint() string {
+	switch c {
+	case CmdSubscribeBtn, CmdChannelSubscribeBtn, CmdUnsubscribeBtn, CmdMarkReadBtn, CmdAlertsBtn,
+		CmdWaitLangListBtn, CmdWaitLangBtn, CmdUnwatchLangBtn, CmdFirstLangBtn, CmdFiltersBtn,
+		CmdChannelStopBtn, CmdSettingsBtn, CmdListPageBtn, CmdUnsubscribePageBtn, CmdAlertsPageBtn,
+		CmdUnreadPageBtn, CmdBroadcastBtn:
+		return "\f" + string(c)
+	case CmdText:
+		return "\a" + string(c)
+	default:
+		return "/" + string(c)
+	}
+}
+
+// AdminOnly reports whether the command changes subscriptions of a chat,
+// such commands are allowed to administrators only in groups
+func (c Command) AdminOnly() bool {
+	switch c {
+	case CmdSubscribe, CmdSubscribeBtn, CmdChannelSubscribeBtn, CmdFirstLangBtn, CmdUnsubscribe,
+		CmdUnsubscribeBtn, CmdUnsubscribePageBtn, CmdMarkReadBtn, CmdAlerts, CmdAlertsBtn, CmdAlertsPageBtn, CmdFilters,
+		CmdFiltersBtn, CmdWaitLangListBtn, CmdWaitLangBtn, CmdUnwatchLangBtn, CmdSettings, CmdSettingsBtn:
+		return true
+	default:
+		return false
+	}
+}
+
+// ManagesChannel reports whether the command manages subscriptions of the channel linked by the user
+// in a private chat. Other commands act on the user, e.g. marking chapters read or deep links.
+func (c Command) ManagesChannel() bool {
+	switch c {
+	case CmdSubscribe, CmdChannelSubscribeBtn, CmdFirstLangBtn, CmdUnsubscribe, CmdUnsubscribeBtn,
+		CmdUnsubscribePageBtn, CmdList, CmdListPageBtn, CmdShare, CmdAlerts, CmdAlertsBtn, CmdAlertsPageBtn,
+		CmdFilters, CmdFiltersBtn, CmdWaitLangListBtn, CmdWaitLangBtn, CmdUnwatchLangBtn:
+		return true
+	default:
+		return false
+	}
+}
+
+// ConsoleOnly reports whether the command belongs to the admin console available to the bot operators only
+func (c Command) ConsoleOnly() bool {
+	switch c {
+	case CmdStats, CmdBroadcast, CmdBroadcastBtn, CmdUser, CmdCheckNow, CmdBlock, CmdUnblock:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c Command) String() string {
+	return string(c)
+}
+
+const (
+	CmdText         Command = "text"
+	CmdStart        Command = "start"
+	CmdCancel       Command = "cancel"
+	CmdHelp         Command = "help"
+	CmdList         Command = "list"
+	CmdListPageBtn  Command = "listPageBtn"
+	CmdShare        Command = "share"
+	CmdSubscribe    Command = "subscribe"
+	CmdSubscribeBtn Command = "subscribeBtn"
+	// CmdChannelSubscribeBtn chooses the language of a subscription of the channel linked by the user
+	CmdChannelSubscribeBtn Command = "channelSubscribeBtn"
+	CmdFirstLangBtn        Command = "firstLangBtn"
+	CmdUnsubscribe         Command = "unsubscribe"
+	CmdUnsubscribeBtn      Command = "unsubscribeBtn"
+	CmdUnsubscribePageBtn  Command = "unsubscribePageBtn"
+	CmdUnread              Command = "unread"
+	CmdUnreadPageBtn       Command = "unreadPageBtn"
+	CmdMarkReadBtn         Command = "markReadBtn"
+	CmdAlerts              Command = "alerts"
+	CmdAlertsBtn           Command = "alertsBtn"
+	CmdAlertsPageBtn       Command = "alertsPageBtn"
+	CmdFilters             Command = "filters"
+	CmdFiltersBtn          Command = "filtersBtn"
+	CmdChannel             Command = "channel"
+	CmdChannelStopBtn      Command = "channelStopBtn"
+	CmdSettings            Command = "settings"
+	CmdSettingsBtn         Command = "settingsBtn"
+
+	CmdStats        Command = "stats"
+	CmdBroadcast    Command = "broadcast"
+	CmdBroadcastBtn Command = "broadcastBtn"
+	CmdUser         Command = "user"
+	CmdCheckNow     Command = "checknow"
+	CmdBlock        Command = "block"
+	CmdUnblock      Command = "unblock"
+
+	CmdWaitLangListBtn Command = "waitLangListBtn"
+	CmdWaitLangBtn     Command = "waitLangBtn"
+	CmdUnwatchLangBtn  Command = "unwatchLangBtn"
+)
@@ -0,0 +1,104 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/domain"
+	"github.com/neymee/mdexbot/internal/log"
+	"github.com/neymee/mdexbot/internal/metrics"
+	"github.com/neymee/mdexbot/internal/service"
+	"gopkg.in/telebot.v3"
+)
+
+const (
+	stateSubscribeLink    domain.ConversationState = "subscribe"
+	stateChannel          domain.ConversationState = "channel"
+	stateSettingsTimeZone domain.ConversationState = "settings:tz"
+)
+
+// flowStep is a state of a multi-step command waiting for a text message
+type flowStep struct {
+	ttl    time.Duration
+	onText func(s *service.Services, c telebot.Context, conv domain.Conversation) error
+}
+
+// flows are steps of multi-step commands by their states
+var flows = map[domain.ConversationState]flowStep{}
+
+// registerFlow declares a step of a multi-step command. Text messages sent in the state are passed to onText,
+// the command is forgotten if the user doesn't answer in ttl.
+func registerFlow(
+	state domain.ConversationState,
+	ttl time.Duration,
+	onText func(s *service.Services, c telebot.Context, conv domain.Conversation) error,
+) {
+	flows[state] = flowStep{ttl: ttl, onText: onText}
+}
+
+func initFlows() {
+	registerFlow(stateSubscribeLink, 10*time.Minute, onSubscribeText)
+	registerFlow(stateChannel, 10*time.Minute, onChannelText)
+	registerFlow(stateSettingsTimeZone, 5*time.Minute, onSettingsText)
+	registerFlow(stateBroadcastText, 30*time.Minute, onBroadcastText)
+	registerFlow(stateBroadcastConfirm, 30*time.Minute, onBroadcastConfirmText)
+}
+
+// startFlow moves the conversation of the chat to the state, the payload is passed to the next step
+func startFlow(
+	ctx context.Context,
+	s *service.Services,
+	c telebot.Context,
+	state domain.ConversationState,
+	payload any,
+) error {
+	step, ok := flows[state]
+	if !ok {
+		return fmt.Errorf("unknown conversation state %q", state)
+	}
+	return s.Conversation.SetConversation(ctx, convRecipient(c), state, payload, step.ttl)
+}
+
+// finishFlow forgets the command in progress
+func finishFlow(ctx context.Context, s *service.Services, c telebot.Context) error {
+	return s.Conversation.DeleteConversation(ctx, convRecipient(c))
+}
+
+// dispatchFlow passes the text message to the step of the command in progress.
+// It isn't handled if there is no command in progress.
+func dispatchFlow(s *service.Services, c telebot.Context) (handled bool, err error) {
+	ctx := reqCtx(c)
+
+	conv, err := s.Conversation.Conversation(ctx, convRecipient(c))
+	if err != nil || conv == nil {
+		return false, err
+	}
+
+	step, ok := flows[conv.State]
+	if !ok {
+		// the state was saved by a previous version of the bot
+		log.Log(ctx, "bot.dispatchFlow").Warn().
+			Str("state", string(conv.State)).
+			Msg("Unknown conversation state")
+		return false, finishFlow(ctx, s, c)
+	}
+
+	return true, step.onText(s, c, *conv)
+}
+
+// purgeConversations deletes expired conversations nobody has written to
+func purgeConversations(ctx context.Context, s *service.Services) {
+	const method = "bot.purgeConversations"
+
+	n, err := s.Conversation.DeleteExpiredConversations(ctx)
+	if err != nil {
+		metrics.ErrorsCounter(err).Inc()
+		log.Error(ctx, method, err).Msg("Deleting expired conversations error")
+		return
+	}
+
+	log.Log(ctx, method).Debug().
+		Int64("deleted", n).
+		Msg("Expired conversations deleted")
+}
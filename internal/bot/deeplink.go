@@ -0,0 +1,104 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/neymee/mdexbot/internal/bot/lang"
+	"github.com/neymee/mdexbot/internal/service"
+	"github.com/neymee/mdexbot/internal/service/subscription"
+	"gopkg.in/telebot.v3"
+)
+
+// startPayloadSeparator separates the manga id and the language in the start payload,
+// Telegram allows only letters, digits, "_" and "-" there
+const startPayloadSeparator = "_"
+
+var languageRegexp = regexp.MustCompile("^([a-z]{2,3}(-[a-z]{2})?|any)$")
+
+// shareLink returns a link starting the bot with a subscription to the manga in the language
+func shareLink(mangaID string, mangaLang string) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s%s%s", bot.Me.Username, mangaID, startPayloadSeparator, mangaLang)
+}
+
+// parseStartPayload parses "<manga id>[_<language>]", the language is empty if it isn't given
+func parseStartPayload(payload string) (mangaID string, mangaLang string, err error) {
+	mangaID, mangaLang, _ = strings.Cut(strings.TrimSpace(payload), startPayloadSeparator)
+	if !mangaIDRegexp.MatchString(mangaID) {
+		return "", "", fmt.Errorf("invalid start payload: \"%s\"", payload)
+	} else if mangaLang != "" && !languageRegexp.MatchString(mangaLang) {
+		return "", "", fmt.Errorf("invalid start payload: \"%s\"", payload)
+	}
+	return mangaID, mangaLang, nil
+}
+
+// onStartPayload subscribes to the manga from the deep link
+// or offers to choose the language if it isn't given or the manga isn't translated to it
+func onStartPayload(s *service.Services, c telebot.Context, mangaID string, mangaLang string) error {
+	ctx := reqCtx(c)
+	rec := chatRecipient(c)
+	l := locale(c)
+
+	if isGroup(c.Chat()) && !isAnonymousAdmin(c) {
+		// /start isn't admin only, but the payload changes subscriptions of the group
+		admin, err := isChatAdmin(ctx, c.Chat(), c.Sender())
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		} else if !admin {
+			return send(ctx, rec, l.ErrAdminOnly(), withReplyTo(c.Message()))
+		}
+	}
+
+	manga, err := s.Subscription.Manga(ctx, mangaID)
+	if errors.Is(err, subscription.ErrMangaNotFound) {
+		return send(ctx, rec, l.SubscribeErrMangaNotFound())
+	} else if err != nil {
+		return handleInternalError(c, rec, err)
+	}
+
+	translated := mangaLang == "any"
+	for _, code := range manga.TranslationLanguages {
+		translated = translated || code == mangaLang
+	}
+	if !translated {
+		return offerLanguages(s, c, manga)
+	}
+
+	return subscribeTo(s, c, mangaID, mangaLang)
+}
+
+// onShare sends links to subscribe to the titles the user follows, "/share text" shares matching titles only
+func onShare(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		query := newPageQuery(c.Message().Payload)
+		query.PageSize = 0
+		page, err := s.Subscription.ListPage(ctx, targetRecipient(c), query)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		} else if page.Total == 0 && query.Filter != "" {
+			return send(ctx, rec, l.ListNoMatches(query.Filter))
+		} else if page.Total == 0 {
+			return send(ctx, rec, l.ListNoSubs())
+		}
+
+		lines := make([]string, 0, len(page.Subscriptions))
+		for _, sub := range page.Subscriptions {
+			link := shareLink(sub.MangaID, sub.Language)
+			lines = append(lines, l.ShareLine(link, sub.MangaTitle, lang.GetFlagOrLang(sub.Language)))
+		}
+
+		for _, text := range splitMessage(l.Share(), lines, "", messageLimit) {
+			err = send(ctx, rec, text)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"context"
+	"errors"
+
+	"github.com/neymee/mdexbot/internal/domain"
+	"github.com/neymee/mdexbot/internal/log"
+	"github.com/neymee/mdexbot/internal/metrics"
+	"github.com/neymee/mdexbot/internal/service"
+	"gopkg.in/telebot.v3"
+)
+
+// sendFailure is a class of errors returned by Telegram on sending a message
+type sendFailure int
+
+const (
+	// failureTransient is a network error, a flood limit or a Telegram server error.
+	// The message may be sent later.
+	failureTransient sendFailure = iota
+	// failureRecipient means the recipient can't receive messages from the bot:
+	// the chat is not found, the user is deactivated or has blocked the bot, the bot is kicked from the group
+	failureRecipient
+	// failureMigrated means the group has been upgraded to a supergroup with a new chat id
+	failureMigrated
+	// failureMessage means the message is rejected, sending it again is pointless
+	failureMessage
+)
+
+func (f sendFailure) String() string {
+	switch f {
+	case failureRecipient:
+		return "recipient"
+	case failureMigrated:
+		return "migrated"
+	case failureMessage:
+		return "message"
+	default:
+		return "transient"
+	}
+}
+
+// classifySendError returns the class of the error and the new chat id for migrated groups
+func classifySendError(err error) (sendFailure, int64) {
+	groupErr := telebot.GroupError{}
+	if errors.As(err, &groupErr) && groupErr.MigratedTo != 0 {
+		return failureMigrated, groupErr.MigratedTo
+	}
+
+	tbErr := new(telebot.Error)
+	if !errors.As(err, &tbErr) {
+		// network errors and errors unknown to telebot
+		return failureTransient, 0
+	}
+
+	switch tbErr {
+	case telebot.ErrChatNotFound,
+		telebot.ErrBlockedByUser,
+		telebot.ErrUserIsDeactivated,
+		telebot.ErrKickedFromGroup,
+		telebot.ErrKickedFromSuperGroup,
+		telebot.ErrNotStartedByUser:
+		return failureRecipient, 0
+	}
+
+	switch {
+	case tbErr.Code == 403:
+		return failureRecipient, 0
+	case tbErr.Code == 400:
+		return failureMessage, 0
+	default:
+		return failureTransient, 0
+	}
+}
+
+// handleNotifyError handles the result of sending a notification.
+// Returns true if the notification should be sent again later.
+func handleNotifyError(ctx context.Context, s *service.Services, rec domain.Recipient, err error) bool {
+	const method = "bot.handleNotifyError"
+
+	if err == nil {
+		if err := s.Subscription.RecipientReachable(ctx, rec); err != nil {
+			metrics.ErrorsCounter(err).Inc()
+			log.Error(ctx, method, err).
+				Int64("recipient", rec.AsInt64()).
+				Msg("RecipientReachable error")
+		}
+		return false
+	}
+
+	failure, migratedTo := classifySendError(err)
+	log.Error(ctx, method, err).
+		Int64("recipient", rec.AsInt64()).
+		Stringer("failure", failure).
+		Msg("Error during sending message")
+
+	switch failure {
+	case failureMigrated:
+		newRec := domain.RecipientFromInt64(migratedTo)
+		if err := s.Subscription.MigrateRecipient(ctx, rec, newRec); err != nil {
+			metrics.ErrorsCounter(err).Inc()
+			log.Error(ctx, method, err).
+				Int64("recipient", rec.AsInt64()).
+				Msg("MigrateRecipient error")
+			return true
+		}
+
+		log.Log(ctx, method).Info().
+			Int64("recipient", rec.AsInt64()).
+			Int64("migrated_to", migratedTo).
+			Msg("The group has been migrated to a supergroup, its subscriptions have been moved")
+		return true
+
+	case failureRecipient:
+		purged, err := s.Subscription.RecipientFailed(ctx, rec, err)
+		if err != nil {
+			metrics.ErrorsCounter(err).Inc()
+			log.Error(ctx, method, err).
+				Int64("recipient", rec.AsInt64()).
+				Msg("RecipientFailed error")
+			return true
+		}
+
+		if !purged {
+			return true
+		}
+
+		err = s.Conversation.DeleteConversation(ctx, rec)
+		if err != nil {
+			metrics.ErrorsCounter(err).Inc()
+			log.Error(ctx, method, err).
+				Int64("recipient", rec.AsInt64()).
+				Msg("DeleteConversation error")
+		}
+
+		log.Log(ctx, method).Warn().
+			Int64("recipient", rec.AsInt64()).
+			Msg("The recipient is unavailable and theirs subscriptions have been removed")
+		return false
+
+	case failureMessage:
+		return false
+
+	default:
+		return true
+	}
+}
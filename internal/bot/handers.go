@@ -3,10 +3,12 @@ package bot
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/neymee/mdexbot/internal/bot/lang"
 	"github.com/neymee/mdexbot/internal/domain"
+	werrors "github.com/neymee/mdexbot/internal/errors"
 	"github.com/neymee/mdexbot/internal/log"
 	"github.com/neymee/mdexbot/internal/metrics"
 	"github.com/neymee/mdexbot/internal/service"
@@ -14,21 +16,73 @@ import (
 	"gopkg.in/telebot.v3"
 )
 
-func initHandlers(bot *telebot.Bot, s *service.Services) {
-	bot.Handle(CmdStart.Endpoint(), onStart(s), middlewares(CmdStart)...)
+// handler binds a command to its handler
+type handler struct {
+	cmd    Command
+	handle func(s *service.Services) telebot.HandlerFunc
+	// menu commands are registered with Telegram and listed in /help
+	menu bool
+	// private commands are offered in private chats only
+	private bool
+}
 
-	bot.Handle(CmdText.Endpoint(), onText(s), middlewares(CmdText)...)
-	bot.Handle(CmdSubscribe.Endpoint(), onSubscribe(s), middlewares(CmdSubscribe)...)
-	bot.Handle(CmdSubscribeBtn.Endpoint(), onSubscribeBtn(s), middlewares(CmdSubscribeBtn)...)
+// commandHandlers returns every handler of the bot, menu commands are listed in this order
+func commandHandlers() []handler {
+	return []handler{
+		{cmd: CmdStart, handle: onStart},
+		{cmd: CmdHelp, handle: onHelp, menu: true},
+
+		{cmd: CmdText, handle: onText},
+		{cmd: CmdSubscribe, handle: onSubscribe, menu: true},
+		{cmd: CmdSubscribeBtn, handle: onSubscribeBtn},
+		{cmd: CmdChannelSubscribeBtn, handle: onSubscribeBtn},
+
+		{cmd: CmdFirstLangBtn, handle: onFirstLangBtn},
+		{cmd: CmdWaitLangListBtn, handle: onWaitLangListBtn},
+		{cmd: CmdWaitLangBtn, handle: onWaitLangBtn},
+		{cmd: CmdUnwatchLangBtn, handle: onUnwatchLangBtn},
+
+		{cmd: CmdUnsubscribe, handle: onUnsubscribe, menu: true},
+		{cmd: CmdUnsubscribeBtn, handle: onUnsubscribeBtn},
+		{cmd: CmdUnsubscribePageBtn, handle: onUnsubscribePageBtn},
+
+		{cmd: CmdList, handle: onList, menu: true},
+		{cmd: CmdShare, handle: onShare, menu: true},
+		{cmd: CmdListPageBtn, handle: onListPageBtn},
+		{cmd: CmdUnread, handle: onUnread, menu: true},
+		{cmd: CmdUnreadPageBtn, handle: onUnreadPageBtn},
+		{cmd: CmdMarkReadBtn, handle: onMarkReadBtn},
+
+		{cmd: CmdAlerts, handle: onAlerts, menu: true},
+		{cmd: CmdAlertsBtn, handle: onAlertsBtn},
+		{cmd: CmdAlertsPageBtn, handle: onAlertsPageBtn},
+		{cmd: CmdFilters, handle: onFilters, menu: true},
+		{cmd: CmdFiltersBtn, handle: onFiltersBtn},
+		{cmd: CmdChannel, handle: onChannel, menu: true, private: true},
+		{cmd: CmdChannelStopBtn, handle: onChannelStopBtn},
+		{cmd: CmdSettings, handle: onSettings, menu: true},
+		{cmd: CmdSettingsBtn, handle: onSettingsBtn},
+		{cmd: CmdCancel, handle: onCancel, menu: true},
+
+		{cmd: CmdStats, handle: onStats, menu: true},
+		{cmd: CmdBroadcast, handle: onBroadcast, menu: true},
+		{cmd: CmdBroadcastBtn, handle: onBroadcastBtn},
+		{cmd: CmdUser, handle: onUser, menu: true},
+		{cmd: CmdCheckNow, handle: onCheckNow, menu: true},
+		{cmd: CmdBlock, handle: onBlock, menu: true},
+		{cmd: CmdUnblock, handle: onUnblock, menu: true},
+	}
+}
 
-	bot.Handle(CmdUnsubscribe.Endpoint(), onUnsubscribe(s), middlewares(CmdUnsubscribe)...)
-	bot.Handle(CmdUnsubscribeBtn.Endpoint(), onUnsubscribeBtn(s), middlewares(CmdUnsubscribeBtn)...)
+func initHandlers(bot *telebot.Bot, s *service.Services) {
+	initFlows()
 
-	bot.Handle(CmdList.Endpoint(), onList(s), middlewares(CmdList)...)
-	bot.Handle(CmdCancel.Endpoint(), onCancel(s), middlewares(CmdCancel)...)
+	for _, h := range commandHandlers() {
+		bot.Handle(h.cmd.Endpoint(), h.handle(s), middlewares(s, h.cmd)...)
+	}
 }
 
-func middlewares(method Command) []telebot.MiddlewareFunc {
+func middlewares(s *service.Services, method Command) []telebot.MiddlewareFunc {
 	return []telebot.MiddlewareFunc{
 		func(next telebot.HandlerFunc) telebot.HandlerFunc {
 			// setup context
@@ -42,6 +96,7 @@ func middlewares(method Command) []telebot.MiddlewareFunc {
 			return func(c telebot.Context) error {
 				defer func() {
 					if err := recover(); err != nil {
+						metrics.ErrorsCounter(fmt.Errorf("%w: %+v", werrors.PanicError, err)).Inc()
 						log.Log(reqCtx(c), method.String()).Error().
 							Interface("panic", err).
 							Msg("Panic recovered")
@@ -88,88 +143,369 @@ func middlewares(method Command) []telebot.MiddlewareFunc {
 				return next(c)
 			}
 		},
+		abuseMiddleware(s, method),
+		consoleMiddleware(method),
+		localeMiddleware(s),
+		targetMiddleware(s, method),
 	}
 }
 
 func onStart(s *service.Services) telebot.HandlerFunc {
 	return func(c telebot.Context) error {
+		if payload := c.Message().Payload; payload != "" {
+			mangaID, mangaLang, err := parseStartPayload(payload)
+			if err == nil {
+				return onStartPayload(s, c, mangaID, mangaLang)
+			}
+		}
+
 		return send(
 			reqCtx(c),
-			domain.RecipientFromInt64(c.Chat().ID),
-			lang.Start(),
+			chatRecipient(c),
+			locale(c).Start(),
 		)
 	}
 }
 
+// onHelp lists commands available to the user in the chat
+func onHelp(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		scope := scopePrivate
+		if isAdmin(c.Sender()) && c.Chat().Type == telebot.ChatPrivate {
+			scope = scopeConsole
+		} else if isGroup(c.Chat()) {
+			admin, err := isChatAdmin(ctx, c.Chat(), c.Sender())
+			if err != nil {
+				return handleInternalError(c, rec, err)
+			}
+
+			scope = scopeGroup
+			if admin {
+				scope = scopeAdmins
+			}
+		}
+
+		return send(ctx, rec, buildHelpMessage(l, menuCommands(scope)))
+	}
+}
+
 func onText(s *service.Services) telebot.HandlerFunc {
 	return func(c telebot.Context) error {
 		ctx := reqCtx(c)
-		rec := domain.RecipientFromInt64(c.Chat().ID)
+		rec := chatRecipient(c)
+		l := locale(c)
 
-		cmd, err := s.Conversation.ConversationContext(ctx, rec)
+		handled, err := dispatchFlow(s, c)
 		if err != nil {
 			return handleInternalError(c, rec, err)
+		} else if handled {
+			return nil
 		}
 
-		if cmd != CmdSubscribe.String() {
-			return send(ctx, rec, lang.Start())
+		if isGroup(c.Chat()) {
+			// not every message in a group is addressed to the bot
+			return nil
 		}
+		return send(ctx, rec, l.Start())
+	}
+}
 
-		mangaID, err := mangaIDFromURL(c.Text())
+// onSubscribeText offers languages of the manga from the link
+func onSubscribeText(s *service.Services, c telebot.Context, _ domain.Conversation) error {
+	ctx := reqCtx(c)
+	rec := chatRecipient(c)
+	l := locale(c)
+
+	// the flow is started by /subscribe which manages the channel of the user
+	if c.Chat().Type == telebot.ChatPrivate {
+		ok, err := redirectToChannel(s, c)
 		if err != nil {
-			return send(ctx, rec, lang.SubscribeErrInvalidLink(c.Text()))
+			return handleInternalError(c, rec, err)
+		} else if !ok {
+			return nil
 		}
+	}
+
+	mangaID, err := mangaIDFromURL(c.Text())
+	if err != nil {
+		return send(ctx, rec, l.SubscribeErrInvalidLink(c.Text()), withReplyTo(c.Message()))
+	}
+
+	manga, err := s.Subscription.Manga(ctx, mangaID)
+	if errors.Is(err, subscription.ErrMangaNotFound) {
+		return send(ctx, rec, l.SubscribeErrMangaNotFound())
+	} else if err != nil {
+		return handleInternalError(c, rec, err)
+	}
+
+	err = finishFlow(ctx, s, c)
+	if err != nil {
+		return handleInternalError(c, rec, err)
+	}
+
+	return offerLanguages(s, c, manga)
+}
+
+// offerLanguages lets the user choose the language of the subscription to the manga
+func offerLanguages(s *service.Services, c telebot.Context, manga domain.Manga) error {
+	ctx := reqCtx(c)
+	l := locale(c)
+
+	// the choice is remembered by the button to not subscribe the user instead of the channel
+	cmd := CmdSubscribeBtn
+	if targetRecipient(c) != chatRecipient(c) {
+		cmd = CmdChannelSubscribeBtn
+	}
+
+	userSettings := recipientSettings(ctx, s, targetRecipient(c))
+	keyboard := buildLanguageButtons(l, manga, userSettings.SubscriptionLanguage, cmd)
+
+	return send(
+		ctx,
+		chatRecipient(c),
+		l.SubscribeChooseLanguage(manga.GetTitle()),
+		withKeyboard(keyboard),
+	)
+}
+
+func onSubscribe(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		err := startFlow(ctx, s, c, stateSubscribeLink, nil)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		if isGroup(c.Chat()) {
+			// the reply is needed to receive the link if the bot's privacy mode is enabled
+			return send(ctx, rec, l.SubscribeInit(), withForceReply(c.Message()))
+		}
+
+		return send(ctx, rec, l.SubscribeInit())
+	}
+}
+
+func onSubscribeBtn(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		rec := chatRecipient(c)
+
+		mangaID, mangaLang, err := parseButtonData(c.Callback().Data)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		return subscribeTo(s, c, mangaID, mangaLang)
+	}
+}
+
+// subscribeTo subscribes the target of the request and offers to set up the subscription
+func subscribeTo(s *service.Services, c telebot.Context, mangaID string, mangaLang string) error {
+	ctx := reqCtx(c)
+	rec := chatRecipient(c)
+	l := locale(c)
+
+	sub, err := s.Subscription.Subscribe(ctx, targetRecipient(c), mangaID, mangaLang)
+	if alsErr := new(subscription.AlreadySubscribedError); errors.As(err, &alsErr) {
+		return send(ctx, rec, l.SubscribeAllreadyFollowing(alsErr.Manga, lang.GetFlagOrLang(alsErr.Lang)))
+	} else if limitErr := new(subscription.SubscriptionLimitError); errors.As(err, &limitErr) {
+		return send(ctx, rec, l.SubscribeLimitReached(limitErr.Limit))
+	} else if err != nil {
+		return handleInternalError(c, rec, err)
+	}
 
+	keyboard := [][]telebot.InlineButton{
+		{
+			{
+				Text:   l.BtnAlerts(sub.StatusAlerts),
+				Data:   formatButtonData(sub.MangaID, sub.Language),
+				Unique: CmdAlertsBtn.String(),
+			},
+		},
+	}
+
+	text := l.SubscribeConfirmed(sub.MangaTitle, lang.GetFlagOrLang(sub.Language))
+
+	// the manga is followed in several languages now
+	if sub.Priority > 0 {
+		text += l.SubscribeLanguageAdded(sub.Priority + 1)
+		keyboard = append(keyboard, []telebot.InlineButton{
+			{
+				Text:   l.BtnFirstLanguageOnly(sub.FirstLanguageOnly),
+				Data:   sub.MangaID,
+				Unique: CmdFirstLangBtn.String(),
+			},
+		})
+	}
+
+	return send(ctx, rec, text, withKeyboard(keyboard))
+}
+
+func onFirstLangBtn(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		mangaID := c.Callback().Data
+		enabled, err := s.Subscription.ToggleFirstLanguageOnly(ctx, targetRecipient(c), mangaID)
+		if errors.Is(err, subscription.ErrNoSuchSubscription) {
+			return send(ctx, rec, l.UnsubscribeNotFollowed())
+		} else if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		return send(ctx, rec, l.FirstLanguageOnlyToggled(enabled))
+	}
+}
+
+func onWaitLangListBtn(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		mangaID := c.Callback().Data
 		manga, err := s.Subscription.Manga(ctx, mangaID)
 		if errors.Is(err, subscription.ErrMangaNotFound) {
-			return send(ctx, rec, lang.SubscribeErrMangaNotFound())
+			return send(ctx, rec, l.SubscribeErrMangaNotFound())
 		} else if err != nil {
 			return handleInternalError(c, rec, err)
 		}
 
-		err = s.Conversation.DeleteConversationContext(ctx, rec)
+		userLang := recipientSettings(ctx, s, targetRecipient(c)).SubscriptionLanguage
+		if userLang == "" {
+			userLang = strings.ToLower(c.Sender().LanguageCode)
+		}
+		keyboard := buildWaitLanguageButtons(manga, userLang)
+		if len(keyboard) == 0 {
+			return send(ctx, rec, l.WaitLangNoLanguages(manga.GetTitle()))
+		}
+
+		return send(ctx, rec, l.WaitLangChoose(manga.GetTitle()), withKeyboard(keyboard))
+	}
+}
+
+func onWaitLangBtn(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		mangaID, mangaLang, err := parseButtonData(c.Callback().Data)
 		if err != nil {
 			return handleInternalError(c, rec, err)
 		}
 
-		keyboard := buildLanguageButtons(manga)
+		watch, err := s.Subscription.WatchLanguage(ctx, targetRecipient(c), mangaID, mangaLang)
+		if errors.Is(err, subscription.ErrLanguageAvailable) {
+			manga, err := s.Subscription.Manga(ctx, mangaID)
+			if err != nil {
+				return handleInternalError(c, rec, err)
+			}
+			return send(
+				ctx,
+				rec,
+				l.WaitLangAvailable(manga.GetTitle(), lang.GetFlagOrLang(mangaLang)),
+				withKeyboard(subscribeButton(l, mangaID, mangaLang)),
+			)
+		} else if errors.Is(err, subscription.ErrMangaNotFound) {
+			return send(ctx, rec, l.SubscribeErrMangaNotFound())
+		} else if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		keyboard := [][]telebot.InlineButton{
+			{
+				{
+					Text:   l.BtnCancel(),
+					Data:   formatButtonData(watch.MangaID, watch.Language),
+					Unique: CmdUnwatchLangBtn.String(),
+				},
+			},
+		}
 
 		return send(
 			ctx,
 			rec,
-			lang.SubscribeChooseLanguage(manga.GetTitle()),
+			l.WaitLangConfirmed(watch.MangaTitle, lang.GetFlagOrLang(watch.Language)),
 			withKeyboard(keyboard),
 		)
 	}
 }
 
-func onSubscribe(s *service.Services) telebot.HandlerFunc {
+func onUnwatchLangBtn(s *service.Services) telebot.HandlerFunc {
 	return func(c telebot.Context) error {
 		ctx := reqCtx(c)
-		rec := domain.RecipientFromInt64(c.Chat().ID)
+		rec := chatRecipient(c)
+		l := locale(c)
 
-		err := s.Conversation.SetConversationContext(ctx, rec, CmdSubscribe.String())
+		mangaID, mangaLang, err := parseButtonData(c.Callback().Data)
 		if err != nil {
 			return handleInternalError(c, rec, err)
 		}
 
-		return send(ctx, rec, lang.SubscribeInit())
+		err = s.Subscription.UnwatchLanguage(ctx, targetRecipient(c), mangaID, mangaLang)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		return send(ctx, rec, l.WaitLangCanceled())
 	}
 }
 
-func onSubscribeBtn(s *service.Services) telebot.HandlerFunc {
+func onUnsubscribe(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		conv, err := s.Conversation.Conversation(ctx, convRecipient(c))
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		} else if conv != nil {
+			return send(ctx, rec, l.ErrWrongContext(conv.State.Command()))
+		}
+
+		query := newPageQuery(c.Message().Payload)
+		page, err := s.Subscription.ListPage(ctx, targetRecipient(c), query)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		} else if page.Total == 0 && query.Filter != "" {
+			return send(ctx, rec, l.ListNoMatches(query.Filter))
+		} else if page.Total == 0 {
+			return send(ctx, rec, l.UnsubscribeNoSubs())
+		}
+
+		return send(
+			ctx,
+			rec,
+			l.UnsubscribeChooseSub()+l.ListFilterHint(CmdUnsubscribe.String(), page.Pages),
+			withKeyboard(buildUnsubscribeButtons(l, page, query)),
+		)
+	}
+}
+
+func onUnsubscribeBtn(s *service.Services) telebot.HandlerFunc {
 	return func(c telebot.Context) error {
 		ctx := reqCtx(c)
-		rec := domain.RecipientFromInt64(c.Chat().ID)
+		rec := chatRecipient(c)
+		l := locale(c)
 
 		mangaID, mangaLang, err := parseButtonData(c.Callback().Data)
 		if err != nil {
 			return handleInternalError(c, rec, err)
 		}
 
-		sub, err := s.Subscription.Subscribe(ctx, rec, mangaID, mangaLang)
-		if alsErr := new(subscription.AlreadySubscribedError); errors.As(err, &alsErr) {
-			return send(ctx, rec, lang.SubscribeAllreadyFollowing(alsErr.Manga, lang.GetFlagOrLang(alsErr.Lang)))
+		sub, err := s.Subscription.Unsubscribe(ctx, targetRecipient(c), mangaID, mangaLang)
+		if errors.Is(err, subscription.ErrNoSuchSubscription) {
+			return send(ctx, rec, l.UnsubscribeNotFollowed())
 		} else if err != nil {
 			return handleInternalError(c, rec, err)
 		}
@@ -177,59 +513,232 @@ func onSubscribeBtn(s *service.Services) telebot.HandlerFunc {
 		return send(
 			ctx,
 			rec,
-			lang.SubscribeConfirmed(sub.MangaTitle, lang.GetFlagOrLang(sub.Language)),
+			l.UnsubscribeConfirmed(sub.MangaTitle, lang.GetFlagOrLang(sub.Language)),
 		)
 	}
 }
 
-func onUnsubscribe(s *service.Services) telebot.HandlerFunc {
+func onList(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		conv, err := s.Conversation.Conversation(ctx, convRecipient(c))
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		} else if conv != nil {
+			return send(ctx, rec, l.ErrWrongContext(conv.State.Command()))
+		}
+
+		query := newPageQuery(c.Message().Payload)
+		page, err := s.Subscription.ListPage(ctx, targetRecipient(c), query)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		} else if page.Total == 0 && query.Filter != "" {
+			return send(ctx, rec, l.ListNoMatches(query.Filter))
+		} else if page.Total == 0 {
+			return send(ctx, rec, l.ListNoSubs())
+		}
+
+		return send(
+			ctx,
+			rec,
+			l.List()+l.ListFilterHint(CmdList.String(), page.Pages),
+			withKeyboard(buildListButtons(l, page, query)),
+		)
+	}
+}
+
+// onListPageBtn switches the page or the order of the /list keyboard
+func onListPageBtn(s *service.Services) telebot.HandlerFunc {
 	return func(c telebot.Context) error {
 		ctx := reqCtx(c)
-		rec := domain.RecipientFromInt64(c.Chat().ID)
+		rec := chatRecipient(c)
+		l := locale(c)
 
-		cmd, err := s.Conversation.ConversationContext(ctx, rec)
+		query, err := parsePageData(c.Callback().Data)
 		if err != nil {
 			return handleInternalError(c, rec, err)
-		} else if cmd != "" {
-			return send(ctx, rec, lang.ErrWrongContext(cmd))
 		}
 
-		subs, err := s.Subscription.List(ctx, rec)
+		page, err := s.Subscription.ListPage(ctx, targetRecipient(c), query)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		} else if page.Total == 0 {
+			return send(ctx, rec, l.ListNoSubs())
+		}
+
+		return editKeyboard(ctx, c.Callback().Message, buildListButtons(l, page, query))
+	}
+}
+
+// onUnsubscribePageBtn switches the page or the order of the /unsubscribe keyboard
+func onUnsubscribePageBtn(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		query, err := parsePageData(c.Callback().Data)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		page, err := s.Subscription.ListPage(ctx, targetRecipient(c), query)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		} else if page.Total == 0 {
+			return send(ctx, rec, l.UnsubscribeNoSubs())
+		}
+
+		return editKeyboard(ctx, c.Callback().Message, buildUnsubscribeButtons(l, page, query))
+	}
+}
+
+func onUnread(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		conv, err := s.Conversation.Conversation(ctx, convRecipient(c))
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		} else if conv != nil {
+			return send(ctx, rec, l.ErrWrongContext(conv.State.Command()))
+		}
+
+		subs, err := s.Subscription.Unread(ctx, targetRecipient(c))
 		if err != nil {
 			return handleInternalError(c, rec, err)
 		} else if len(subs) == 0 {
-			return send(ctx, rec, lang.UnsubscribeNoSubs())
+			return send(ctx, rec, l.UnreadNoSubs())
 		}
 
-		keyboard := [][]telebot.InlineButton{}
+		return send(ctx, rec, l.Unread(), withKeyboard(buildUnreadButtons(l, subs, newPageQuery(""))))
+	}
+}
 
-		for _, sub := range subs {
-			keyboard = append(keyboard, []telebot.InlineButton{
-				{
-					Text:   fmt.Sprintf("[%s] %s", lang.GetFlagOrLang(sub.Language), sub.MangaTitle),
-					Data:   formatButtonData(sub.MangaID, sub.Language),
-					Unique: CmdUnsubscribeBtn.String(),
-				},
-			})
+// onUnreadPageBtn switches the page of the /unread keyboard
+func onUnreadPageBtn(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		query, err := parsePageData(c.Callback().Data)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		subs, err := s.Subscription.Unread(ctx, targetRecipient(c))
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		} else if len(subs) == 0 {
+			return send(ctx, rec, l.UnreadNoSubs())
 		}
 
-		return send(ctx, rec, lang.UnsubscribeChooseSub(), withKeyboard(keyboard))
+		return editKeyboard(ctx, c.Callback().Message, buildUnreadButtons(l, subs, query))
 	}
 }
 
-func onUnsubscribeBtn(s *service.Services) telebot.HandlerFunc {
+func onMarkReadBtn(s *service.Services) telebot.HandlerFunc {
 	return func(c telebot.Context) error {
 		ctx := reqCtx(c)
-		rec := domain.RecipientFromInt64(c.Chat().ID)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		chapterID := c.Callback().Data
+		if chapterID == "" {
+			return handleInternalError(c, rec, fmt.Errorf("invalid button data: \"%s\"", chapterID))
+		}
+
+		subs, err := s.Subscription.MarkRead(ctx, targetRecipient(c), chapterID)
+		if errors.Is(err, subscription.ErrNoSuchSubscription) {
+			return send(ctx, rec, l.MarkReadNotFollowed())
+		} else if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		sub := subs[0]
+		return send(
+			ctx,
+			rec,
+			l.MarkReadConfirmed(sub.MangaTitle, lang.GetFlagOrLang(sub.Language)),
+		)
+	}
+}
+
+func onAlerts(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		conv, err := s.Conversation.Conversation(ctx, convRecipient(c))
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		} else if conv != nil {
+			return send(ctx, rec, l.ErrWrongContext(conv.State.Command()))
+		}
+
+		query := newPageQuery(c.Message().Payload)
+		page, err := s.Subscription.ListPage(ctx, targetRecipient(c), query)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		} else if page.Total == 0 && query.Filter != "" {
+			return send(ctx, rec, l.ListNoMatches(query.Filter))
+		} else if page.Total == 0 {
+			return send(ctx, rec, l.AlertsNoSubs())
+		}
+
+		return send(
+			ctx,
+			rec,
+			l.Alerts()+l.ListFilterHint(CmdAlerts.String(), page.Pages),
+			withKeyboard(buildAlertsButtons(l, page, query)),
+		)
+	}
+}
+
+// onAlertsPageBtn switches the page or the order of the /alerts keyboard
+func onAlertsPageBtn(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		query, err := parsePageData(c.Callback().Data)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		page, err := s.Subscription.ListPage(ctx, targetRecipient(c), query)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		} else if page.Total == 0 {
+			return send(ctx, rec, l.AlertsNoSubs())
+		}
+
+		return editKeyboard(ctx, c.Callback().Message, buildAlertsButtons(l, page, query))
+	}
+}
+
+func onAlertsBtn(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
 
 		mangaID, mangaLang, err := parseButtonData(c.Callback().Data)
 		if err != nil {
 			return handleInternalError(c, rec, err)
 		}
 
-		sub, err := s.Subscription.Unsubscribe(ctx, rec, mangaID, mangaLang)
+		sub, err := s.Subscription.ToggleStatusAlerts(ctx, targetRecipient(c), mangaID, mangaLang)
 		if errors.Is(err, subscription.ErrNoSuchSubscription) {
-			return send(ctx, rec, lang.UnsubscribeNotFollowed())
+			return send(ctx, rec, l.AlertsNotFollowed())
 		} else if err != nil {
 			return handleInternalError(c, rec, err)
 		}
@@ -237,62 +746,77 @@ func onUnsubscribeBtn(s *service.Services) telebot.HandlerFunc {
 		return send(
 			ctx,
 			rec,
-			lang.UnsubscribeConfirmed(sub.MangaTitle, lang.GetFlagOrLang(sub.Language)),
+			l.AlertsToggled(sub.MangaTitle, lang.GetFlagOrLang(sub.Language), sub.StatusAlerts),
 		)
 	}
 }
 
-func onList(s *service.Services) telebot.HandlerFunc {
+func onFilters(s *service.Services) telebot.HandlerFunc {
 	return func(c telebot.Context) error {
 		ctx := reqCtx(c)
-		rec := domain.RecipientFromInt64(c.Chat().ID)
+		rec := chatRecipient(c)
+		l := locale(c)
 
-		cmd, err := s.Conversation.ConversationContext(ctx, rec)
+		conv, err := s.Conversation.Conversation(ctx, convRecipient(c))
 		if err != nil {
 			return handleInternalError(c, rec, err)
-		} else if cmd != "" {
-			return send(ctx, rec, lang.ErrWrongContext(cmd))
+		} else if conv != nil {
+			return send(ctx, rec, l.ErrWrongContext(conv.State.Command()))
 		}
 
-		subs, err := s.Subscription.List(ctx, rec)
+		filter, err := s.Subscription.ChapterFilter(ctx, targetRecipient(c))
 		if err != nil {
 			return handleInternalError(c, rec, err)
-		} else if len(subs) == 0 {
-			return send(ctx, rec, lang.ListNoSubs())
 		}
 
-		keyboard := [][]telebot.InlineButton{}
-		for _, s := range subs {
-			keyboard = append(keyboard, []telebot.InlineButton{
-				{
-					Text: fmt.Sprintf("[%s] %s", lang.GetFlagOrLang(s.Language), s.MangaTitle),
-					URL:  fmt.Sprintf("%s/title/%s", MangaDexURL, s.MangaID),
-				},
-			})
+		return send(ctx, rec, l.Filters(), withKeyboard(buildFilterButtons(l, filter)))
+	}
+}
+
+func onFiltersBtn(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		filter, err := s.Subscription.ChapterFilter(ctx, targetRecipient(c))
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		filter, err = toggleFilterOption(filter, c.Callback().Data)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		err = s.Subscription.SetChapterFilter(ctx, targetRecipient(c), filter)
+		if err != nil {
+			return handleInternalError(c, rec, err)
 		}
 
-		return send(ctx, rec, lang.List(), withKeyboard(keyboard))
+		return editKeyboard(ctx, c.Callback().Message, buildFilterButtons(l, filter))
 	}
 }
 
 func onCancel(s *service.Services) telebot.HandlerFunc {
 	return func(c telebot.Context) error {
 		ctx := reqCtx(c)
-		rec := domain.RecipientFromInt64(c.Chat().ID)
+		rec := chatRecipient(c)
+		l := locale(c)
 
-		cmd, err := s.Conversation.ConversationContext(ctx, rec)
+		conv, err := s.Conversation.Conversation(ctx, convRecipient(c))
 		if err != nil {
 			return handleInternalError(c, rec, err)
-		} else if cmd == "" {
-			return send(ctx, rec, lang.CancelNoCommands())
+		} else if conv == nil {
+			return send(ctx, rec, l.CancelNoCommands())
 		}
 
-		err = s.Conversation.DeleteConversationContext(ctx, rec)
+		err = finishFlow(ctx, s, c)
 		if err != nil {
 			return handleInternalError(c, rec, err)
 		}
 
-		return send(ctx, rec, lang.CancelSuccessful(cmd))
+		return send(ctx, rec, l.CancelSuccessful(conv.State.Command()))
 	}
 }
 
@@ -306,5 +830,5 @@ func handleInternalError(c telebot.Context, rec domain.Recipient, err error) err
 
 	metrics.ErrorsCounter(err).Inc()
 
-	return send(ctx, rec, lang.ErrInternalError())
+	return send(ctx, rec, locale(c).ErrInternalError())
 }
@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strings"
 	"time"
+	"unicode/utf16"
 
 	"github.com/neymee/mdexbot/internal/bot/lang"
 	"github.com/neymee/mdexbot/internal/domain"
@@ -20,6 +21,12 @@ const (
 	MangaDexURL    string = "https://" + MangaDexDomain
 )
 
+const (
+	// messageLimit and captionLimit are max lengths of a message text and a media caption
+	messageLimit = 4096
+	captionLimit = 1024
+)
+
 var ErrInvalidLink = errors.New("invalid link")
 
 func setupReqCtx(c telebot.Context) {
@@ -37,6 +44,9 @@ func reqCtx(c telebot.Context) context.Context {
 	return ctx
 }
 
+// mangaIDRegexp matches ids of manga on MangaDex
+var mangaIDRegexp = regexp.MustCompile("^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$")
+
 // mangaIDFromURL extracts manga id from url
 func mangaIDFromURL(link string) (string, error) {
 	u, err := url.Parse(strings.TrimSpace(link))
@@ -54,30 +64,37 @@ func mangaIDFromURL(link string) (string, error) {
 	}
 
 	id := splitted[2]
-	isUUID, err := regexp.Match("^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$", []byte(id))
-	if err != nil {
-		return "", ErrInvalidLink
-	}
-	if !isUUID {
+	if !mangaIDRegexp.MatchString(id) {
 		return "", ErrInvalidLink
 	}
 
 	return id, nil
 }
 
-func buildLanguageButtons(manga domain.Manga) [][]telebot.InlineButton {
+// buildLanguageButtons returns buttons for languages the manga is translated to.
+// The preferred language goes first if it's available. cmd subscribes to the chosen language.
+func buildLanguageButtons(l *lang.Locale, manga domain.Manga, preferred string, cmd Command) [][]telebot.InlineButton {
+	translations := []string{}
+	for _, code := range manga.TranslationLanguages {
+		if code == preferred {
+			translations = append([]string{code}, translations...)
+		} else {
+			translations = append(translations, code)
+		}
+	}
+
 	langButtons := [][]telebot.InlineButton{
 		{
 			{
-				Text:   fmt.Sprintf("Any %s", lang.GetFlagOrLang("any")),
+				Text:   l.BtnAnyLanguage(lang.GetFlagOrLang("any")),
 				Data:   formatButtonData(manga.ID, "any"),
-				Unique: CmdSubscribeBtn.String(),
+				Unique: cmd.String(),
 			},
 		},
 	}
 	langBtnsRow := []telebot.InlineButton{}
 	var langIdx int
-	for _, translationLang := range manga.TranslationLanguages {
+	for _, translationLang := range translations {
 		if translationLang == "" {
 			continue
 		}
@@ -94,11 +111,61 @@ func buildLanguageButtons(manga domain.Manga) [][]telebot.InlineButton {
 			telebot.InlineButton{
 				Text:   text,
 				Data:   formatButtonData(manga.ID, translationLang),
-				Unique: CmdSubscribeBtn.String(),
+				Unique: cmd.String(),
 			},
 		)
 
-		if langIdx += 1; langIdx%3 == 0 || langIdx == len(manga.TranslationLanguages) {
+		if langIdx += 1; langIdx%3 == 0 || langIdx == len(translations) {
+			langButtons = append(langButtons, langBtnsRow)
+			langBtnsRow = []telebot.InlineButton{}
+		}
+	}
+
+	langButtons = append(langButtons, []telebot.InlineButton{
+		{
+			Text:   l.BtnWaitLang(),
+			Data:   manga.ID,
+			Unique: CmdWaitLangListBtn.String(),
+		},
+	})
+
+	return langButtons
+}
+
+// buildWaitLanguageButtons returns buttons for languages the manga isn't translated to yet.
+// The user's preferred language goes first.
+func buildWaitLanguageButtons(manga domain.Manga, userLang string) [][]telebot.InlineButton {
+	available := map[string]struct{}{}
+	for _, l := range manga.TranslationLanguages {
+		available[l] = struct{}{}
+	}
+
+	candidates := lang.WatchableLanguages
+	if len(userLang) >= 2 {
+		candidates = append([]string{userLang}, candidates...)
+	}
+
+	added := map[string]struct{}{}
+	langs := []string{}
+	for _, l := range candidates {
+		_, isAvailable := available[l]
+		_, isAdded := added[l]
+		if !isAvailable && !isAdded {
+			langs = append(langs, l)
+			added[l] = struct{}{}
+		}
+	}
+
+	langButtons := [][]telebot.InlineButton{}
+	langBtnsRow := []telebot.InlineButton{}
+	for i, l := range langs {
+		langBtnsRow = append(langBtnsRow, telebot.InlineButton{
+			Text:   fmt.Sprintf("%s %s", l, lang.GetFlagOrLang(l)),
+			Data:   formatButtonData(manga.ID, l),
+			Unique: CmdWaitLangBtn.String(),
+		})
+
+		if (i+1)%3 == 0 || i == len(langs)-1 {
 			langButtons = append(langButtons, langBtnsRow)
 			langBtnsRow = []telebot.InlineButton{}
 		}
@@ -107,6 +174,111 @@ func buildLanguageButtons(manga domain.Manga) [][]telebot.InlineButton {
 	return langButtons
 }
 
+func subscribeButton(l *lang.Locale, mangaID string, mangaLang string) [][]telebot.InlineButton {
+	return [][]telebot.InlineButton{
+		{
+			{
+				Text:   fmt.Sprintf("%s %s", l.BtnSubscribe(), lang.GetFlagOrLang(mangaLang)),
+				Data:   formatButtonData(mangaID, mangaLang),
+				Unique: CmdSubscribeBtn.String(),
+			},
+		},
+	}
+}
+
+const (
+	filterOptionRating    = "rating:"
+	filterOptionExternal  = "external"
+	filterOptionScheduled = "scheduled"
+	filterOptionRelease   = "release"
+)
+
+func buildFilterButtons(l *lang.Locale, filter domain.ChapterFilter) [][]telebot.InlineButton {
+	keyboard := [][]telebot.InlineButton{}
+
+	ratings := []telebot.InlineButton{}
+	for _, rating := range domain.ContentRatings {
+		ratings = append(ratings, telebot.InlineButton{
+			Text:   fmt.Sprintf("%s %s", checkIcon(filter.AllowsRating(rating)), l.ContentRating(rating)),
+			Data:   filterOptionRating + rating,
+			Unique: CmdFiltersBtn.String(),
+		})
+	}
+	// two ratings per row
+	for i := 0; i < len(ratings); i += 2 {
+		end := i + 2
+		if end > len(ratings) {
+			end = len(ratings)
+		}
+		keyboard = append(keyboard, ratings[i:end])
+	}
+
+	options := []struct {
+		key     string
+		text    string
+		enabled bool
+	}{
+		{filterOptionExternal, l.BtnFilterExternal(), filter.IncludeExternal},
+		{filterOptionScheduled, l.BtnFilterScheduled(), filter.IncludeScheduled},
+		{filterOptionRelease, l.BtnFilterRelease(), filter.NotifyOnRelease},
+	}
+	for _, o := range options {
+		keyboard = append(keyboard, []telebot.InlineButton{
+			{
+				Text:   fmt.Sprintf("%s %s", checkIcon(o.enabled), o.text),
+				Data:   o.key,
+				Unique: CmdFiltersBtn.String(),
+			},
+		})
+	}
+
+	return keyboard
+}
+
+// toggleFilterOption switches the filter option from the button data to the opposite state
+func toggleFilterOption(filter domain.ChapterFilter, option string) (domain.ChapterFilter, error) {
+	switch {
+	case strings.HasPrefix(option, filterOptionRating):
+		rating := strings.TrimPrefix(option, filterOptionRating)
+		ratings := []string{}
+		found := false
+		for _, r := range filter.ContentRatings {
+			if r == rating {
+				found = true
+				continue
+			}
+			ratings = append(ratings, r)
+		}
+		if !found {
+			ratings = append(ratings, rating)
+		}
+		filter.ContentRatings = ratings
+	case option == filterOptionExternal:
+		filter.IncludeExternal = !filter.IncludeExternal
+	case option == filterOptionScheduled:
+		filter.IncludeScheduled = !filter.IncludeScheduled
+	case option == filterOptionRelease:
+		filter.NotifyOnRelease = !filter.NotifyOnRelease
+	default:
+		return filter, fmt.Errorf("unknown filter option %q", option)
+	}
+	return filter, nil
+}
+
+func checkIcon(enabled bool) string {
+	if enabled {
+		return "✅"
+	}
+	return "⬜"
+}
+
+func alertsIcon(enabled bool) string {
+	if enabled {
+		return "🔔"
+	}
+	return "🔕"
+}
+
 func formatButtonData(mangaID string, lang string) string {
 	return fmt.Sprintf("%s/%s", mangaID, lang)
 }
@@ -118,3 +290,40 @@ func parseButtonData(data string) (string, string, error) {
 	}
 	return splitted[0], splitted[1], nil
 }
+
+func chapterLink(ch domain.Chapter) string {
+	if ch.ExternalUrl != "" {
+		return ch.ExternalUrl
+	}
+	return fmt.Sprintf("%s/chapter/%s", MangaDexURL, ch.ID)
+}
+
+// textLength is the length of the text as Telegram counts it. Markup is counted too,
+// so the real length is never greater.
+func textLength(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
+
+// splitMessage joins the header, the lines and the footer into as few messages as possible
+// not exceeding the limit. Lines are never split.
+func splitMessage(header string, lines []string, footer string, limit int) []string {
+	texts := []string{}
+	current := header
+	for _, line := range lines {
+		if current != "" && textLength(current)+textLength(line) > limit {
+			texts = append(texts, current)
+			current = strings.TrimPrefix(line, "\n")
+			continue
+		}
+		current += line
+	}
+
+	if current != "" && textLength(current)+textLength(footer) > limit {
+		texts = append(texts, current)
+		current = strings.TrimPrefix(footer, "\n")
+	} else {
+		current += footer
+	}
+
+	return append(texts, current)
+}
@@ -1,148 +1,608 @@
-package lang
-
-import (
-	"fmt"
-	"html"
-	"strings"
-)
-
-const (
-	errInternalError = "Error occured. Please try again."
-	errWrongContext  = "You have command <b><i>%s</i></b> in progress. Please finish it or cancel with /cancel to start another command."
-
-	start = "Use command /subscribe to subscribe on manga updates."
-
-	cancelNoCommands = "There is no command to cancel."
-	cancelSuccessful = "The command <b><i>%s</i></b> has been canceled."
-
-	list       = "Titles you follow:"
-	listNoSubs = "You don't have any active subscriptions. You can add subscription with /subscribe command."
-
-	subscribeInit              = "Send me a link on a manga you want to track."
-	subscribeChooseLanguage    = "<b><i>%s</i></b>\n\nChoose the language you want to track:"
-	subscribeConfirmed         = "Great! You will receive a message when a new chapter of [%s] <b><i>%s</i></b> is published."
-	subscribeAllreadyFollowing = "You're already following [%s] <b><i>%s</i></b>."
-	subscribeMangaNotFound     = "The link looks valid, but the manga not found. Please make sure the link is correct."
-
-	subscribeErrInvalidLink = "Link \"%s\" is not recognized. Please send a valid link to a manga page on mangadex.org.\n\nFor example: https://mangadex.org/title/d8a959f7-648e-4c8d-8f23-f1f3f8e129f3/one-punch-man"
-
-	unsubscribeNoSubs      = "You don't have any active subscriptions."
-	unsubscribeChooseSub   = "Choose subscription you want to delete:"
-	unsubscribeConfirmed   = "OK, you will not be longer notified about [%s] <b><i>%s</i></b> updates."
-	unsubscribeNotFollowed = "You're already unsubscribed from this follow. Call /unsubscribe again to get actual follows list."
-
-	newChapterSingle = "[%s] <b><i>%s</i></b>\n\nNew chapter published: <b>%s</b>"
-	newChapterMulti  = "[%s] <b><i>%s</i></b>\n\n%d new chapters published!"
-)
-
-func ErrInternalError() string {
-	return errInternalError
-}
-
-func ErrWrongContext(cmd string) string {
-	cmdEscaped := html.EscapeString(string(cmd))
-	return fmt.Sprintf(errWrongContext, cmdEscaped)
-}
-
-func Start() string {
-	return start
-}
-
-func CancelNoCommands() string {
-	return cancelNoCommands
-}
-func CancelSuccessful(cmd string) string {
-	cmdEscaped := html.EscapeString(string(cmd))
-	return fmt.Sprintf(cancelSuccessful, cmdEscaped)
-}
-
-func List() string {
-	return list
-}
-
-func ListNoSubs() string {
-	return listNoSubs
-}
-
-func SubscribeInit() string {
-	return subscribeInit
-}
-
-func SubscribeChooseLanguage(title string) string {
-	titleEscaped := html.EscapeString(title)
-	return fmt.Sprintf(subscribeChooseLanguage, titleEscaped)
-}
-
-func SubscribeConfirmed(title string, lang string) string {
-	titleEscaped := html.EscapeString(title)
-	langEscaped := html.EscapeString(lang)
-	return fmt.Sprintf(subscribeConfirmed, langEscaped, titleEscaped)
-}
-
-func SubscribeAllreadyFollowing(title string, lang string) string {
-	titleEscaped := html.EscapeString(title)
-	langEscaped := html.EscapeString(lang)
-	return fmt.Sprintf(subscribeAllreadyFollowing, langEscaped, titleEscaped)
-}
-
-func SubscribeErrInvalidLink(link string) string {
-	linkEscaped := html.EscapeString(link)
-	return fmt.Sprintf(subscribeErrInvalidLink, linkEscaped)
-}
-
-func SubscribeErrMangaNotFound() string {
-	return subscribeMangaNotFound
-}
-
-func UnsubscribeNoSubs() string {
-	return unsubscribeNoSubs
-}
-
-func UnsubscribeChooseSub() string {
-	return unsubscribeChooseSub
-}
-
-func UnsubscribeConfirmed(title string, lang string) string {
-	titleEscaped := html.EscapeString(title)
-	langEscaped := html.EscapeString(lang)
-	return fmt.Sprintf(unsubscribeConfirmed, langEscaped, titleEscaped)
-}
-
-func UnsubscribeNotFollowed() string {
-	return unsubscribeNotFollowed
-}
-
-func NewChapterSingle(title, lang, chapterNum, chapterTitle, volumeNum string) string {
-	chBuilder := strings.Builder{}
-	if volumeNum != "" {
-		chBuilder.WriteString(fmt.Sprintf("Vol. %s", volumeNum))
-	}
-	if chapterNum != "" {
-		if chBuilder.Len() > 0 {
-			chBuilder.WriteString(", ")
-		}
-		chBuilder.WriteString(fmt.Sprintf("Ch. %s", chapterNum))
-	}
-	if chapterTitle != "" {
-		if chBuilder.Len() > 0 {
-			chBuilder.WriteString(" - ")
-		}
-		chBuilder.WriteString(chapterTitle)
-	}
-
-	return fmt.Sprintf(
-		newChapterSingle,
-		html.EscapeString(lang),
-		html.EscapeString(title),
-		html.EscapeString(chBuilder.String()),
-	)
-}
-
-func NewChapterMulti(title, lang string, chapterCount int) string {
-	return fmt.Sprintf(
-		newChapterMulti,
-		html.EscapeString(lang),
-		html.EscapeString(title),
-		chapterCount,
-	)
-}
+package lang
+
+import (
+	"html"
+	"strings"
+	"time"
+)
+
+func (l *Locale) ErrInternalError() string {
+	return l.text("errInternalError")
+}
+
+func (l *Locale) ErrWrongContext(cmd string) string {
+	cmdEscaped := html.EscapeString(string(cmd))
+	return l.text("errWrongContext", cmdEscaped)
+}
+
+func (l *Locale) ErrAdminOnly() string {
+	return l.text("errAdminOnly")
+}
+
+func (l *Locale) ErrTooManyRequests() string {
+	return l.text("errTooManyRequests")
+}
+
+func (l *Locale) Start() string {
+	return l.text("start")
+}
+
+func (l *Locale) Help(commands string) string {
+	return l.text("help", commands)
+}
+
+// CommandDescription returns the description of the command shown in the menu and /help
+func (l *Locale) CommandDescription(cmd string) string {
+	if cmd == "" {
+		return ""
+	}
+	return l.text("cmd" + strings.ToUpper(cmd[:1]) + cmd[1:])
+}
+
+func (l *Locale) CancelNoCommands() string {
+	return l.text("cancelNoCommands")
+}
+func (l *Locale) CancelSuccessful(cmd string) string {
+	cmdEscaped := html.EscapeString(string(cmd))
+	return l.text("cancelSuccessful", cmdEscaped)
+}
+
+func (l *Locale) List() string {
+	return l.text("list")
+}
+
+func (l *Locale) ListNoSubs() string {
+	return l.text("listNoSubs")
+}
+
+func (l *Locale) ListNoMatches(filter string) string {
+	return l.text("listNoMatches", html.EscapeString(filter))
+}
+
+func (l *Locale) Share() string {
+	return l.text("share")
+}
+
+// ShareLine returns a line of /share linking to the subscription to the manga
+func (l *Locale) ShareLine(link string, title string, flag string) string {
+	return l.text("shareLine", flag, html.EscapeString(title), link)
+}
+
+// ListFilterHint returns a hint about filtering long lists, it's empty if the list fits one page
+func (l *Locale) ListFilterHint(cmd string, pages int) string {
+	if pages <= 1 {
+		return ""
+	}
+	return l.text("listFilterHint", cmd)
+}
+
+func (l *Locale) SubscribeInit() string {
+	return l.text("subscribeInit")
+}
+
+func (l *Locale) SubscribeChooseLanguage(title string) string {
+	titleEscaped := html.EscapeString(title)
+	return l.text("subscribeChooseLanguage", titleEscaped)
+}
+
+func (l *Locale) SubscribeConfirmed(title string, lang string) string {
+	titleEscaped := html.EscapeString(title)
+	langEscaped := html.EscapeString(lang)
+	return l.text("subscribeConfirmed", langEscaped, titleEscaped)
+}
+
+func (l *Locale) SubscribeAllreadyFollowing(title string, lang string) string {
+	titleEscaped := html.EscapeString(title)
+	langEscaped := html.EscapeString(lang)
+	return l.text("subscribeAllreadyFollowing", langEscaped, titleEscaped)
+}
+
+func (l *Locale) SubscribeLanguageAdded(langNum int) string {
+	return l.text("subscribeLanguageAdded", langNum)
+}
+
+func (l *Locale) SubscribeErrInvalidLink(link string) string {
+	linkEscaped := html.EscapeString(link)
+	return l.text("subscribeErrInvalidLink", linkEscaped)
+}
+
+func (l *Locale) SubscribeLimitReached(limit int) string {
+	return l.text("subscribeLimitReached", limit)
+}
+
+func (l *Locale) SubscribeErrMangaNotFound() string {
+	return l.text("subscribeMangaNotFound")
+}
+
+func (l *Locale) UnsubscribeNoSubs() string {
+	return l.text("unsubscribeNoSubs")
+}
+
+func (l *Locale) UnsubscribeChooseSub() string {
+	return l.text("unsubscribeChooseSub")
+}
+
+func (l *Locale) UnsubscribeConfirmed(title string, lang string) string {
+	titleEscaped := html.EscapeString(title)
+	langEscaped := html.EscapeString(lang)
+	return l.text("unsubscribeConfirmed", langEscaped, titleEscaped)
+}
+
+func (l *Locale) UnsubscribeNotFollowed() string {
+	return l.text("unsubscribeNotFollowed")
+}
+
+func (l *Locale) FirstLanguageOnlyToggled(enabled bool) string {
+	if enabled {
+		return l.text("firstLanguageOnlyEnabled")
+	}
+	return l.text("firstLanguageOnlyDisabled")
+}
+
+func (l *Locale) NewChapterSingle(title, lang, chapterNum, chapterTitle, volumeNum string) string {
+	return l.text(
+		"newChapterSingle",
+		html.EscapeString(lang),
+		html.EscapeString(title),
+		html.EscapeString(l.chapterName(chapterNum, chapterTitle, volumeNum)),
+	)
+}
+
+// NewChapterGroups lists scanlation groups of a single chapter
+func (l *Locale) NewChapterGroups(groups []string) string {
+	if len(groups) == 0 {
+		return ""
+	}
+	return l.text("newChapterGroups", html.EscapeString(strings.Join(groups, ", ")))
+}
+
+// NewChapterLine is a line of the chapters list linking to the chapter
+func (l *Locale) NewChapterLine(link, chapterNum, chapterTitle, volumeNum string, groups []string) string {
+	name := l.chapterName(chapterNum, chapterTitle, volumeNum)
+	if name == "" {
+		name = l.text("chapterOneshot")
+	}
+
+	line := l.text("newChapterLine", html.EscapeString(link), html.EscapeString(name))
+	if len(groups) > 0 {
+		line += l.text("newChapterLineGroup", html.EscapeString(strings.Join(groups, ", ")))
+	}
+	return line
+}
+
+func (l *Locale) chapterName(chapterNum, chapterTitle, volumeNum string) string {
+	chBuilder := strings.Builder{}
+	if volumeNum != "" {
+		chBuilder.WriteString(l.text("chapterVolume", volumeNum))
+	}
+	if chapterNum != "" {
+		if chBuilder.Len() > 0 {
+			chBuilder.WriteString(", ")
+		}
+		chBuilder.WriteString(l.text("chapterNumber", chapterNum))
+	}
+	if chapterTitle != "" {
+		if chBuilder.Len() > 0 {
+			chBuilder.WriteString(" - ")
+		}
+		chBuilder.WriteString(chapterTitle)
+	}
+	return chBuilder.String()
+}
+
+func (l *Locale) NewChapterMulti(title, lang string, chapterCount int) string {
+	return l.plural(
+		"newChapterMulti",
+		chapterCount,
+		html.EscapeString(lang),
+		html.EscapeString(title),
+		chapterCount,
+	)
+}
+
+func (l *Locale) NewChapterUnread(unreadCount int) string {
+	return l.plural("newChapterUnread", unreadCount, unreadCount)
+}
+
+func (l *Locale) Unread() string {
+	return l.text("unread")
+}
+
+func (l *Locale) UnreadNoSubs() string {
+	return l.text("unreadNoSubs")
+}
+
+func (l *Locale) MarkReadConfirmed(title string, lang string) string {
+	titleEscaped := html.EscapeString(title)
+	langEscaped := html.EscapeString(lang)
+	return l.text("markReadConfirmed", langEscaped, titleEscaped)
+}
+
+func (l *Locale) MarkReadNotFollowed() string {
+	return l.text("markReadNotFollowed")
+}
+
+func (l *Locale) BtnRead() string {
+	return l.text("btnRead")
+}
+
+func (l *Locale) BtnMarkRead() string {
+	return l.text("btnMarkRead")
+}
+
+func (l *Locale) BtnOpen() string {
+	return l.text("btnOpen")
+}
+
+// BtnAlerts returns text of the button toggling alerts to the opposite state
+func (l *Locale) BtnAlerts(enabled bool) string {
+	if enabled {
+		return l.text("btnAlertsDisable")
+	}
+	return l.text("btnAlertsEnable")
+}
+
+func (l *Locale) StatusUpdateTitle(title string, lang string) string {
+	titleEscaped := html.EscapeString(title)
+	langEscaped := html.EscapeString(lang)
+	return l.text("statusUpdateTitle", langEscaped, titleEscaped)
+}
+
+func (l *Locale) StatusUpdateStatus(oldStatus, newStatus string) string {
+	if oldStatus == "" {
+		oldStatus = l.text("statusUnknown")
+	}
+	return l.text("statusUpdateStatus", html.EscapeString(oldStatus), html.EscapeString(newStatus))
+}
+
+func (l *Locale) StatusUpdateLanguages(langs []string) string {
+	return l.text("statusUpdateLanguages", html.EscapeString(strings.Join(langs, ", ")))
+}
+
+func (l *Locale) StatusUpdateFinalChapter() string {
+	return l.text("statusUpdateFinalChapter")
+}
+
+func (l *Locale) Alerts() string {
+	return l.text("alerts")
+}
+
+func (l *Locale) AlertsNoSubs() string {
+	return l.text("alertsNoSubs")
+}
+
+func (l *Locale) AlertsToggled(title string, lang string, enabled bool) string {
+	titleEscaped := html.EscapeString(title)
+	langEscaped := html.EscapeString(lang)
+	if enabled {
+		return l.text("alertsEnabled", langEscaped, titleEscaped)
+	}
+	return l.text("alertsDisabled", langEscaped, titleEscaped)
+}
+
+func (l *Locale) AlertsNotFollowed() string {
+	return l.text("alertsNotFollowed")
+}
+
+// NewChapterScheduled shows the publication time in the given time zone
+func (l *Locale) NewChapterScheduled(publishAt time.Time, loc *time.Location) string {
+	return l.text("newChapterScheduled", publishAt.In(loc).Format("2006-01-02 15:04 MST"))
+}
+
+func (l *Locale) ChapterReleased(title string, lang string, count int) string {
+	titleEscaped := html.EscapeString(title)
+	langEscaped := html.EscapeString(lang)
+	return l.plural("chapterReleased", count, langEscaped, titleEscaped, count)
+}
+
+func (l *Locale) Filters() string {
+	return l.text("filters")
+}
+
+// ContentRating returns a human-readable name of the MangaDex content rating
+func (l *Locale) ContentRating(rating string) string {
+	if rating == "" {
+		return rating
+	}
+	name := strings.ToUpper(rating[:1]) + rating[1:]
+	if _, ok := l.lookup("rating" + name); ok {
+		return l.text("rating" + name)
+	}
+	return name
+}
+
+func (l *Locale) BtnFilterExternal() string {
+	return l.text("btnFilterExternal")
+}
+
+func (l *Locale) BtnFilterScheduled() string {
+	return l.text("btnFilterScheduled")
+}
+
+func (l *Locale) BtnFilterRelease() string {
+	return l.text("btnFilterRelease")
+}
+
+func (l *Locale) BtnWaitLang() string {
+	return l.text("btnWaitLang")
+}
+
+func (l *Locale) BtnCancel() string {
+	return l.text("btnCancel")
+}
+
+func (l *Locale) BtnSubscribe() string {
+	return l.text("btnSubscribe")
+}
+
+// BtnAnyLanguage returns text of the button subscribing to chapters in any language
+func (l *Locale) BtnAnyLanguage(flag string) string {
+	return l.text("btnAnyLanguage", flag)
+}
+
+func (l *Locale) WaitLangChoose(title string) string {
+	return l.text("waitLangChoose", html.EscapeString(title))
+}
+
+func (l *Locale) WaitLangNoLanguages(title string) string {
+	return l.text("waitLangNoLanguages", html.EscapeString(title))
+}
+
+func (l *Locale) WaitLangConfirmed(title string, lang string) string {
+	titleEscaped := html.EscapeString(title)
+	langEscaped := html.EscapeString(lang)
+	return l.text("waitLangConfirmed", langEscaped, titleEscaped)
+}
+
+func (l *Locale) WaitLangAvailable(title string, lang string) string {
+	titleEscaped := html.EscapeString(title)
+	langEscaped := html.EscapeString(lang)
+	return l.text("waitLangAvailable", langEscaped, titleEscaped)
+}
+
+func (l *Locale) WaitLangCanceled() string {
+	return l.text("waitLangCanceled")
+}
+
+func (l *Locale) WaitLangAppeared(title string, lang string) string {
+	titleEscaped := html.EscapeString(title)
+	langEscaped := html.EscapeString(lang)
+	return l.text("waitLangAppeared", langEscaped, titleEscaped)
+}
+
+func (l *Locale) WaitLangMangaRemoved(title string, lang string) string {
+	titleEscaped := html.EscapeString(title)
+	langEscaped := html.EscapeString(lang)
+	return l.text("waitLangMangaRemoved", langEscaped, titleEscaped)
+}
+
+// BtnFirstLanguageOnly returns text of the button toggling the option to the opposite state
+func (l *Locale) BtnFirstLanguageOnly(enabled bool) string {
+	if enabled {
+		return l.text("btnFirstLangOff")
+	}
+	return l.text("btnFirstLangOn")
+}
+
+func (l *Locale) ChannelInit() string {
+	return l.text("channelInit")
+}
+
+func (l *Locale) ChannelManaged(title string) string {
+	return l.text("channelManaged", html.EscapeString(title))
+}
+
+func (l *Locale) ChannelCurrent(title string) string {
+	return l.text("channelCurrent", html.EscapeString(title))
+}
+
+func (l *Locale) ChannelStopped() string {
+	return l.text("channelStopped")
+}
+
+func (l *Locale) ChannelNotFound() string {
+	return l.text("channelNotFound")
+}
+
+func (l *Locale) ChannelNotChannel() string {
+	return l.text("channelNotChannel")
+}
+
+func (l *Locale) ChannelUserNotAdmin(title string) string {
+	return l.text("channelUserNotAdmin", html.EscapeString(title))
+}
+
+func (l *Locale) ChannelBotNotAdmin(title string) string {
+	return l.text("channelBotNotAdmin", html.EscapeString(title))
+}
+
+func (l *Locale) ChannelAdminLost(title string) string {
+	return l.text("channelAdminLost", html.EscapeString(title))
+}
+
+func (l *Locale) ChannelPrivateOnly() string {
+	return l.text("channelPrivateOnly")
+}
+
+func (l *Locale) BtnChannelStop() string {
+	return l.text("btnChannelStop")
+}
+
+func (l *Locale) Settings() string {
+	return l.text("settings")
+}
+
+func (l *Locale) SettingsTimeZoneInit() string {
+	return l.text("settingsTimeZoneInit")
+}
+
+func (l *Locale) SettingsTimeZoneInvalid(name string) string {
+	return l.text("settingsTimeZoneInvalid", html.EscapeString(name))
+}
+
+func (l *Locale) SettingsTimeZoneSet(name string) string {
+	return l.text("settingsTimeZoneSet", html.EscapeString(name))
+}
+
+// BtnSettingsLanguage returns text of the button switching the interface language, empty language is automatic
+func (l *Locale) BtnSettingsLanguage(language string) string {
+	if language == "" {
+		return l.text("btnSettingsLanguage", l.text("settingsLanguageAuto"))
+	}
+	return l.text("btnSettingsLanguage", GetFlagOrLang(language))
+}
+
+func (l *Locale) BtnSettingsTimeZone(name string) string {
+	return l.text("btnSettingsTimeZone", name)
+}
+
+func (l *Locale) BtnSettingsSound(enabled bool) string {
+	if enabled {
+		return l.text("btnSettingsSoundOn")
+	}
+	return l.text("btnSettingsSoundOff")
+}
+
+func (l *Locale) BtnSettingsDigest(mode string, dailyHour int) string {
+	switch mode {
+	case "hourly":
+		return l.text("btnSettingsDigest", l.text("settingsDigestHourly"))
+	case "daily":
+		return l.text("btnSettingsDigest", l.text("settingsDigestDaily", dailyHour))
+	default:
+		return l.text("btnSettingsDigest", l.text("settingsDigestOff"))
+	}
+}
+
+// BtnSettingsSubscriptionLanguage returns text of the button choosing the default subscription language
+func (l *Locale) BtnSettingsSubscriptionLanguage(language string) string {
+	if language == "" {
+		return l.text("btnSettingsSubLang", l.text("settingsSubLangNone"))
+	}
+	return l.text("btnSettingsSubLang", GetFlagOrLang(language))
+}
+
+func (l *Locale) BtnSettingsOther() string {
+	return l.text("btnSettingsOther")
+}
+
+func (l *Locale) BtnSettingsBack() string {
+	return l.text("btnSettingsBack")
+}
+
+func (l *Locale) BtnPagePrev() string {
+	return l.text("btnPagePrev")
+}
+
+func (l *Locale) BtnPageNext() string {
+	return l.text("btnPageNext")
+}
+
+// BtnSort returns text of the button ordering subscriptions
+func (l *Locale) BtnSort(sort string) string {
+	switch sort {
+	case "updated":
+		return l.text("btnSortUpdated")
+	case "language":
+		return l.text("btnSortLanguage")
+	default:
+		return l.text("btnSortTitle")
+	}
+}
+
+func (l *Locale) Digest(titles int) string {
+	return l.plural("digest", titles, titles)
+}
+
+// DigestLine is a line of the digest about chapters of a manga
+func (l *Locale) DigestLine(link string, title string, lang string, chapters int, released bool) string {
+	count := l.plural("digestChapters", chapters, chapters)
+	if released {
+		count = l.plural("digestReleased", chapters, chapters)
+	}
+	return l.text("digestLine", html.EscapeString(lang), link, html.EscapeString(title), count)
+}
+
+func (l *Locale) AdminStats(
+	recipients, subscriptions, topics, sent, failed, pending int64,
+	lastCycle time.Time,
+	lastCycleDuration time.Duration,
+) string {
+	cycle := l.text("adminCycleNever")
+	if !lastCycle.IsZero() {
+		cycle = l.text("adminCycle", lastCycle.UTC().Format("2006-01-02 15:04:05"), lastCycleDuration.Round(time.Millisecond))
+	}
+	return l.text("adminStats", recipients, subscriptions, topics, sent, failed, pending, cycle)
+}
+
+func (l *Locale) AdminUserUsage() string {
+	return l.text("adminUserUsage")
+}
+
+func (l *Locale) AdminUser(id int64, language, timeZone, digest string, subscriptions int) string {
+	return l.plural("adminUser", subscriptions, id, language, timeZone, digest, subscriptions)
+}
+
+func (l *Locale) AdminUserSubscription(title string, flag string) string {
+	return l.text("adminUserSubscription", flag, html.EscapeString(title))
+}
+
+func (l *Locale) AdminCheckStarted() string {
+	return l.text("adminCheckStarted")
+}
+
+func (l *Locale) AdminCheckQueued() string {
+	return l.text("adminCheckQueued")
+}
+
+func (l *Locale) AdminBlockUsage(cmd string) string {
+	return l.text("adminBlockUsage", cmd)
+}
+
+func (l *Locale) AdminBlockAdmin() string {
+	return l.text("adminBlockAdmin")
+}
+
+func (l *Locale) AdminBlocked(id int64) string {
+	return l.text("adminBlocked", id)
+}
+
+func (l *Locale) AdminUnblocked(id int64) string {
+	return l.text("adminUnblocked", id)
+}
+
+func (l *Locale) AdminBroadcastInit() string {
+	return l.text("adminBroadcastInit")
+}
+
+func (l *Locale) AdminBroadcastInvalid(reason string) string {
+	return l.text("adminBroadcastInvalid", html.EscapeString(reason))
+}
+
+func (l *Locale) AdminBroadcastConfirm(recipients int) string {
+	return l.plural("adminBroadcastConfirm", recipients, recipients)
+}
+
+func (l *Locale) AdminBroadcastPending() string {
+	return l.text("adminBroadcastPending")
+}
+
+func (l *Locale) AdminBroadcastExpired() string {
+	return l.text("adminBroadcastExpired")
+}
+
+func (l *Locale) AdminBroadcastStarted(recipients int) string {
+	return l.plural("adminBroadcastStarted", recipients, recipients)
+}
+
+func (l *Locale) AdminBroadcastDone(delivered int, failed int) string {
+	return l.text("adminBroadcastDone", delivered, failed)
+}
+
+func (l *Locale) BtnBroadcastSend() string {
+	return l.text("btnBroadcastSend")
+}
+
+func (l *Locale) BtnBroadcastCancel() string {
+	return l.text("btnBroadcastCancel")
+}
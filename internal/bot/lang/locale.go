@@ -0,0 +1,144 @@
+package lang
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultLocale is used if the user's language is not supported
+// and for messages missing in a locale
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// message is a catalog entry, either a plain text or texts for every plural category
+type message struct {
+	text   string
+	plural map[string]string
+}
+
+func (m *message) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &m.text); err == nil {
+		return nil
+	}
+	return json.Unmarshal(data, &m.plural)
+}
+
+// Locale renders messages of the catalog in a language
+type Locale struct {
+	code     string
+	messages map[string]message
+	fallback *Locale
+}
+
+var locales = mustLoadLocales()
+
+func mustLoadLocales() map[string]*Locale {
+	files, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	loaded := map[string]*Locale{}
+	for _, f := range files {
+		data, err := localeFiles.ReadFile(path.Join("locales", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+
+		l := &Locale{code: strings.TrimSuffix(f.Name(), path.Ext(f.Name()))}
+		if err := json.Unmarshal(data, &l.messages); err != nil {
+			panic(fmt.Errorf("locale %s: %w", f.Name(), err))
+		}
+		loaded[l.code] = l
+	}
+
+	def, ok := loaded[DefaultLocale]
+	if !ok {
+		panic(fmt.Errorf("default locale %s is missing", DefaultLocale))
+	}
+	for code, l := range loaded {
+		if code != DefaultLocale {
+			l.fallback = def
+		}
+	}
+
+	return loaded
+}
+
+// Get returns the locale for the IETF language tag, e.g. Telegram language_code.
+// The base language is used if the regional variant is not supported, the default locale if neither is.
+func Get(code string) *Locale {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if l, ok := locales[code]; ok {
+		return l
+	}
+	if base, _, found := strings.Cut(code, "-"); found {
+		if l, ok := locales[base]; ok {
+			return l
+		}
+	}
+	return locales[DefaultLocale]
+}
+
+// Locales returns codes of all supported locales, the default one goes first
+func Locales() []string {
+	codes := make([]string, 0, len(locales))
+	for code := range locales {
+		if code != DefaultLocale {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	return append([]string{DefaultLocale}, codes...)
+}
+
+// Code returns the language code of the locale
+func (l *Locale) Code() string {
+	return l.code
+}
+
+func (l *Locale) lookup(key string) (message, bool) {
+	for loc := l; loc != nil; loc = loc.fallback {
+		if m, ok := loc.messages[key]; ok {
+			return m, true
+		}
+	}
+	return message{}, false
+}
+
+// text formats the message, the key itself is returned if the message is missing
+func (l *Locale) text(key string, args ...interface{}) string {
+	m, ok := l.lookup(key)
+	if !ok {
+		return key
+	}
+
+	if m.plural != nil {
+		return l.plural(key, 0, args...)
+	} else if len(args) == 0 {
+		return m.text
+	}
+	return fmt.Sprintf(m.text, args...)
+}
+
+// plural formats the message in the plural form for the count
+func (l *Locale) plural(key string, count int, args ...interface{}) string {
+	m, ok := l.lookup(key)
+	if !ok {
+		return key
+	} else if m.plural == nil {
+		return l.text(key, args...)
+	}
+
+	text, ok := m.plural[pluralCategory(l.code, count)]
+	if !ok {
+		text = m.plural[pluralOther]
+	}
+	return fmt.Sprintf(text, args...)
+}
@@ -0,0 +1,104 @@
+package lang
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var verbRegexp = regexp.MustCompile(`%[-+# 0]*[0-9]*(\.[0-9]+)?[a-zA-Z%]`)
+
+func TestLocalesDefineEveryKey(t *testing.T) {
+	def := locales[DefaultLocale]
+
+	for _, code := range Locales() {
+		l := locales[code]
+
+		for key, defMsg := range def.messages {
+			msg, ok := l.messages[key]
+			if !assert.Truef(t, ok, "locale %s: message %q is missing", code, key) {
+				continue
+			}
+
+			if defMsg.plural == nil {
+				assert.Nilf(t, msg.plural, "locale %s: message %q must not have plural forms", code, key)
+				assert.Equalf(t, verbRegexp.FindAllString(defMsg.text, -1), verbRegexp.FindAllString(msg.text, -1),
+					"locale %s: message %q has different format verbs", code, key)
+				continue
+			}
+
+			if !assert.NotNilf(t, msg.plural, "locale %s: message %q must have plural forms", code, key) {
+				continue
+			}
+			for _, category := range pluralCategories(code) {
+				text, ok := msg.plural[category]
+				if assert.Truef(t, ok, "locale %s: message %q has no %q form", code, key, category) {
+					assert.Equalf(t, verbRegexp.FindAllString(defMsg.plural[pluralOther], -1), verbRegexp.FindAllString(text, -1),
+						"locale %s: %q form of message %q has different format verbs", code, category, key)
+				}
+			}
+		}
+
+		for key := range l.messages {
+			_, ok := def.messages[key]
+			assert.Truef(t, ok, "locale %s: message %q is not defined in the default locale", code, key)
+		}
+	}
+}
+
+func TestLocales(t *testing.T) {
+	codes := Locales()
+	assert.Equal(t, DefaultLocale, codes[0])
+	assert.True(t, sort.StringsAreSorted(codes[1:]))
+	assert.Len(t, codes, len(locales))
+}
+
+func TestGet(t *testing.T) {
+	assert.Equal(t, "ru", Get("ru").Code())
+	assert.Equal(t, "ru", Get("RU-ru").Code(), "base language expected for a regional variant")
+	assert.Equal(t, DefaultLocale, Get("tlh").Code(), "default locale expected for an unsupported language")
+	assert.Equal(t, DefaultLocale, Get("").Code())
+}
+
+func TestPluralCategory(t *testing.T) {
+	cases := []struct {
+		code     string
+		count    int
+		category string
+	}{
+		{"en", 0, pluralOther},
+		{"en", 1, pluralOne},
+		{"en", 2, pluralOther},
+		{"en", 11, pluralOther},
+		{"ru", 1, pluralOne},
+		{"ru", 21, pluralOne},
+		{"ru", 11, pluralMany},
+		{"ru", 2, pluralFew},
+		{"ru", 24, pluralFew},
+		{"ru", 12, pluralMany},
+		{"ru", 5, pluralMany},
+		{"ru", 0, pluralMany},
+		{"ru", 111, pluralMany},
+	}
+	for _, c := range cases {
+		assert.Equalf(t, c.category, pluralCategory(c.code, c.count), "%s %d", c.code, c.count)
+	}
+}
+
+func TestPlural(t *testing.T) {
+	en, ru := Get("en"), Get("ru")
+
+	assert.Equal(t, "\n\nYou're 1 chapter behind.", en.NewChapterUnread(1))
+	assert.Equal(t, "\n\nYou're 3 chapters behind.", en.NewChapterUnread(3))
+	assert.Equal(t, "\n\nУ вас 22 непрочитанные главы.", ru.NewChapterUnread(22))
+	assert.Equal(t, "\n\nУ вас 15 непрочитанных глав.", ru.NewChapterUnread(15))
+}
+
+func TestCommandDescription(t *testing.T) {
+	l := Get("ru")
+	assert.Equal(t, l.text("cmdSubscribe"), l.CommandDescription("subscribe"))
+	assert.NotEqual(t, "cmdSubscribe", l.CommandDescription("subscribe"))
+	assert.Empty(t, l.CommandDescription(""))
+}
@@ -0,0 +1,43 @@
+package lang
+
+// Plural categories as defined by CLDR
+const (
+	pluralOne   = "one"
+	pluralFew   = "few"
+	pluralMany  = "many"
+	pluralOther = "other"
+)
+
+// pluralCategory returns the CLDR plural category of the integer count in the language
+func pluralCategory(code string, count int) string {
+	if count < 0 {
+		count = -count
+	}
+
+	switch code {
+	case "ru", "uk":
+		switch mod10, mod100 := count%10, count%100; {
+		case mod10 == 1 && mod100 != 11:
+			return pluralOne
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return pluralFew
+		default:
+			return pluralMany
+		}
+	default:
+		if count == 1 {
+			return pluralOne
+		}
+		return pluralOther
+	}
+}
+
+// pluralCategories returns categories integer counts fall into in the language
+func pluralCategories(code string) []string {
+	switch code {
+	case "ru", "uk":
+		return []string{pluralOne, pluralFew, pluralMany}
+	default:
+		return []string{pluralOne, pluralOther}
+	}
+}
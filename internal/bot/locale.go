@@ -0,0 +1,44 @@
+package bot
+
+import (
+	"github.com/neymee/mdexbot/internal/bot/lang"
+	"github.com/neymee/mdexbot/internal/domain"
+	"github.com/neymee/mdexbot/internal/service"
+	"gopkg.in/telebot.v3"
+)
+
+// keyLocale is the key of the locale replies to the request are written in
+const keyLocale = "locale"
+
+// locale returns the locale replies to the request are written in
+func locale(c telebot.Context) *lang.Locale {
+	if l, ok := c.Get(keyLocale).(*lang.Locale); ok {
+		return l
+	}
+	return lang.Get(lang.DefaultLocale)
+}
+
+// localeMiddleware resolves the locale of the request. The language saved in settings of the chat
+// takes precedence over the language of the user's Telegram client.
+func localeMiddleware(s *service.Services) telebot.MiddlewareFunc {
+	return func(next telebot.HandlerFunc) telebot.HandlerFunc {
+		return func(c telebot.Context) error {
+			c.Set(keyLocale, chatLocale(c, recipientSettings(reqCtx(c), s, chatRecipient(c))))
+			return next(c)
+		}
+	}
+}
+
+// chatLocale returns the locale of replies to the chat with the settings
+func chatLocale(c telebot.Context, userSettings domain.UserSettings) *lang.Locale {
+	code := userSettings.Language
+	if code == "" && c.Sender() != nil {
+		code = c.Sender().LanguageCode
+	}
+	return lang.Get(code)
+}
+
+// recipientLocale returns the locale notifications to the recipient are written in
+func recipientLocale(userSettings domain.UserSettings) *lang.Locale {
+	return lang.Get(userSettings.Language)
+}
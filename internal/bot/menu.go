@@ -0,0 +1,135 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/bot/lang"
+	"github.com/neymee/mdexbot/internal/log"
+	"gopkg.in/telebot.v3"
+)
+
+// Command lists are shown by Telegram according to the chat and the user's role in it
+const (
+	scopePrivate = telebot.CommandScopeAllPrivateChats
+	scopeGroup   = telebot.CommandScopeAllGroupChats
+	scopeAdmins  = telebot.CommandScopeAllChatAdmin
+	// scopeConsole is set for private chats of every admin of the bot
+	scopeConsole = telebot.CommandScopeChat
+)
+
+// menuCommands returns commands offered in the scope. Group members can't change subscriptions of the chat,
+// so admin only commands are offered to administrators. The console is offered to the bot admins only.
+func menuCommands(scope string) []Command {
+	cmds := []Command{}
+	for _, h := range commandHandlers() {
+		if !h.menu {
+			continue
+		} else if scope != scopeConsole && h.cmd.ConsoleOnly() {
+			continue
+		} else if scope != scopePrivate && scope != scopeConsole && h.private {
+			continue
+		} else if scope == scopeGroup && h.cmd.AdminOnly() {
+			continue
+		}
+		cmds = append(cmds, h.cmd)
+	}
+	return cmds
+}
+
+// registerCommands sets the command lists of every scope in every language
+func registerCommands(ctx context.Context) error {
+	defer func(start time.Time) {
+		log.Log(ctx, "bot.registerCommands").Trace().
+			Dur("duration", time.Since(start)).
+			Send()
+	}(time.Now())
+
+	scopes := []telebot.CommandScope{
+		{Type: scopePrivate},
+		{Type: scopeGroup},
+		{Type: scopeAdmins},
+	}
+	for _, id := range adminIDs() {
+		scopes = append(scopes, telebot.CommandScope{Type: scopeConsole, ChatID: id})
+	}
+
+	for _, scope := range scopes {
+		err := setScopeCommands(scope)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateConsoleCommands offers the console to added admins and removes it from chats of removed ones
+func updateConsoleCommands(ctx context.Context, added []int64, removed []int64) error {
+	defer func(start time.Time) {
+		log.Log(ctx, "bot.updateConsoleCommands").Trace().
+			Dur("duration", time.Since(start)).
+			Ints64("added", added).
+			Ints64("removed", removed).
+			Send()
+	}(time.Now())
+
+	for _, id := range added {
+		err := setScopeCommands(telebot.CommandScope{Type: scopeConsole, ChatID: id})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, id := range removed {
+		scope := telebot.CommandScope{Type: scopeConsole, ChatID: id}
+		for _, code := range lang.Locales() {
+			_, err := bot.DeleteCommands(scope, commandsLangCode(code))
+			if err != nil {
+				return fmt.Errorf("deleting commands of scope %s in %q: %w", scope.Type, code, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// setScopeCommands sets the command list of the scope in every language
+func setScopeCommands(scope telebot.CommandScope) error {
+	for _, code := range lang.Locales() {
+		l := lang.Get(code)
+
+		cmds := []telebot.Command{}
+		for _, cmd := range menuCommands(scope.Type) {
+			cmds = append(cmds, telebot.Command{
+				Text:        cmd.String(),
+				Description: l.CommandDescription(cmd.String()),
+			})
+		}
+
+		err := bot.SetCommands(cmds, scope, commandsLangCode(code))
+		if err != nil {
+			return fmt.Errorf("setting commands of scope %s in %q: %w", scope.Type, code, err)
+		}
+	}
+	return nil
+}
+
+// commandsLangCode returns the language of a command list,
+// the list without a language is shown to users of languages the bot doesn't speak
+func commandsLangCode(code string) string {
+	if code == lang.DefaultLocale {
+		return ""
+	}
+	return code
+}
+
+func buildHelpMessage(l *lang.Locale, cmds []Command) string {
+	lines := []string{}
+	for _, cmd := range cmds {
+		lines = append(lines, fmt.Sprintf("/%s — %s", cmd, l.CommandDescription(cmd.String())))
+	}
+	return l.Help(strings.Join(lines, "\n"))
+}
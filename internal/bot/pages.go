@@ -0,0 +1,231 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/neymee/mdexbot/internal/bot/lang"
+	"github.com/neymee/mdexbot/internal/domain"
+	"gopkg.in/telebot.v3"
+)
+
+const (
+	// listPageSize is a number of subscriptions on a page of /list, /unsubscribe, /alerts and /unread keyboards
+	listPageSize = 10
+	// pageFilterLimit is a max length of the filter in bytes, callback data is limited to 64 bytes
+	pageFilterLimit = 32
+)
+
+// newPageQuery returns the query of the first page of subscriptions matching the filter
+func newPageQuery(filter string) domain.SubscriptionQuery {
+	filter = strings.TrimSpace(filter)
+	for len(filter) > pageFilterLimit {
+		_, size := utf8.DecodeLastRuneInString(filter)
+		filter = filter[:len(filter)-size]
+	}
+
+	return domain.SubscriptionQuery{
+		Sort:     domain.SubscriptionSorts[0],
+		Filter:   filter,
+		PageSize: listPageSize,
+	}
+}
+
+// formatPageData encodes the query as "page:sort:filter", sort is an index in domain.SubscriptionSorts
+func formatPageData(query domain.SubscriptionQuery) string {
+	sortIdx := 0
+	for i, sort := range domain.SubscriptionSorts {
+		if sort == query.Sort {
+			sortIdx = i
+		}
+	}
+	return fmt.Sprintf("%d:%d:%s", query.Page, sortIdx, query.Filter)
+}
+
+func parsePageData(data string) (domain.SubscriptionQuery, error) {
+	splitted := strings.SplitN(data, ":", 3)
+	if len(splitted) != 3 {
+		return domain.SubscriptionQuery{}, fmt.Errorf("invalid button data: \"%s\"", data)
+	}
+
+	page, err := strconv.Atoi(splitted[0])
+	if err != nil {
+		return domain.SubscriptionQuery{}, fmt.Errorf("invalid button data: \"%s\"", data)
+	}
+	sortIdx, err := strconv.Atoi(splitted[1])
+	if err != nil || sortIdx < 0 || sortIdx >= len(domain.SubscriptionSorts) {
+		return domain.SubscriptionQuery{}, fmt.Errorf("invalid button data: \"%s\"", data)
+	}
+
+	query := newPageQuery(splitted[2])
+	query.Page = page
+	query.Sort = domain.SubscriptionSorts[sortIdx]
+	return query, nil
+}
+
+// buildPageButtons returns rows switching pages and the order of subscriptions
+func buildPageButtons(
+	l *lang.Locale,
+	page domain.SubscriptionPage,
+	query domain.SubscriptionQuery,
+	cmd Command,
+) [][]telebot.InlineButton {
+	keyboard := buildNavButtons(l, page.Page, page.Pages, query, cmd)
+
+	if page.Total > 1 {
+		sorts := []telebot.InlineButton{}
+		for _, sort := range domain.SubscriptionSorts {
+			sorted := query
+			sorted.Page = 0
+			sorted.Sort = sort
+
+			text := l.BtnSort(sort)
+			if sort == query.Sort {
+				text = fmt.Sprintf("%s %s", checkIcon(true), text)
+			}
+			sorts = append(sorts, telebot.InlineButton{Text: text, Data: formatPageData(sorted), Unique: cmd.String()})
+		}
+		keyboard = append(keyboard, sorts)
+	}
+
+	return keyboard
+}
+
+// buildNavButtons returns a row switching pages, it's empty if there is a single page
+func buildNavButtons(
+	l *lang.Locale,
+	page int,
+	pages int,
+	query domain.SubscriptionQuery,
+	cmd Command,
+) [][]telebot.InlineButton {
+	if pages <= 1 {
+		return [][]telebot.InlineButton{}
+	}
+
+	nav := []telebot.InlineButton{}
+	if page > 0 {
+		prev := query
+		prev.Page = page - 1
+		nav = append(nav, telebot.InlineButton{Text: l.BtnPagePrev(), Data: formatPageData(prev), Unique: cmd.String()})
+	}
+
+	current := query
+	current.Page = page
+	nav = append(nav, telebot.InlineButton{
+		Text:   fmt.Sprintf("%d/%d", page+1, pages),
+		Data:   formatPageData(current),
+		Unique: cmd.String(),
+	})
+
+	if page < pages-1 {
+		next := query
+		next.Page = page + 1
+		nav = append(nav, telebot.InlineButton{Text: l.BtnPageNext(), Data: formatPageData(next), Unique: cmd.String()})
+	}
+	return [][]telebot.InlineButton{nav}
+}
+
+// buildListButtons links to the manga of every subscription on the page
+func buildListButtons(
+	l *lang.Locale,
+	page domain.SubscriptionPage,
+	query domain.SubscriptionQuery,
+) [][]telebot.InlineButton {
+	subs := page.Subscriptions
+
+	// languages of the same manga are adjacent and ordered by priority if sorted by title
+	keyboard := [][]telebot.InlineButton{}
+	for i := 0; i < len(subs); {
+		sub := subs[i]
+		flags := []string{}
+		for ; i < len(subs) && subs[i].MangaID == sub.MangaID; i++ {
+			flags = append(flags, lang.GetFlagOrLang(subs[i].Language))
+		}
+
+		keyboard = append(keyboard, []telebot.InlineButton{
+			{
+				Text: fmt.Sprintf("[%s] %s", strings.Join(flags, " › "), sub.MangaTitle),
+				URL:  fmt.Sprintf("%s/title/%s", MangaDexURL, sub.MangaID),
+			},
+		})
+	}
+
+	return append(keyboard, buildPageButtons(l, page, query, CmdListPageBtn)...)
+}
+
+// buildUnsubscribeButtons offers to delete every subscription on the page
+func buildUnsubscribeButtons(
+	l *lang.Locale,
+	page domain.SubscriptionPage,
+	query domain.SubscriptionQuery,
+) [][]telebot.InlineButton {
+	keyboard := [][]telebot.InlineButton{}
+	for _, sub := range page.Subscriptions {
+		keyboard = append(keyboard, []telebot.InlineButton{
+			{
+				Text:   fmt.Sprintf("[%s] %s", lang.GetFlagOrLang(sub.Language), sub.MangaTitle),
+				Data:   formatButtonData(sub.MangaID, sub.Language),
+				Unique: CmdUnsubscribeBtn.String(),
+			},
+		})
+	}
+
+	return append(keyboard, buildPageButtons(l, page, query, CmdUnsubscribePageBtn)...)
+}
+
+// buildAlertsButtons toggles status alerts of every subscription on the page
+func buildAlertsButtons(
+	l *lang.Locale,
+	page domain.SubscriptionPage,
+	query domain.SubscriptionQuery,
+) [][]telebot.InlineButton {
+	keyboard := [][]telebot.InlineButton{}
+	for _, sub := range page.Subscriptions {
+		keyboard = append(keyboard, []telebot.InlineButton{
+			{
+				Text:   fmt.Sprintf("%s [%s] %s", alertsIcon(sub.StatusAlerts), lang.GetFlagOrLang(sub.Language), sub.MangaTitle),
+				Data:   formatButtonData(sub.MangaID, sub.Language),
+				Unique: CmdAlertsBtn.String(),
+			},
+		})
+	}
+
+	return append(keyboard, buildPageButtons(l, page, query, CmdAlertsPageBtn)...)
+}
+
+// buildUnreadButtons links to the manga of every subscription with unread chapters on the requested page.
+// Subscriptions are ordered by title, so only pages can be switched.
+func buildUnreadButtons(
+	l *lang.Locale,
+	subs []domain.UnreadSubscription,
+	query domain.SubscriptionQuery,
+) [][]telebot.InlineButton {
+	pages := (len(subs) + listPageSize - 1) / listPageSize
+	page := query.Page
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	end := (page + 1) * listPageSize
+	if end > len(subs) {
+		end = len(subs)
+	}
+
+	keyboard := [][]telebot.InlineButton{}
+	for _, s := range subs[page*listPageSize : end] {
+		keyboard = append(keyboard, []telebot.InlineButton{
+			{
+				Text: fmt.Sprintf("[%s] %s (%d)", lang.GetFlagOrLang(s.Language), s.MangaTitle, s.Unread),
+				URL:  fmt.Sprintf("%s/title/%s", MangaDexURL, s.MangaID),
+			},
+		})
+	}
+
+	return append(keyboard, buildNavButtons(l, page, pages, query, CmdUnreadPageBtn)...)
+}
@@ -0,0 +1,269 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/config"
+	"github.com/neymee/mdexbot/internal/domain"
+	"github.com/neymee/mdexbot/internal/log"
+	"github.com/neymee/mdexbot/internal/metrics"
+	"gopkg.in/telebot.v3"
+)
+
+// sendPriority orders messages in the send queue, lower values are sent first
+type sendPriority int
+
+const (
+	// priorityInteractive is for replies to users' commands
+	priorityInteractive sendPriority = iota
+	// priorityBulk is for notifications
+	priorityBulk
+
+	prioritiesCount = 2
+)
+
+func (p sendPriority) String() string {
+	if p == priorityInteractive {
+		return "interactive"
+	}
+	return "bulk"
+}
+
+type sendRequest struct {
+	ctx  context.Context
+	to   domain.Recipient
+	what interface{} // a text or a telebot.Sendable
+	// edit is the message to be replaced instead of sending a new one
+	edit     telebot.Editable
+	opt      *telebot.SendOptions
+	priority sendPriority
+	queuedAt time.Time
+	retries  int
+	// result is buffered to not block the queue
+	result chan sendResult
+}
+
+// sendResult is the sent message or the sending error
+type sendResult struct {
+	msg *telebot.Message
+	err error
+}
+
+// sendQueue paces messages according to Telegram limits: the number of messages per second
+// for all chats and the interval between messages to the same chat.
+// Messages to the same chat are sent in the order they are queued.
+type sendQueue struct {
+	mu       sync.Mutex
+	queues   [prioritiesCount][]*sendRequest
+	chatNext map[domain.Recipient]time.Time
+	wake     chan struct{}
+
+	// limits are guarded by mu, they are changed when the config is reloaded
+	globalInterval time.Duration
+	chatInterval   time.Duration
+	maxRetries     int
+	deliver        func(*sendRequest) (*telebot.Message, error)
+
+	// now and after are the clock of the queue, they are replaced in tests
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+}
+
+func newSendQueue(cfg *config.Config, deliver func(*sendRequest) (*telebot.Message, error)) *sendQueue {
+	q := &sendQueue{
+		chatNext: map[domain.Recipient]time.Time{},
+		wake:     make(chan struct{}, 1),
+		deliver:  deliver,
+		now:      time.Now,
+		after:    time.After,
+	}
+	q.setLimits(cfg)
+	return q
+}
+
+func (q *sendQueue) setLimits(cfg *config.Config) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.globalInterval = time.Second / time.Duration(cfg.Bot.RateLimit.MessagesPerSec)
+	q.chatInterval = time.Duration(cfg.Bot.RateLimit.ChatIntervalMs) * time.Millisecond
+	q.maxRetries = cfg.Bot.RateLimit.MaxRetries
+}
+
+func (q *sendQueue) limits() (globalInterval time.Duration, maxRetries int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.globalInterval, q.maxRetries
+}
+
+// lengths returns numbers of queued messages by priority
+func (q *sendQueue) lengths() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	res := make(map[string]int, prioritiesCount)
+	for p, queue := range q.queues {
+		res[sendPriority(p).String()] = len(queue)
+	}
+	return res
+}
+
+// push adds the request to the queue. Retried requests are put in front to keep the order.
+func (q *sendQueue) push(req *sendRequest, front bool) {
+	q.mu.Lock()
+	if front {
+		q.queues[req.priority] = append([]*sendRequest{req}, q.queues[req.priority]...)
+	} else {
+		q.queues[req.priority] = append(q.queues[req.priority], req)
+	}
+	metrics.SendQueueLength(req.priority.String()).Set(float64(len(q.queues[req.priority])))
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next returns the first request to a chat ready to receive a message. If there is no such request,
+// it returns the time until the earliest chat becomes ready or 0 if the queue is empty.
+func (q *sendQueue) next(now time.Time) (*sendRequest, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var wait time.Duration
+	for p := range q.queues {
+		queue := q.queues[p]
+		for i := 0; i < len(queue); i++ {
+			req := queue[i]
+
+			if err := req.ctx.Err(); err != nil {
+				// nobody waits for the result
+				req.result <- sendResult{err: err}
+				queue = append(queue[:i], queue[i+1:]...)
+				i--
+				continue
+			}
+
+			ready := q.chatNext[req.to]
+			if ready.After(now) {
+				if d := ready.Sub(now); wait == 0 || d < wait {
+					wait = d
+				}
+				continue
+			}
+
+			q.chatNext[req.to] = now.Add(q.chatInterval)
+			q.queues[p] = append(queue[:i], queue[i+1:]...)
+			metrics.SendQueueLength(sendPriority(p).String()).Set(float64(len(q.queues[p])))
+			return req, 0
+		}
+		q.queues[p] = queue
+		metrics.SendQueueLength(sendPriority(p).String()).Set(float64(len(queue)))
+	}
+
+	if wait == 0 {
+		// the queue is empty, forget chats that are ready anyway
+		for rec, ready := range q.chatNext {
+			if !ready.After(now) {
+				delete(q.chatNext, rec)
+			}
+		}
+	}
+
+	return nil, wait
+}
+
+// pauseChat postpones messages to the chat
+func (q *sendQueue) pauseChat(to domain.Recipient, until time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if until.After(q.chatNext[to]) {
+		q.chatNext[to] = until
+	}
+}
+
+func (q *sendQueue) run(ctx context.Context) {
+	const method = "bot.sendQueue.run"
+
+	var nextSend time.Time
+	for {
+		req, wait := q.next(q.now())
+		if req == nil {
+			var timer <-chan time.Time
+			if wait > 0 {
+				timer = q.after(wait)
+			}
+
+			select {
+			case <-q.wake:
+			case <-timer:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		if d := nextSend.Sub(q.now()); d > 0 {
+			select {
+			case <-q.after(d):
+			case <-ctx.Done():
+				req.result <- sendResult{err: ctx.Err()}
+				return
+			}
+		}
+		globalInterval, maxRetries := q.limits()
+		nextSend = q.now().Add(globalInterval)
+
+		metrics.SendQueueWait(req.priority.String()).Observe(q.now().Sub(req.queuedAt).Seconds())
+		msg, err := q.deliver(req)
+
+		floodErr := telebot.FloodError{}
+		if errors.As(err, &floodErr) && req.retries < maxRetries {
+			// the flood limit may be exceeded for the whole bot, so all messages are paused
+			retryAfter := time.Duration(floodErr.RetryAfter) * time.Second
+			nextSend = q.now().Add(retryAfter)
+			q.pauseChat(req.to, nextSend)
+
+			log.Log(req.ctx, method).Warn().
+				Int64("recipient", req.to.AsInt64()).
+				Dur("retry_after", retryAfter).
+				Int("retries", req.retries).
+				Msg("Flood limit exceeded, the message will be resent")
+
+			req.retries++
+			metrics.SendRetriesCounter.Inc()
+			q.push(req, true)
+			continue
+		}
+
+		req.result <- sendResult{msg: msg, err: err}
+	}
+}
+
+// enqueue adds a message to the queue and returns a channel receiving the result.
+// If edit is not nil, the message replaces it.
+func (q *sendQueue) enqueue(
+	ctx context.Context,
+	to domain.Recipient,
+	what interface{},
+	edit telebot.Editable,
+	opt *telebot.SendOptions,
+	priority sendPriority,
+) <-chan sendResult {
+	req := &sendRequest{
+		ctx:      ctx,
+		to:       to,
+		what:     what,
+		edit:     edit,
+		opt:      opt,
+		priority: priority,
+		queuedAt: q.now(),
+		result:   make(chan sendResult, 1),
+	}
+	q.push(req, false)
+	return req.result
+}
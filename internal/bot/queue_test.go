@@ -0,0 +1,172 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/config"
+	"github.com/neymee/mdexbot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/telebot.v3"
+)
+
+// fakeClock jumps forward instead of waiting
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) after(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.t
+	return ch
+}
+
+// queued is a message put in the queue before it starts
+type queued struct {
+	to       domain.Recipient
+	text     string
+	priority sendPriority
+	// expired requests are cancelled before the queue starts
+	expired bool
+}
+
+// attempt is a message passed to the send function at the time since the start
+type attempt struct {
+	text string
+	at   time.Duration
+}
+
+func TestSendQueue(t *testing.T) {
+	chat1, chat2, chat3 := domain.RecipientFromInt64(1), domain.RecipientFromInt64(2), domain.RecipientFromInt64(3)
+
+	for _, tc := range []struct {
+		name       string
+		maxRetries int
+		queued     []queued
+		// floods are numbers of flood errors returned for the message before it's sent
+		floods   map[string]int
+		attempts []attempt
+		// failed are messages which result is an error
+		failed map[string]error
+	}{
+		{
+			name:     "global interval",
+			queued:   []queued{{to: chat1, text: "a"}, {to: chat2, text: "b"}, {to: chat3, text: "c"}},
+			attempts: []attempt{{"a", 0}, {"b", 100 * time.Millisecond}, {"c", 200 * time.Millisecond}},
+		},
+		{
+			name:     "chat interval",
+			queued:   []queued{{to: chat1, text: "a1"}, {to: chat1, text: "a2"}, {to: chat2, text: "b"}},
+			attempts: []attempt{{"a1", 0}, {"b", 100 * time.Millisecond}, {"a2", time.Second}},
+		},
+		{
+			name: "priority",
+			queued: []queued{
+				{to: chat1, text: "bulk", priority: priorityBulk},
+				{to: chat2, text: "interactive", priority: priorityInteractive},
+			},
+			attempts: []attempt{{"interactive", 0}, {"bulk", 100 * time.Millisecond}},
+		},
+		{
+			name:       "flood retry keeps the order",
+			maxRetries: 3,
+			queued:     []queued{{to: chat1, text: "a1"}, {to: chat1, text: "a2"}},
+			floods:     map[string]int{"a1": 1},
+			attempts:   []attempt{{"a1", 0}, {"a1", 2 * time.Second}, {"a2", 3 * time.Second}},
+		},
+		{
+			name:       "flood pauses all chats",
+			maxRetries: 3,
+			queued:     []queued{{to: chat1, text: "a"}, {to: chat2, text: "b"}},
+			floods:     map[string]int{"a": 1},
+			attempts:   []attempt{{"a", 0}, {"b", 2 * time.Second}, {"a", 2*time.Second + 100*time.Millisecond}},
+		},
+		{
+			name:       "retries exhausted",
+			maxRetries: 1,
+			queued:     []queued{{to: chat1, text: "a"}},
+			floods:     map[string]int{"a": 2},
+			attempts:   []attempt{{"a", 0}, {"a", 2 * time.Second}},
+			failed:     map[string]error{"a": telebot.FloodError{RetryAfter: 2}},
+		},
+		{
+			name:     "expired request is dropped",
+			queued:   []queued{{to: chat1, text: "a", expired: true}, {to: chat2, text: "b"}},
+			attempts: []attempt{{"b", 0}},
+			failed:   map[string]error{"a": context.Canceled},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Bot.RateLimit.MessagesPerSec = 10
+			cfg.Bot.RateLimit.ChatIntervalMs = 1000
+			cfg.Bot.RateLimit.MaxRetries = tc.maxRetries
+
+			clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+			start := clock.now()
+
+			var attempts []attempt
+			q := newSendQueue(cfg, func(req *sendRequest) (*telebot.Message, error) {
+				text := req.what.(string)
+				attempts = append(attempts, attempt{text: text, at: clock.now().Sub(start)})
+				if tc.floods[text] > 0 {
+					tc.floods[text]--
+					return nil, telebot.FloodError{RetryAfter: 2}
+				}
+				return &telebot.Message{Text: text}, nil
+			})
+			q.now, q.after = clock.now, clock.after
+
+			results := map[string]<-chan sendResult{}
+			for _, m := range tc.queued {
+				ctx, cancel := context.WithCancel(context.Background())
+				if m.expired {
+					cancel()
+				} else {
+					defer cancel()
+				}
+				results[m.text] = q.enqueue(ctx, m.to, m.text, nil, nil, m.priority)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan struct{})
+			go func() {
+				q.run(ctx)
+				close(stopped)
+			}()
+
+			for text, result := range results {
+				select {
+				case res := <-result:
+					if exp, ok := tc.failed[text]; ok {
+						assert.ErrorIs(t, res.err, exp, text)
+						assert.Nil(t, res.msg, text)
+					} else {
+						assert.NoError(t, res.err, text)
+						require.NotNil(t, res.msg, text)
+						assert.Equal(t, text, res.msg.Text)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("no result of %q", text)
+				}
+			}
+			cancel()
+			<-stopped
+
+			assert.Equal(t, tc.attempts, attempts)
+		})
+	}
+}
@@ -2,11 +2,13 @@ package bot
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/neymee/mdexbot/internal/domain"
-	"github.com/neymee/mdexbot/internal/errors"
+	werrors "github.com/neymee/mdexbot/internal/errors"
 	"github.com/neymee/mdexbot/internal/log"
 	"github.com/neymee/mdexbot/internal/metrics"
 	"gopkg.in/telebot.v3"
@@ -14,15 +16,36 @@ import (
 
 type sendOptionFunc func(*telebot.SendOptions)
 
+// send queues a reply to the user and waits until it's sent
 func send(ctx context.Context, to domain.Recipient, text string, options ...sendOptionFunc) error {
-	defer func(start time.Time) {
-		metrics.MessageCounter.Inc()
-		log.Log(ctx, "bot.send").Trace().
-			Dur("duration", time.Since(start)).
-			Int64("recipient", to.AsInt64()).
-			Send()
-	}(time.Now())
+	select {
+	case res := <-queue.enqueue(ctx, to, text, nil, sendOptions(options...), priorityInteractive):
+		return res.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
+// sendBulk queues a notification, the result channel receives the sent message or the error.
+// what is a text or a telebot.Sendable.
+func sendBulk(ctx context.Context, to domain.Recipient, what interface{}, options ...sendOptionFunc) <-chan sendResult {
+	return queue.enqueue(ctx, to, what, nil, sendOptions(options...), priorityBulk)
+}
+
+// editBulk queues replacing the text of a notification sent earlier.
+// If what is a *telebot.Photo, only the caption of the message is replaced.
+func editBulk(
+	ctx context.Context,
+	to domain.Recipient,
+	messageID int,
+	what interface{},
+	options ...sendOptionFunc,
+) <-chan sendResult {
+	msg := telebot.StoredMessage{MessageID: strconv.Itoa(messageID), ChatID: to.AsInt64()}
+	return queue.enqueue(ctx, to, what, msg, sendOptions(options...), priorityBulk)
+}
+
+func sendOptions(options ...sendOptionFunc) *telebot.SendOptions {
 	opt := &telebot.SendOptions{
 		ParseMode:             telebot.ModeHTML,
 		DisableWebPagePreview: true,
@@ -33,9 +56,81 @@ func send(ctx context.Context, to domain.Recipient, text string, options ...send
 		o(opt)
 	}
 
-	_, err := bot.Send(to, text, opt)
+	return opt
+}
+
+// deliver sends the message to Telegram, it's called by the send queue only
+func deliver(req *sendRequest) (*telebot.Message, error) {
+	defer func(start time.Time) {
+		metrics.MessageCounter.Inc()
+		log.Log(req.ctx, "bot.deliver").Trace().
+			Dur("duration", time.Since(start)).
+			Int64("recipient", req.to.AsInt64()).
+			Str("priority", req.priority.String()).
+			Send()
+	}(time.Now())
+
+	if req.edit != nil {
+		return edit(req)
+	}
+
+	msg, err := bot.Send(req.to, req.what, req.opt)
+	if photo, ok := req.what.(*telebot.Photo); ok && err != nil {
+		if failure, _ := classifySendError(err); failure == failureMessage {
+			// Telegram can't fetch the image, the caption is sent alone
+			log.Log(req.ctx, "bot.deliver").Warn().
+				Err(err).
+				Str("photo_url", photo.FileURL).
+				Msg("Unable to send photo")
+
+			msg, err = nil, nil
+			if photo.Caption != "" {
+				msg, err = bot.Send(req.to, photo.Caption, req.opt)
+			}
+		}
+	}
 	if err != nil {
-		metrics.ErrorsCounter(fmt.Errorf("%w: %w", errors.TelegramError, err)).Inc()
+		metrics.ErrorsCounter(fmt.Errorf("%w: %w", werrors.TelegramError, err)).Inc()
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func edit(req *sendRequest) (*telebot.Message, error) {
+	var msg *telebot.Message
+	var err error
+	if photo, ok := req.what.(*telebot.Photo); ok {
+		msg, err = bot.EditCaption(req.edit, photo.Caption, req.opt)
+	} else {
+		msg, err = bot.Edit(req.edit, req.what, req.opt)
+	}
+
+	if errors.Is(err, telebot.ErrMessageNotModified) || errors.Is(err, telebot.ErrSameMessageContent) {
+		// the message already has the same content
+		return msg, nil
+	} else if err != nil {
+		metrics.ErrorsCounter(fmt.Errorf("%w: %w", werrors.TelegramError, err)).Inc()
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// editKeyboard replaces inline keyboard of the message sent earlier
+func editKeyboard(ctx context.Context, msg telebot.Editable, keyboard [][]telebot.InlineButton) error {
+	defer func(start time.Time) {
+		log.Log(ctx, "bot.editKeyboard").Trace().
+			Dur("duration", time.Since(start)).
+			Send()
+	}(time.Now())
+
+	_, err := bot.EditReplyMarkup(msg, &telebot.ReplyMarkup{InlineKeyboard: keyboard})
+	if errors.Is(err, telebot.ErrMessageNotModified) || errors.Is(err, telebot.ErrSameMessageContent) {
+		// e.g. the button of the current page is pressed
+		return nil
+	} else if err != nil {
+		metrics.ErrorsCounter(fmt.Errorf("%w: %w", werrors.TelegramError, err)).Inc()
 		return err
 	}
 
@@ -49,3 +144,28 @@ func withKeyboard(keyboard [][]telebot.InlineButton) sendOptionFunc {
 		}
 	}
 }
+
+// withSound lets the notification play a sound according to the recipient's settings
+func withSound(enabled bool) sendOptionFunc {
+	return func(opt *telebot.SendOptions) {
+		opt.DisableNotification = !enabled
+	}
+}
+
+// withReplyTo sends the message as a reply, it points to the user the message is addressed to in groups
+func withReplyTo(msg *telebot.Message) sendOptionFunc {
+	return func(opt *telebot.SendOptions) {
+		opt.ReplyTo = msg
+	}
+}
+
+// withForceReply asks the user of the message to reply, other group members are not affected
+func withForceReply(msg *telebot.Message) sendOptionFunc {
+	return func(opt *telebot.SendOptions) {
+		opt.ReplyTo = msg
+		opt.ReplyMarkup = &telebot.ReplyMarkup{
+			ForceReply: true,
+			Selective:  true,
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/neymee/mdexbot/internal/bot/lang"
+	"github.com/neymee/mdexbot/internal/domain"
+	"github.com/neymee/mdexbot/internal/log"
+	"github.com/neymee/mdexbot/internal/metrics"
+	"github.com/neymee/mdexbot/internal/service"
+	"github.com/neymee/mdexbot/internal/service/settings"
+	"gopkg.in/telebot.v3"
+)
+
+const (
+	settingsOptionLanguage  = "language"
+	settingsOptionTimeZone  = "tz"
+	settingsOptionSound     = "sound"
+	settingsOptionDigest    = "digest"
+	settingsOptionSubLang   = "sublang"
+	settingsOptionMain      = "main"
+	settingsOptionSeparator = ":"
+	settingsOptionOther     = "other"
+)
+
+// settingsTimeZones are offered in the menu, others can be typed
+var settingsTimeZones = []string{
+	"UTC", "Europe/London", "Europe/Berlin", "Europe/Moscow",
+	"America/New_York", "America/Chicago", "America/Los_Angeles", "America/Sao_Paulo",
+	"Asia/Kolkata", "Asia/Jakarta", "Asia/Shanghai", "Asia/Tokyo",
+}
+
+// recipientSettings returns settings of the recipient, the defaults are used if they can't be fetched
+func recipientSettings(ctx context.Context, s *service.Services, rec domain.Recipient) domain.UserSettings {
+	userSettings, err := s.Settings.Settings(ctx, rec)
+	if err != nil {
+		metrics.ErrorsCounter(err).Inc()
+		log.Error(ctx, "bot.recipientSettings", err).
+			Int64("recipient", rec.AsInt64()).
+			Msg("Fetching user settings error")
+		return domain.DefaultUserSettings()
+	}
+	return userSettings
+}
+
+func onSettings(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		conv, err := s.Conversation.Conversation(ctx, convRecipient(c))
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		} else if conv != nil {
+			return send(ctx, rec, l.ErrWrongContext(conv.State.Command()))
+		}
+
+		userSettings, err := s.Settings.Settings(ctx, targetRecipient(c))
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		return send(ctx, rec, l.Settings(), withKeyboard(buildSettingsButtons(l, userSettings)))
+	}
+}
+
+// onSettingsBtn changes the setting from the button data or opens the list of its values
+func onSettingsBtn(s *service.Services) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx := reqCtx(c)
+		rec := chatRecipient(c)
+		l := locale(c)
+
+		userSettings, err := s.Settings.Settings(ctx, targetRecipient(c))
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		option := c.Callback().Data
+		switch option {
+		case settingsOptionTimeZone:
+			return editKeyboard(ctx, c.Callback().Message, buildTimeZoneButtons(l))
+		case settingsOptionSubLang:
+			return editKeyboard(ctx, c.Callback().Message, buildSubscriptionLanguageButtons(l))
+		case settingsOptionMain:
+			return editKeyboard(ctx, c.Callback().Message, buildSettingsButtons(l, userSettings))
+		case settingsOptionTimeZone + settingsOptionSeparator + settingsOptionOther:
+			payload := settingsTimeZonePayload{MenuID: c.Callback().Message.ID}
+			err = startFlow(ctx, s, c, stateSettingsTimeZone, payload)
+			if err != nil {
+				return handleInternalError(c, rec, err)
+			}
+			return send(ctx, rec, l.SettingsTimeZoneInit())
+		}
+
+		userSettings, err = applySettingsOption(userSettings, option)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		err = s.Settings.SetSettings(ctx, targetRecipient(c), userSettings)
+		if err != nil {
+			return handleInternalError(c, rec, err)
+		}
+
+		if targetRecipient(c) == rec {
+			// the menu is shown in the chosen language at once
+			l = chatLocale(c, userSettings)
+		}
+
+		return editKeyboard(ctx, c.Callback().Message, buildSettingsButtons(l, userSettings))
+	}
+}
+
+// settingsTimeZonePayload is kept while the user is typing a time zone
+type settingsTimeZonePayload struct {
+	MenuID int `json:"menu_id"` // the settings message to update
+}
+
+// onSettingsText sets the time zone typed by the user
+func onSettingsText(s *service.Services, c telebot.Context, conv domain.Conversation) error {
+	ctx := reqCtx(c)
+	rec := chatRecipient(c)
+	l := locale(c)
+
+	var payload settingsTimeZonePayload
+	err := conv.Decode(&payload)
+	if err != nil {
+		return handleInternalError(c, rec, err)
+	}
+
+	userSettings, err := s.Settings.Settings(ctx, targetRecipient(c))
+	if err != nil {
+		return handleInternalError(c, rec, err)
+	}
+
+	userSettings.TimeZone = strings.TrimSpace(c.Text())
+	err = s.Settings.SetSettings(ctx, targetRecipient(c), userSettings)
+	if errors.Is(err, settings.ErrInvalidTimeZone) {
+		return send(ctx, rec, l.SettingsTimeZoneInvalid(userSettings.TimeZone), withReplyTo(c.Message()))
+	} else if err != nil {
+		return handleInternalError(c, rec, err)
+	}
+
+	err = finishFlow(ctx, s, c)
+	if err != nil {
+		return handleInternalError(c, rec, err)
+	}
+
+	keyboard := buildSettingsButtons(l, userSettings)
+	if payload.MenuID != 0 {
+		menu := &telebot.StoredMessage{MessageID: strconv.Itoa(payload.MenuID), ChatID: c.Chat().ID}
+		if editKeyboard(ctx, menu, keyboard) == nil {
+			return send(ctx, rec, l.SettingsTimeZoneSet(userSettings.TimeZone))
+		}
+		// the menu has been deleted, a new one is sent
+	}
+
+	return send(ctx, rec, l.SettingsTimeZoneSet(userSettings.TimeZone), withKeyboard(keyboard))
+}
+
+func buildSettingsButtons(l *lang.Locale, userSettings domain.UserSettings) [][]telebot.InlineButton {
+	options := []struct {
+		key  string
+		text string
+	}{
+		{settingsOptionLanguage, l.BtnSettingsLanguage(userSettings.Language)},
+		{settingsOptionTimeZone, l.BtnSettingsTimeZone(userSettings.TimeZone)},
+		{settingsOptionSound, l.BtnSettingsSound(userSettings.Sound)},
+		{settingsOptionDigest, l.BtnSettingsDigest(userSettings.DigestMode, domain.DigestDailyHour)},
+		{settingsOptionSubLang, l.BtnSettingsSubscriptionLanguage(userSettings.SubscriptionLanguage)},
+	}
+
+	keyboard := [][]telebot.InlineButton{}
+	for _, o := range options {
+		keyboard = append(keyboard, []telebot.InlineButton{
+			{
+				Text:   o.text,
+				Data:   o.key,
+				Unique: CmdSettingsBtn.String(),
+			},
+		})
+	}
+	return keyboard
+}
+
+func buildTimeZoneButtons(l *lang.Locale) [][]telebot.InlineButton {
+	values := append(append([]string{}, settingsTimeZones...), settingsOptionOther)
+
+	keyboard := [][]telebot.InlineButton{}
+	row := []telebot.InlineButton{}
+	for i, tz := range values {
+		text := tz
+		if tz == settingsOptionOther {
+			text = l.BtnSettingsOther()
+		}
+		row = append(row, telebot.InlineButton{
+			Text:   text,
+			Data:   settingsOptionTimeZone + settingsOptionSeparator + tz,
+			Unique: CmdSettingsBtn.String(),
+		})
+
+		if (i+1)%2 == 0 || i == len(values)-1 {
+			keyboard = append(keyboard, row)
+			row = []telebot.InlineButton{}
+		}
+	}
+
+	return append(keyboard, settingsBackButton(l))
+}
+
+func buildSubscriptionLanguageButtons(l *lang.Locale) [][]telebot.InlineButton {
+	// the empty language unsets the default
+	values := append([]string{""}, lang.WatchableLanguages...)
+
+	keyboard := [][]telebot.InlineButton{}
+	row := []telebot.InlineButton{}
+	for i, code := range values {
+		text := l.BtnSettingsSubscriptionLanguage(code)
+		if code != "" {
+			text = fmt.Sprintf("%s %s", code, lang.GetFlagOrLang(code))
+		}
+		row = append(row, telebot.InlineButton{
+			Text:   text,
+			Data:   settingsOptionSubLang + settingsOptionSeparator + code,
+			Unique: CmdSettingsBtn.String(),
+		})
+
+		if i == 0 || i%3 == 0 || i == len(values)-1 {
+			keyboard = append(keyboard, row)
+			row = []telebot.InlineButton{}
+		}
+	}
+
+	return append(keyboard, settingsBackButton(l))
+}
+
+func settingsBackButton(l *lang.Locale) []telebot.InlineButton {
+	return []telebot.InlineButton{
+		{
+			Text:   l.BtnSettingsBack(),
+			Data:   settingsOptionMain,
+			Unique: CmdSettingsBtn.String(),
+		},
+	}
+}
+
+// applySettingsOption changes the setting from the button data.
+// Toggles and cycles switch to the next value, lists set the chosen one.
+func applySettingsOption(userSettings domain.UserSettings, option string) (domain.UserSettings, error) {
+	key, value, hasValue := strings.Cut(option, settingsOptionSeparator)
+
+	switch {
+	case key == settingsOptionLanguage && !hasValue:
+		userSettings.Language = nextValue(append([]string{""}, lang.Locales()...), userSettings.Language)
+	case key == settingsOptionSound && !hasValue:
+		userSettings.Sound = !userSettings.Sound
+	case key == settingsOptionDigest && !hasValue:
+		userSettings.DigestMode = nextValue(domain.DigestModes, userSettings.DigestMode)
+	case key == settingsOptionTimeZone && hasValue:
+		userSettings.TimeZone = value
+	case key == settingsOptionSubLang && hasValue:
+		userSettings.SubscriptionLanguage = value
+	default:
+		return userSettings, fmt.Errorf("unknown settings option %q", option)
+	}
+	return userSettings, nil
+}
+
+// nextValue returns the value following the current one, values are cycled
+func nextValue(values []string, current string) string {
+	for i, v := range values {
+		if v == current {
+			return values[(i+1)%len(values)]
+		}
+	}
+	return values[0]
+}
@@ -0,0 +1,219 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/metrics"
+	"gopkg.in/telebot.v3"
+)
+
+const (
+	// telegramProbeTTL is how long the result of a Telegram check is reused
+	telegramProbeTTL = 30 * time.Second
+	// cycleLagGrace is added to two check periods before a lagging update check is considered unhealthy
+	cycleLagGrace = 5 * time.Minute
+)
+
+// cycleState describes update checks since the start
+type cycleState struct {
+	period   time.Duration
+	total    int
+	failed   int
+	start    time.Time
+	duration time.Duration
+	success  time.Time
+	err      error
+}
+
+// Status is the state of the bot shown on the status page, times are zero until the first check
+type Status struct {
+	StartedAt         time.Time      `json:"started_at"`
+	Webhook           bool           `json:"webhook"`
+	Polling           bool           `json:"polling"`
+	CheckPeriod       string         `json:"check_period"`
+	NextCheck         time.Time      `json:"next_check"`
+	Cycles            int            `json:"cycles"`
+	FailedCycles      int            `json:"failed_cycles"`
+	LastCycleStart    time.Time      `json:"last_cycle_start"`
+	LastCycleDuration string         `json:"last_cycle_duration"`
+	LastSuccess       time.Time      `json:"last_success"`
+	LastError         string         `json:"last_error,omitempty"`
+	SendQueue         map[string]int `json:"send_queue"`
+}
+
+var (
+	statusMu    sync.RWMutex
+	startedAt   time.Time
+	polling     bool
+	webhookMode bool
+	cycles      cycleState
+	nextCheck   time.Time
+
+	telegramMu    sync.Mutex
+	telegramErr   error
+	telegramProbe time.Time
+	// telegramDone is closed when the running probe finishes, nil if there is no running probe
+	telegramDone chan struct{}
+)
+
+// statusPoller tracks whether the poller is running
+type statusPoller struct {
+	telebot.Poller
+}
+
+func (p statusPoller) Poll(b *telebot.Bot, dest chan telebot.Update, stop chan struct{}) {
+	setPolling(true)
+	defer setPolling(false)
+	p.Poller.Poll(b, dest, stop)
+}
+
+func setPolling(running bool) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	polling = running
+}
+
+// setCheckPeriod is called by the updates checker when it schedules the next check
+func setCheckPeriod(period time.Duration, next time.Time) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	cycles.period, nextCheck = period, next
+}
+
+func recordCycle(start time.Time, duration time.Duration, err error) {
+	metrics.CycleDuration.Observe(duration.Seconds())
+	metrics.CyclesCounter(err).Inc()
+	if err == nil {
+		metrics.SetLastCycle(start.Add(duration))
+	}
+
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	cycles.total++
+	cycles.start, cycles.duration, cycles.err = start, duration, err
+	if err != nil {
+		cycles.failed++
+	} else {
+		cycles.success = start.Add(duration)
+	}
+}
+
+// lastCycle returns the start and the duration of the last finished update check
+func lastCycle() (time.Time, time.Duration) {
+	statusMu.RLock()
+	defer statusMu.RUnlock()
+	return cycles.start, cycles.duration
+}
+
+// CurrentStatus returns the state of the bot and its update checks
+func CurrentStatus() Status {
+	statusMu.RLock()
+	defer statusMu.RUnlock()
+
+	st := Status{
+		StartedAt:         startedAt,
+		Webhook:           webhookMode,
+		Polling:           polling,
+		CheckPeriod:       cycles.period.String(),
+		NextCheck:         nextCheck,
+		Cycles:            cycles.total,
+		FailedCycles:      cycles.failed,
+		LastCycleStart:    cycles.start,
+		LastCycleDuration: cycles.duration.Round(time.Millisecond).String(),
+		LastSuccess:       cycles.success,
+	}
+	if cycles.err != nil {
+		st.LastError = cycles.err.Error()
+	}
+	if queue != nil {
+		st.SendQueue = queue.lengths()
+	}
+	return st
+}
+
+// CheckPoller fails if updates are not received from Telegram
+func CheckPoller(context.Context) error {
+	statusMu.RLock()
+	defer statusMu.RUnlock()
+	if !polling {
+		return errors.New("the poller is not running")
+	}
+	return nil
+}
+
+// CheckUpdates fails if there hasn't been a successful update check for two check periods
+func CheckUpdates(context.Context) error {
+	statusMu.RLock()
+	defer statusMu.RUnlock()
+
+	last := cycles.success
+	if last.IsZero() {
+		last = startedAt
+	}
+	if lag := time.Since(last); lag > 2*cycles.period+cycleLagGrace {
+		return fmt.Errorf("no successful update check for %s", lag.Round(time.Second))
+	}
+	return nil
+}
+
+// CheckTelegram fails if Telegram is unreachable or the webhook is not set, the result is cached for a while.
+// A single probe runs in the background at a time, so a slow Telegram doesn't block checks past their context.
+func CheckTelegram(ctx context.Context) error {
+	telegramMu.Lock()
+	if time.Since(telegramProbe) < telegramProbeTTL {
+		defer telegramMu.Unlock()
+		return telegramErr
+	}
+
+	done := telegramDone
+	if done == nil {
+		done = make(chan struct{})
+		telegramDone = done
+		go func() {
+			err := probeTelegram()
+
+			telegramMu.Lock()
+			telegramErr, telegramProbe, telegramDone = err, time.Now(), nil
+			telegramMu.Unlock()
+			close(done)
+		}()
+	}
+	telegramMu.Unlock()
+
+	select {
+	case <-done:
+		telegramMu.Lock()
+		defer telegramMu.Unlock()
+		return telegramErr
+	case <-ctx.Done():
+		return fmt.Errorf("telegram is not responding: %w", ctx.Err())
+	}
+}
+
+func probeTelegram() error {
+	if bot == nil {
+		return errors.New("the bot is not started")
+	}
+
+	statusMu.RLock()
+	isWebhook := webhookMode
+	statusMu.RUnlock()
+
+	if !isWebhook {
+		_, err := bot.Raw("getMe", nil)
+		return err
+	}
+
+	info, err := bot.Webhook()
+	if err != nil {
+		return err
+	} else if info.Listen == "" {
+		return errors.New("the webhook is not set")
+	}
+	return nil
+}
@@ -2,112 +2,618 @@ package bot
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"time"
 
 	"github.com/neymee/mdexbot/internal/bot/lang"
 	"github.com/neymee/mdexbot/internal/config"
 	"github.com/neymee/mdexbot/internal/domain"
+	werrors "github.com/neymee/mdexbot/internal/errors"
 	"github.com/neymee/mdexbot/internal/log"
 	"github.com/neymee/mdexbot/internal/metrics"
 	"github.com/neymee/mdexbot/internal/service"
+	"github.com/neymee/mdexbot/internal/service/outbox"
 	"gopkg.in/telebot.v3"
 )
 
 func runUpdatesChecker(ctx context.Context, cfg *config.Config, s *service.Services) {
-	checkUpdates(ctx, s)
-
 	checkPeriod := time.Duration(cfg.Bot.CheckPeriodMin) * time.Minute
+	setCheckPeriod(checkPeriod, time.Now())
+	checkUpdates(ctx, cfg, s)
+
 	t := time.NewTicker(checkPeriod)
+	setCheckPeriod(checkPeriod, time.Now().Add(checkPeriod))
 	for {
 		select {
 		case <-t.C:
-			checkUpdates(ctx, s)
+			checkUpdates(ctx, cfg, s)
+		case <-checkNow:
+			checkUpdates(ctx, cfg, s)
+			t.Reset(checkPeriod)
+		case checkPeriod = <-checkPeriodChanged:
+			t.Reset(checkPeriod)
 		case <-ctx.Done():
 			return
 		}
+		setCheckPeriod(checkPeriod, time.Now().Add(checkPeriod))
 	}
 }
 
-func checkUpdates(ctx context.Context, s *service.Services) {
+func checkUpdates(ctx context.Context, cfg *config.Config, s *service.Services) {
 	const method = "bot.checkUpdates"
 
+	// cycleErr is the first error failing the cycle
+	var cycleErr error
+	defer func(start time.Time) {
+		recordCycle(start, time.Since(start), cycleErr)
+	}(time.Now())
+
 	defer func() {
 		if err := recover(); err != nil {
-			metrics.ErrorsCounter(fmt.Errorf("%+v", err)).Inc()
+			cycleErr = fmt.Errorf("%w: %+v", werrors.PanicError, err)
+			metrics.ErrorsCounter(cycleErr).Inc()
 			log.Log(ctx, method).Error().Interface("panic", err).Msg("Panic recovered")
 		}
 	}()
 
-	updates, err := s.Subscription.Updates(ctx)
+	purgeConversations(ctx, s)
+
+	_, err := s.Subscription.QueueUpdates(ctx)
 	if err != nil {
+		// deliveries queued earlier are sent anyway
+		cycleErr = err
 		metrics.ErrorsCounter(err).Inc()
 		log.Error(ctx, method, err).Msg("Fetching updates error")
+	}
+
+	deliverUpdates(ctx, cfg, s)
+	updateGauges(ctx, s)
+
+	statusUpdates, err := s.Subscription.StatusUpdates(ctx)
+	if err != nil {
+		if cycleErr == nil {
+			cycleErr = err
+		}
+		metrics.ErrorsCounter(err).Inc()
+		log.Error(ctx, method, err).Msg("Fetching status updates error")
 		return
 	}
 
-	for _, upd := range updates {
-		text, keyboard := buildUpdateMessage(upd.MangaTitle, upd.Language, upd.NewChapters)
+	var notifications []notification
+	for _, upd := range statusUpdates {
+		for _, rec := range upd.Recipients {
+			userSettings := recipientSettings(ctx, s, rec)
+			text, keyboard := buildStatusUpdateMessage(recipientLocale(userSettings), upd)
+			sound := withSound(userSettings.Sound)
+			notifications = append(notifications, notification{
+				rec:    rec,
+				result: sendBulk(ctx, rec, text, withKeyboard(keyboard), sound),
+			})
+		}
+	}
+	handleNotifyResults(ctx, s, notifications)
+
+	langUpdates, err := s.Subscription.LanguageUpdates(ctx)
+	if err != nil {
+		if cycleErr == nil {
+			cycleErr = err
+		}
+		metrics.ErrorsCounter(err).Inc()
+		log.Error(ctx, method, err).Msg("Fetching language updates error")
+		return
+	}
 
+	notifications = nil
+	for _, upd := range langUpdates {
 		for _, rec := range upd.Recipients {
-			err := send(ctx, rec, text, withKeyboard(keyboard))
+			userSettings := recipientSettings(ctx, s, rec)
+			l := recipientLocale(userSettings)
+			sound := withSound(userSettings.Sound)
+			var result <-chan sendResult
+			if upd.MangaRemoved {
+				text := l.WaitLangMangaRemoved(upd.MangaTitle, lang.GetFlagOrLang(upd.Language))
+				result = sendBulk(ctx, rec, text, sound)
+			} else {
+				text := l.WaitLangAppeared(upd.MangaTitle, lang.GetFlagOrLang(upd.Language))
+				keyboard := subscribeButton(l, upd.MangaID, upd.Language)
+				result = sendBulk(ctx, rec, text, withKeyboard(keyboard), sound)
+			}
+			rec, watch := rec, upd.LanguageWatch
+			notifications = append(notifications, notification{
+				rec:    rec,
+				result: result,
+				// the watch is kept if sending fails to notify the recipient on the next check
+				sent: func() error {
+					return s.Subscription.UnwatchLanguage(ctx, rec, watch.MangaID, watch.Language)
+				},
+			})
+		}
+	}
+	handleNotifyResults(ctx, s, notifications)
+}
+
+// updateGauges sets gauges of recipients, subscriptions, topics and pending deliveries
+func updateGauges(ctx context.Context, s *service.Services) {
+	stats, err := s.Admin.Stats(ctx)
+	if err != nil {
+		metrics.ErrorsCounter(err).Inc()
+		log.Error(ctx, "bot.updateGauges", err).Msg("Fetching stats error")
+		return
+	}
+
+	metrics.Recipients.Set(float64(stats.Recipients))
+	metrics.Subscriptions.Set(float64(stats.Subscriptions))
+	metrics.Topics.Set(float64(stats.Topics))
+	metrics.PendingDeliveries.Set(float64(stats.Pending))
+}
+
+// notification is a message queued to the recipient
+type notification struct {
+	rec    domain.Recipient
+	result <-chan sendResult
+	// sent is called if the notification is sent
+	sent func() error
+}
+
+// handleNotifyResults waits until the notifications are sent and handles errors
+func handleNotifyResults(ctx context.Context, s *service.Services, notifications []notification) {
+	for _, n := range notifications {
+		err := waitResult(ctx, n.result).err
+		if ctx.Err() == nil {
+			metrics.NotificationsCounter(err).Inc()
+		}
+		handleNotifyError(ctx, s, n.rec, err)
+
+		if err == nil && n.sent != nil {
+			if err := n.sent(); err != nil {
+				metrics.ErrorsCounter(err).Inc()
+				log.Error(ctx, "bot.handleNotifyResults", err).
+					Int64("recipient", n.rec.AsInt64()).
+					Msg("Handling sent notification error")
+			}
+		}
+	}
+}
 
-			if tbErr := new(telebot.Error); errors.As(err, &tbErr) && tbErr.Code == 403 {
-				// user banned the bot, delete all their subscriptions
-				err := s.Subscription.UnsubscribeAll(ctx, rec)
+func waitResult(ctx context.Context, result <-chan sendResult) sendResult {
+	select {
+	case res := <-result:
+		return res
+	case <-ctx.Done():
+		return sendResult{err: ctx.Err()}
+	}
+}
+
+func waitUpdateResult(ctx context.Context, result <-chan updateResult) updateResult {
+	select {
+	case res := <-result:
+		return res
+	case <-ctx.Done():
+		return updateResult{err: ctx.Err()}
+	}
+}
+
+// deliverUpdates drains the outbox. Failed deliveries are retried on the next checks.
+func deliverUpdates(ctx context.Context, cfg *config.Config, s *service.Services) {
+	const method = "bot.deliverUpdates"
+
+	editWindow := time.Duration(cfg.Bot.EditWindowMin) * time.Minute
+
+	// manga id : cover url, the cover is fetched once for all recipients
+	covers := map[string]string{}
+	coverURL := func(mangaID string) string {
+		if !cfg.Bot.CoverArt {
+			return ""
+		}
+		if url, ok := covers[mangaID]; ok {
+			return url
+		}
+
+		manga, err := s.Subscription.CycleManga(ctx, mangaID)
+		if err != nil {
+			// the notification is sent without the cover
+			log.Error(ctx, method, err).
+				Str("manga_id", mangaID).
+				Msg("Fetching cover art error")
+		}
+		covers[mangaID] = manga.CoverURL
+		return manga.CoverURL
+	}
+
+	// settings are fetched once per recipient
+	userSettings := map[domain.Recipient]domain.UserSettings{}
+	settingsOf := func(rec domain.Recipient) domain.UserSettings {
+		if st, ok := userSettings[rec]; ok {
+			return st
+		}
+		userSettings[rec] = recipientSettings(ctx, s, rec)
+		return userSettings[rec]
+	}
+
+	for {
+		deliveries, err := s.Outbox.Pending(ctx)
+		if err != nil {
+			metrics.ErrorsCounter(err).Inc()
+			log.Error(ctx, method, err).Msg("Fetching pending deliveries error")
+			return
+		}
+
+		// deliveries postponed until the digest time are sent in a single message per recipient
+		digests := map[domain.Recipient][]domain.Delivery{}
+		for _, d := range deliveries {
+			if d.Digest {
+				digests[d.Recipient] = append(digests[d.Recipient], d)
+			}
+		}
+		digestResults := map[domain.Recipient]<-chan updateResult{}
+		for rec, group := range digests {
+			digestResults[rec] = sendDigest(ctx, rec, group, settingsOf(rec))
+		}
+
+		// the whole batch is queued at once to not wait for chats paused by the queue
+		results := make([]<-chan updateResult, len(deliveries))
+		// recipient/topic of deliveries in the batch, only the first one may edit the last message
+		queued := map[string]struct{}{}
+		for i, d := range deliveries {
+			if d.Digest {
+				continue
+			}
+
+			var last *domain.NotificationMessage
+			key := fmt.Sprintf("%s/%d", d.Recipient, d.TopicID)
+			if _, ok := queued[key]; !ok && editWindow > 0 {
+				last, err = s.Outbox.LastMessage(ctx, d, editWindow)
 				if err != nil {
+					// a new message is sent
 					metrics.ErrorsCounter(err).Inc()
 					log.Error(ctx, method, err).
-						Int64("recipient", rec.AsInt64()).
-						Msg("UnsubscribeAll error")
+						Uint("delivery_id", d.ID).
+						Msg("Fetching last notification message error")
+				}
+			}
+			queued[key] = struct{}{}
+
+			results[i] = sendUpdate(ctx, d, last, coverURL(d.Update.MangaID), settingsOf(d.Recipient))
+		}
+
+		// every delivery of the digest gets the result of the digest message
+		digestSent := map[domain.Recipient]updateResult{}
+		for i, d := range deliveries {
+			var res updateResult
+			if d.Digest {
+				sent, ok := digestSent[d.Recipient]
+				if !ok {
+					sent = waitUpdateResult(ctx, digestResults[d.Recipient])
+					digestSent[d.Recipient] = sent
 				}
+				res = sent
+			} else {
+				res = waitUpdateResult(ctx, results[i])
+			}
+			if ctx.Err() != nil {
+				// the app is stopping, unsent deliveries stay pending
+				return
+			}
 
-				err = s.Conversation.DeleteConversationContext(ctx, rec)
+			sendErr := res.err
+			if res.message != nil {
+				err = s.Outbox.SetLastMessage(ctx, d, *res.message)
 				if err != nil {
+					// the next update is sent as a new message
 					metrics.ErrorsCounter(err).Inc()
 					log.Error(ctx, method, err).
-						Int64("recipient", rec.AsInt64()).
-						Msg("DeleteConversationContext error")
+						Uint("delivery_id", d.ID).
+						Msg("Saving last notification message error")
+				}
+			}
+
+			metrics.NotificationsCounter(sendErr).Inc()
+			if sendErr == nil {
+				for _, ch := range d.Update.NewChapters {
+					metrics.ObserveNotificationLag(ch.PublishedAt)
 				}
+			}
 
-				log.Log(ctx, method).Warn().
-					Int64("recipient", rec.AsInt64()).
-					Msg("The recipient has banned the bot and theirs subscriptions have been removed")
+			retry := handleNotifyError(ctx, s, d.Recipient, sendErr)
+			if sendErr == nil {
+				err = s.Outbox.Sent(ctx, d)
+			} else {
+				err = s.Outbox.Failed(ctx, d, sendErr, retry)
+			}
 
-			} else if err != nil {
+			if err != nil {
+				// stop to not send the same deliveries again and again
+				metrics.ErrorsCounter(err).Inc()
 				log.Error(ctx, method, err).
-					Int64("recipient", rec.AsInt64()).
-					Msg("Error during sending message")
+					Uint("delivery_id", d.ID).
+					Msg("Saving delivery status error")
+				return
 			}
 		}
+
+		if len(deliveries) < outbox.BatchSize {
+			break
+		}
+	}
+
+	err := s.Outbox.Cleanup(ctx)
+	if err != nil {
+		metrics.ErrorsCounter(err).Inc()
+		log.Error(ctx, method, err).Msg("Outbox cleanup error")
 	}
 }
 
+// buildUpdateMessage returns texts of messages notifying about new chapters.
+// Long chapter lists are split into several messages, the keyboard is attached to the last one.
 func buildUpdateMessage(
+	l *lang.Locale,
 	mangaTitle string,
 	mangaLang string,
 	chapters []domain.Chapter,
-) (text string, keyboard [][]telebot.InlineButton) {
+	unreadCount int,
+	released bool,
+	loc *time.Location,
+) (texts []string, keyboard [][]telebot.InlineButton) {
 	first := chapters[0]
-	if len(chapters) == 1 {
-		text = lang.NewChapterSingle(mangaTitle, lang.GetFlagOrLang(mangaLang), first.Chapter, first.Title, first.Volume)
+
+	var header string
+	var lines []string
+	if len(chapters) == 1 && !released {
+		header = l.NewChapterSingle(mangaTitle, lang.GetFlagOrLang(mangaLang), first.Chapter, first.Title, first.Volume) +
+			l.NewChapterGroups(first.Groups)
 	} else {
-		text = lang.NewChapterMulti(mangaTitle, lang.GetFlagOrLang(mangaLang), len(chapters))
+		if released {
+			header = l.ChapterReleased(mangaTitle, lang.GetFlagOrLang(mangaLang), len(chapters))
+		} else {
+			header = l.NewChapterMulti(mangaTitle, lang.GetFlagOrLang(mangaLang), len(chapters))
+		}
+		for _, ch := range chapters {
+			lines = append(lines, l.NewChapterLine(chapterLink(ch), ch.Chapter, ch.Title, ch.Volume, ch.Groups))
+		}
 	}
 
-	var link string
-	if first.ExternalUrl != "" {
-		link = first.ExternalUrl
-	} else {
-		link = fmt.Sprintf("%s/chapter/%s", MangaDexURL, first.ID)
+	var footer string
+	if !released && first.IsScheduled(time.Now()) {
+		footer += l.NewChapterScheduled(first.PublishedAt, loc)
+	}
+
+	if unreadCount > 0 {
+		footer += l.NewChapterUnread(unreadCount)
+	}
+
+	texts = splitMessage(header, lines, footer, messageLimit)
+
+	// chapters are ordered by publication time, so the last one marks the whole batch
+	last := chapters[len(chapters)-1]
+
+	keyboard = [][]telebot.InlineButton{
+		{
+			{
+				Text: l.BtnRead(),
+				URL:  chapterLink(first),
+			},
+			{
+				Text:   l.BtnMarkRead(),
+				Data:   last.ID,
+				Unique: CmdMarkReadBtn.String(),
+			},
+		},
+	}
+
+	return
+}
+
+// updateResult is the result of sending an update notification
+type updateResult struct {
+	// message is the notification to be edited by the next update, nil if it's split into several messages
+	message *domain.NotificationMessage
+	err     error
+}
+
+// sendUpdate queues the notification about the delivery. If the last message about the topic is given,
+// it's edited to include new chapters. A new message is sent if the last message can't be edited.
+func sendUpdate(
+	ctx context.Context,
+	d domain.Delivery,
+	last *domain.NotificationMessage,
+	coverURL string,
+	userSettings domain.UserSettings,
+) <-chan updateResult {
+	if last == nil || last.Update.Released != d.Update.Released {
+		return sendNewUpdate(ctx, d.Recipient, d.Update, coverURL, userSettings)
+	}
+
+	merged := mergeUpdates(last.Update, d.Update)
+	texts, keyboard := buildUpdateMessage(
+		recipientLocale(userSettings),
+		merged.MangaTitle,
+		merged.Language,
+		merged.NewChapters,
+		merged.Unread[d.Recipient],
+		merged.Released,
+		userSettings.Location(),
+	)
+	if len(texts) > 1 || (last.Photo && textLength(texts[0]) > captionLimit) {
+		// the message can't list all chapters
+		return sendNewUpdate(ctx, d.Recipient, d.Update, coverURL, userSettings)
+	}
+
+	var what interface{} = texts[0]
+	if last.Photo {
+		what = &telebot.Photo{Caption: texts[0]}
+	}
+	edited := editBulk(ctx, d.Recipient, last.MessageID, what, withKeyboard(keyboard))
+
+	result := make(chan updateResult, 1)
+	go func() {
+		res := waitResult(ctx, edited)
+		if res.err != nil {
+			if failure, _ := classifySendError(res.err); failure == failureMessage {
+				// the message has been deleted by the user or is too old to be edited
+				result <- waitUpdateResult(ctx, sendNewUpdate(ctx, d.Recipient, d.Update, coverURL, userSettings))
+				return
+			}
+			result <- updateResult{err: res.err}
+			return
+		}
+
+		msg := *last
+		msg.Update = merged
+		result <- updateResult{message: &msg}
+	}()
+	return result
+}
+
+// sendNewUpdate queues messages of the update, the cover is sent with the first message if it fits the caption.
+// The result channel receives the first sending error.
+func sendNewUpdate(
+	ctx context.Context,
+	to domain.Recipient,
+	upd domain.Update,
+	coverURL string,
+	userSettings domain.UserSettings,
+) <-chan updateResult {
+	texts, keyboard := buildUpdateMessage(
+		recipientLocale(userSettings),
+		upd.MangaTitle,
+		upd.Language,
+		upd.NewChapters,
+		upd.Unread[to],
+		upd.Released,
+		userSettings.Location(),
+	)
+
+	results := []<-chan sendResult{}
+
+	if coverURL != "" {
+		photo := &telebot.Photo{File: telebot.FromURL(coverURL)}
+		if textLength(texts[0]) <= captionLimit {
+			photo.Caption = texts[0]
+			texts = texts[1:]
+		}
+
+		options := []sendOptionFunc{withSound(userSettings.Sound)}
+		if len(texts) == 0 {
+			options = append(options, withKeyboard(keyboard))
+		}
+		results = append(results, sendBulk(ctx, to, photo, options...))
+	}
+
+	for i, text := range texts {
+		options := []sendOptionFunc{withSound(userSettings.Sound)}
+		if i == len(texts)-1 {
+			options = append(options, withKeyboard(keyboard))
+		}
+		results = append(results, sendBulk(ctx, to, text, options...))
+	}
+
+	result := make(chan updateResult, 1)
+	go func() {
+		var res updateResult
+		for _, r := range results {
+			if sent := waitResult(ctx, r); sent.err != nil && res.err == nil {
+				res.err = sent.err
+			} else if sent.err == nil && sent.msg != nil && len(results) == 1 {
+				res.message = &domain.NotificationMessage{
+					MessageID: sent.msg.ID,
+					Photo:     sent.msg.Photo != nil,
+					Update:    upd,
+					SentAt:    time.Now().UTC(),
+				}
+			}
+		}
+		result <- res
+	}()
+	return result
+}
+
+// mergeUpdates adds chapters of the next update to the previous one
+func mergeUpdates(prev domain.Update, next domain.Update) domain.Update {
+	listed := map[string]struct{}{}
+	for _, ch := range prev.NewChapters {
+		listed[ch.ID] = struct{}{}
+	}
+
+	merged := next
+	merged.NewChapters = append([]domain.Chapter{}, prev.NewChapters...)
+	for _, ch := range next.NewChapters {
+		if _, ok := listed[ch.ID]; !ok {
+			merged.NewChapters = append(merged.NewChapters, ch)
+		}
+	}
+	return merged
+}
+
+// sendDigest queues the digest listing updates of the deliveries, updates of the same topic are merged.
+// The result channel receives the first sending error.
+func sendDigest(
+	ctx context.Context,
+	to domain.Recipient,
+	deliveries []domain.Delivery,
+	userSettings domain.UserSettings,
+) <-chan updateResult {
+	l := recipientLocale(userSettings)
+
+	topics := []uint{}
+	updates := map[uint]domain.Update{}
+	for _, d := range deliveries {
+		if prev, ok := updates[d.TopicID]; ok {
+			updates[d.TopicID] = mergeUpdates(prev, d.Update)
+			continue
+		}
+		topics = append(topics, d.TopicID)
+		updates[d.TopicID] = d.Update
+	}
+
+	lines := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		upd := updates[topic]
+		link := fmt.Sprintf("%s/title/%s", MangaDexURL, upd.MangaID)
+		lines = append(lines, l.DigestLine(link, upd.MangaTitle, lang.GetFlagOrLang(upd.Language), len(upd.NewChapters), upd.Released))
+	}
+
+	results := []<-chan sendResult{}
+	for _, text := range splitMessage(l.Digest(len(topics)), lines, "", messageLimit) {
+		results = append(results, sendBulk(ctx, to, text, withSound(userSettings.Sound)))
+	}
+
+	result := make(chan updateResult, 1)
+	go func() {
+		var res updateResult
+		for _, r := range results {
+			if sent := waitResult(ctx, r); sent.err != nil && res.err == nil {
+				res.err = sent.err
+			}
+		}
+		result <- res
+	}()
+	return result
+}
+
+func buildStatusUpdateMessage(l *lang.Locale, upd domain.StatusUpdate) (text string, keyboard [][]telebot.InlineButton) {
+	text = l.StatusUpdateTitle(upd.MangaTitle, lang.GetFlagOrLang(upd.Language))
+
+	if upd.NewStatus != "" {
+		text += l.StatusUpdateStatus(upd.OldStatus, upd.NewStatus)
+	}
+
+	if len(upd.NewLanguages) > 0 {
+		langs := make([]string, 0, len(upd.NewLanguages))
+		for _, l := range upd.NewLanguages {
+			langs = append(langs, lang.GetFlagOrLang(l))
+		}
+		text += l.StatusUpdateLanguages(langs)
+	}
+
+	if upd.FinalChapter {
+		text += l.StatusUpdateFinalChapter()
 	}
 
 	keyboard = [][]telebot.InlineButton{
 		{
 			{
-				Text: "Read",
-				URL:  link,
+				Text: l.BtnOpen(),
+				URL:  fmt.Sprintf("%s/title/%s", MangaDexURL, upd.MangaID),
 			},
 		},
 	}
@@ -0,0 +1,185 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/config"
+	werrors "github.com/neymee/mdexbot/internal/errors"
+	"github.com/neymee/mdexbot/internal/log"
+	"github.com/neymee/mdexbot/internal/metrics"
+	"gopkg.in/telebot.v3"
+)
+
+// webhookRetryDelay is the delay between attempts to set the webhook
+const webhookRetryDelay = 10 * time.Second
+
+// secretTokenHeader contains the secret token in requests from Telegram
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// webhookPoller receives updates from Telegram via the HTTP server shared with metrics.
+// telebot.Webhook can't be used since it doesn't support the secret token.
+type webhookPoller struct {
+	cfg     *config.Config
+	updates chan telebot.Update
+}
+
+func newWebhookPoller(cfg *config.Config) *webhookPoller {
+	return &webhookPoller{
+		cfg:     cfg,
+		updates: make(chan telebot.Update),
+	}
+}
+
+// Path is the path of the public url the handler must be registered on
+func (p *webhookPoller) Path() string {
+	u, err := url.Parse(p.cfg.Bot.Webhook.PublicURL)
+	if err != nil || u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
+
+// Poll sets the webhook and passes updates received by the HTTP handler to the bot
+func (p *webhookPoller) Poll(b *telebot.Bot, dest chan telebot.Update, stop chan struct{}) {
+	const method = "bot.webhookPoller.Poll"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		for {
+			err := p.setWebhook(ctx, b)
+			if err == nil {
+				log.Log(ctx, method).Info().Msg("Webhook is set")
+				return
+			}
+
+			metrics.ErrorsCounter(fmt.Errorf("%w: %w", werrors.TelegramError, err)).Inc()
+			log.Error(ctx, method, err).
+				Dur("retry_after", webhookRetryDelay).
+				Msg("Unable to set webhook")
+
+			select {
+			case <-time.After(webhookRetryDelay):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case upd := <-p.updates:
+			dest <- upd
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (p *webhookPoller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const method = "bot.webhookPoller.ServeHTTP"
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	secret := r.Header.Get(secretTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(p.cfg.Bot.Webhook.SecretToken)) != 1 {
+		log.Log(r.Context(), method).Warn().
+			Str("remote_addr", r.RemoteAddr).
+			Msg("Webhook request with invalid secret token")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var upd telebot.Update
+	err := json.NewDecoder(r.Body).Decode(&upd)
+	if err != nil {
+		log.Error(r.Context(), method, err).Msg("Invalid update")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case p.updates <- upd:
+		w.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+		// Telegram will send the update again
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+// setWebhook calls setWebhook method of Bot API. The certificate is uploaded if it's self-signed.
+func (p *webhookPoller) setWebhook(ctx context.Context, b *telebot.Bot) error {
+	webhook := p.cfg.Bot.Webhook
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	form.WriteField("url", webhook.PublicURL)
+	form.WriteField("secret_token", webhook.SecretToken)
+	form.WriteField("drop_pending_updates", strconv.FormatBool(webhook.DropPending))
+
+	if webhook.SelfSigned {
+		cert, err := os.Open(p.cfg.HTTP.TLSCert)
+		if err != nil {
+			return err
+		}
+		defer cert.Close()
+
+		part, err := form.CreateFormFile("certificate", filepath.Base(p.cfg.HTTP.TLSCert))
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, cert); err != nil {
+			return err
+		}
+	}
+
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.URL+"/bot"+b.Token+"/setWebhook", body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// the url contains the token, it must not get to logs
+		if urlErr := new(url.Error); errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Ok          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return err
+	} else if !result.Ok {
+		return fmt.Errorf("setWebhook: %d %s", resp.StatusCode, result.Description)
+	}
+
+	return nil
+}
@@ -1,59 +1,182 @@
-package config
-
-import (
-	"encoding/json"
-	"os"
-
-	"gopkg.in/natefinch/lumberjack.v2"
-)
-
-type Config struct {
-	Bot botConfig `json:"bot"`
-	DB  dbConfig  `json:"db"`
-	Log logConfig `json:"log"`
-}
-
-type botConfig struct {
-	Token          string `json:"token"`
-	CheckPeriodMin int    `json:"check_period_min"`
-}
-
-type dbConfig struct {
-	Host     string `json:"host"`
-	Port     int    `json:"port"`
-	User     string `json:"user"`
-	Password string `json:"password"`
-	Name     string `json:"name"`
-	SLL      string `json:"sll"`
-}
-
-type logConfig struct {
-	Level      string            `json:"level"`
-	Output     []string          `json:"output"`
-	Lumberjack lumberjack.Logger `json:"lumberjack"`
-}
-
-func Load() (*Config, error) {
-	cfgPath := "./config.json"
-	if p := os.Getenv("CONFIG_PATH"); p != "" {
-		cfgPath = p
-	}
-
-	file, err := os.Open(cfgPath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	var cfg *Config
-	err = json.NewDecoder(file).Decode(&cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if cfg.Bot.CheckPeriodMin < 1 {
-		cfg.Bot.CheckPeriodMin = 15
-	}
-
-	return cfg, nil
-}
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+type Config struct {
+	Bot  botConfig  `json:"bot"`
+	DB   dbConfig   `json:"db"`
+	Log  logConfig  `json:"log"`
+	HTTP httpConfig `json:"http"`
+
+	// path is the config file, it's empty if the config is read from the environment and flags only
+	path string
+}
+
+// Path returns the config file, it's empty if there is no file
+func (cfg *Config) Path() string {
+	return cfg.path
+}
+
+type botConfig struct {
+	Token          string          `json:"token" secret:"true"`
+	CheckPeriodMin int             `json:"check_period_min"`
+	RateLimit      rateLimitConfig `json:"rate_limit"`
+	Webhook        webhookConfig   `json:"webhook"`
+	// CoverArt attaches the manga cover to chapter notifications
+	CoverArt bool `json:"cover_art"`
+	// EditWindowMin is a time the last notification about a manga is edited to include
+	// new chapters instead of sending a new message, 0 disables editing
+	EditWindowMin int `json:"edit_window_min"`
+	// Admins are Telegram ids of users allowed to use the admin console
+	Admins []int64 `json:"admins"`
+	// MaxSubscriptions limits subscriptions of a recipient, 0 means no limit
+	MaxSubscriptions int                    `json:"max_subscriptions"`
+	CommandRateLimit commandRateLimitConfig `json:"command_rate_limit"`
+}
+
+// commandRateLimitConfig limits commands of a chat, extra commands are ignored
+type commandRateLimitConfig struct {
+	// PerMinute is a number of commands a chat is allowed to send per minute on average
+	PerMinute int `json:"per_minute"`
+	// Burst is a number of commands a chat is allowed to send at once
+	Burst int `json:"burst"`
+}
+
+// webhookConfig enables receiving updates via webhook instead of long polling.
+// Telegram sends updates to PublicURL, the HTTP server serves them on its path.
+type webhookConfig struct {
+	// PublicURL is an HTTPS url of the bot's HTTP server, the webhook is disabled if it's empty
+	PublicURL string `json:"public_url"`
+	// SecretToken is sent by Telegram in every request to prove the request is genuine
+	SecretToken string `json:"secret_token" secret:"true"`
+	// SelfSigned uploads the certificate of the HTTP server to Telegram
+	SelfSigned bool `json:"self_signed"`
+	// DropPending drops updates received while the webhook was not set
+	DropPending bool `json:"drop_pending"`
+}
+
+func (w webhookConfig) Enabled() bool {
+	return w.PublicURL != ""
+}
+
+type rateLimitConfig struct {
+	// MessagesPerSec is a max number of messages sent to all chats per second
+	MessagesPerSec int `json:"messages_per_sec"`
+	// ChatIntervalMs is a min interval between messages to the same chat
+	ChatIntervalMs int `json:"chat_interval_ms"`
+	// MaxRetries is a number of attempts to resend a message after a flood error
+	MaxRetries int `json:"max_retries"`
+}
+
+type dbConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password" secret:"true"`
+	Name     string `json:"name"`
+	// SSLMode is a libpq sslmode: disable, allow, prefer, require, verify-ca or verify-full
+	SSLMode string `json:"ssl_mode"`
+}
+
+// httpConfig is the HTTP server serving metrics and the webhook
+type httpConfig struct {
+	Listen string `json:"listen"`
+	// TLSCert and TLSKey are paths to files to serve HTTPS, plain HTTP is served if they are empty
+	TLSCert string `json:"tls_cert"`
+	TLSKey  string `json:"tls_key"`
+}
+
+type logConfig struct {
+	Level      string            `json:"level"`
+	Output     []string          `json:"output"`
+	Lumberjack lumberjack.Logger `json:"lumberjack"`
+}
+
+// Load reads the config file and overrides its fields with environment variables and then with
+// command-line arguments. The config file is optional if its path isn't set explicitly.
+func Load(args []string) (*Config, error) {
+	fl, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+
+	cfgPath, explicit := "./config.json", false
+	if p := os.Getenv("CONFIG_PATH"); p != "" {
+		cfgPath, explicit = p, true
+	}
+	if fl.configPath != "" {
+		cfgPath, explicit = fl.configPath, true
+	}
+
+	cfg := &Config{}
+	err = readFile(cfgPath, cfg)
+	if err == nil {
+		cfg.path = cfgPath
+	} else if explicit || !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	err = applyEnv(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = applyFlags(cfg, fl)
+	if err != nil {
+		return nil, err
+	}
+
+	setDefaults(cfg)
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// setDefaults fills in fields which are not set, invalid values are left to Validate
+func setDefaults(cfg *Config) {
+	if cfg.Bot.CheckPeriodMin == 0 {
+		cfg.Bot.CheckPeriodMin = 15
+	}
+
+	if cfg.Bot.RateLimit.MessagesPerSec == 0 {
+		cfg.Bot.RateLimit.MessagesPerSec = 30
+	}
+
+	if cfg.Bot.RateLimit.ChatIntervalMs == 0 {
+		cfg.Bot.RateLimit.ChatIntervalMs = 1000
+	}
+
+	if cfg.Bot.CommandRateLimit.PerMinute == 0 {
+		cfg.Bot.CommandRateLimit.PerMinute = 30
+	}
+
+	if cfg.Bot.CommandRateLimit.Burst == 0 {
+		cfg.Bot.CommandRateLimit.Burst = 10
+	}
+
+	if cfg.DB.Port == 0 {
+		cfg.DB.Port = 5432
+	}
+
+	if cfg.DB.SSLMode == "" {
+		cfg.DB.SSLMode = "prefer"
+	}
+
+	if cfg.Log.Level == "" {
+		cfg.Log.Level = "error"
+	}
+
+	if cfg.HTTP.Listen == "" {
+		cfg.HTTP.Listen = ":2112"
+	}
+}
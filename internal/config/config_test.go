@@ -0,0 +1,216 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validConfig = `{
+	"bot": {"token": "123:abc"},
+	"db": {"host": "localhost", "user": "bot", "name": "bot"},
+	"log": {"output": ["stdout"]}
+}`
+
+func writeConfig(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_Overrides(t *testing.T) {
+	path := writeConfig(t, "config.json", `{
+		"bot": {"token": "1:file", "check_period_min": 5, "cover_art": true},
+		"db": {"user": "bot", "name": "bot", "port": 5432}
+	}`)
+	secret := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(secret, []byte("from-file\n"), 0o600))
+
+	t.Setenv("CONFIG_PATH", path)
+	t.Setenv("MDEXBOT_BOT_TOKEN", "1:env")
+	t.Setenv("MDEXBOT_BOT_CHECK_PERIOD_MIN", "20")
+	t.Setenv("MDEXBOT_BOT_ADMINS", "1, 2")
+	t.Setenv("MDEXBOT_DB_PASSWORD_FILE", secret)
+	t.Setenv("MDEXBOT_LOG_OUTPUT", "stdout,file")
+	t.Setenv("MDEXBOT_LOG_LUMBERJACK_FILENAME", "bot.log")
+
+	cfg, err := Load([]string{"-bot.check_period_min=30", "-bot.cover_art=false", "-db.host", "db"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "1:env", cfg.Bot.Token)
+	assert.Equal(t, 30, cfg.Bot.CheckPeriodMin)
+	assert.False(t, cfg.Bot.CoverArt)
+	assert.Equal(t, []int64{1, 2}, cfg.Bot.Admins)
+	assert.Equal(t, "from-file", cfg.DB.Password)
+	assert.Equal(t, "db", cfg.DB.Host)
+	assert.Equal(t, 5432, cfg.DB.Port)
+	assert.Equal(t, []string{"stdout", "file"}, cfg.Log.Output)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	path := writeConfig(t, "config.json", validConfig)
+
+	t.Run("both value and file", func(t *testing.T) {
+		t.Setenv("CONFIG_PATH", path)
+		t.Setenv("MDEXBOT_BOT_TOKEN", "env")
+		t.Setenv("MDEXBOT_BOT_TOKEN_FILE", path)
+		_, err := Load(nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid env value", func(t *testing.T) {
+		t.Setenv("CONFIG_PATH", path)
+		t.Setenv("MDEXBOT_DB_PORT", "port")
+		_, err := Load(nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown flag", func(t *testing.T) {
+		_, err := Load([]string{"-config", path, "-bot.tokn=x"})
+		assert.Error(t, err)
+	})
+
+	t.Run("missing explicit file", func(t *testing.T) {
+		_, err := Load([]string{"-config", path + ".missing"})
+		assert.Error(t, err)
+	})
+}
+
+func TestLoad_Formats(t *testing.T) {
+	yml := writeConfig(t, "config.yaml", `
+bot:
+  token: "123:abc"
+  admins: [12345678901]
+db:
+  host: localhost
+  user: bot
+  name: bot
+log:
+  output: [stdout]
+`)
+	tml := writeConfig(t, "config.toml", `
+[bot]
+token = "123:abc"
+admins = [12345678901]
+
+[db]
+host = "localhost"
+user = "bot"
+name = "bot"
+
+[log]
+output = ["stdout"]
+`)
+
+	for _, path := range []string{yml, tml} {
+		cfg, err := Load([]string{"-config", path})
+		require.NoError(t, err, path)
+		assert.Equal(t, "123:abc", cfg.Bot.Token)
+		assert.Equal(t, []int64{12345678901}, cfg.Bot.Admins)
+		assert.Equal(t, "bot", cfg.DB.Name)
+		assert.Equal(t, 15, cfg.Bot.CheckPeriodMin)
+		assert.Equal(t, "prefer", cfg.DB.SSLMode)
+	}
+}
+
+func TestLoad_UnknownFields(t *testing.T) {
+	for name, content := range map[string]string{
+		"config.json": `{"bot": {"tokn": "123:abc"}}`,
+		"config.yaml": "bot:\n  tokn: 123:abc\n",
+		"config.toml": "[bot]\ntokn = \"123:abc\"\n",
+	} {
+		_, err := Load([]string{"-config", writeConfig(t, name, content)})
+		assert.ErrorContains(t, err, `unknown field "tokn"`, name)
+	}
+
+	_, err := Load([]string{"-config", writeConfig(t, "config.json", `{"db": {"sll": "disable"}}`)})
+	assert.ErrorContains(t, err, "renamed to db.ssl_mode")
+}
+
+func TestValidate(t *testing.T) {
+	path := writeConfig(t, "config.json", `{
+		"bot": {"check_period_min": -1, "admins": [0]},
+		"db": {"port": 70000, "ssl_mode": "on"},
+		"log": {"level": "verbose", "output": ["stdout", "syslog"]},
+		"http": {"listen": "2112", "tls_cert": "cert.pem"}
+	}`)
+
+	_, err := Load([]string{"-config", path})
+	verr := &ValidationError{}
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, []string{
+		"bot.token is required",
+		"bot.check_period_min must be positive, got -1",
+		"bot.admins must be Telegram user ids, got 0",
+		"db.host is required",
+		"db.user is required",
+		"db.name is required",
+		"db.port must be 1-65535, got 70000",
+		`db.ssl_mode must be one of disable, allow, prefer, require, verify-ca, verify-full, got "on"`,
+		`log.level must be one of trace, debug, info, warn, error, fatal, panic, no, disabled, got "verbose"`,
+		`log.output must be one of stdout, file, got "syslog"`,
+		`http.listen must be host:port or :port, got "2112"`,
+		"http.tls_cert and http.tls_key must be set together",
+		"http.tls_cert: stat cert.pem: no such file or directory",
+	}, verr.Problems)
+}
+
+func TestValidate_WebhookPath(t *testing.T) {
+	for _, tc := range []struct {
+		url     string
+		problem string
+	}{
+		{"https://example.com/bot", ""},
+		{"https://example.com", "bot.webhook.public_url must have a path, e.g. https://example.com/webhook"},
+		{"https://example.com/", "bot.webhook.public_url must have a path, e.g. https://example.com/webhook"},
+		{"https://example.com/metrics", `bot.webhook.public_url path must not be one of /metrics, /healthz, /readyz, /status, got "/metrics"`},
+		{"https://example.com/healthz/", `bot.webhook.public_url path must not be one of /metrics, /healthz, /readyz, /status, got "/healthz/"`},
+	} {
+		t.Run(tc.url, func(t *testing.T) {
+			path := writeConfig(t, "config.json", `{
+				"bot": {"token": "123:abc", "webhook": {"public_url": "`+tc.url+`", "secret_token": "secret"}},
+				"db": {"host": "localhost", "user": "bot", "name": "bot"},
+				"log": {"output": ["stdout"]}
+			}`)
+
+			_, err := Load([]string{"-config", path})
+			if tc.problem == "" {
+				assert.NoError(t, err)
+				return
+			}
+			verr := &ValidationError{}
+			require.ErrorAs(t, err, &verr)
+			assert.Equal(t, []string{tc.problem}, verr.Problems)
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := &Config{}
+	cfg.Bot.Token = "token"
+	cfg.DB.Password = "pwd"
+	cfg.DB.User = "user"
+
+	r := cfg.Redacted()
+	assert.Equal(t, redacted, r["bot"].(map[string]any)["token"])
+	assert.Equal(t, "", r["bot"].(map[string]any)["webhook"].(map[string]any)["secret_token"])
+	assert.Equal(t, redacted, r["db"].(map[string]any)["password"])
+	assert.Equal(t, "user", r["db"].(map[string]any)["user"])
+}
+
+func TestChanged(t *testing.T) {
+	old := &Config{}
+	old.Bot.Admins = []int64{1}
+	old.Log.Lumberjack.MaxAge = 30
+
+	new := &Config{}
+	new.Bot.Admins = []int64{1, 2}
+	new.Bot.Token = "1:x"
+	new.Log.Lumberjack.MaxAge = 30
+
+	assert.Equal(t, []string{"bot.token", "bot.admins"}, Changed(old, new))
+	assert.Empty(t, Changed(new, new))
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// readFile decodes the config file, its format is chosen by the extension: .json, .yaml, .yml or .toml.
+// Keys not matching any field are rejected.
+func readFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// YAML and TOML are converted to JSON to decode every format by json tags the same strict way
+	var tree map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json", "":
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		_, err = toml.Decode(string(data), &tree)
+	default:
+		return fmt.Errorf("%s: unsupported config format %s, use .json, .yaml or .toml", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if tree != nil {
+		data, err = json.Marshal(tree)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w%s", path, err, renamedHint(err))
+	}
+	return nil
+}
+
+// renamed are keys which were renamed, old keys are reported with a hint instead of just being unknown
+var renamed = map[string]string{
+	"sll": "db.ssl_mode",
+}
+
+func renamedHint(err error) string {
+	for old, key := range renamed {
+		if strings.Contains(err.Error(), fmt.Sprintf("unknown field %q", old)) {
+			return fmt.Sprintf(" (renamed to %s)", key)
+		}
+	}
+	return ""
+}
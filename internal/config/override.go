@@ -0,0 +1,233 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts names of environment variables overriding config fields,
+// e.g. bot.token is overridden by MDEXBOT_BOT_TOKEN
+const EnvPrefix = "MDEXBOT_"
+
+// fileSuffix ends names of environment variables with a path to a file to read the value from,
+// e.g. MDEXBOT_BOT_TOKEN_FILE=/run/secrets/token
+const fileSuffix = "_FILE"
+
+const redacted = "[redacted]"
+
+// field is a config field addressed by the path of its json keys, e.g. bot.rate_limit.max_retries
+type field struct {
+	path  string
+	value reflect.Value
+	// secret fields are redacted when the config is printed
+	secret bool
+}
+
+func (f field) env() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(f.path, ".", "_"))
+}
+
+// fields lists config fields which can be overridden, structs are walked recursively
+func fields(v reflect.Value, prefix string) []field {
+	var res []field
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if !sf.IsExported() || name == "" || name == "-" {
+			continue
+		}
+
+		path := prefix + name
+		if sf.Type.Kind() == reflect.Struct {
+			res = append(res, fields(v.Field(i), path+".")...)
+			continue
+		}
+		res = append(res, field{path: path, value: v.Field(i), secret: sf.Tag.Get("secret") == "true"})
+	}
+	return res
+}
+
+func configFields(cfg *Config) []field {
+	return fields(reflect.ValueOf(cfg).Elem(), "")
+}
+
+// set parses s into the field, lists are comma separated
+func (f field) set(s string) error {
+	v, err := parseValue(f.value.Type(), s)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.path, err)
+	}
+	f.value.Set(v)
+	return nil
+}
+
+func parseValue(t reflect.Type, s string) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return v, err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		for _, item := range strings.Split(s, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			elem, err := parseValue(t.Elem(), item)
+			if err != nil {
+				return v, err
+			}
+			v = reflect.Append(v, elem)
+		}
+	default:
+		return v, fmt.Errorf("unsupported type %s", t)
+	}
+	return v, nil
+}
+
+// applyEnv overrides config fields with environment variables and files they point to
+func applyEnv(cfg *Config) error {
+	for _, f := range configFields(cfg) {
+		val, ok := os.LookupEnv(f.env())
+		path, fromFile := os.LookupEnv(f.env() + fileSuffix)
+		if ok && fromFile {
+			return fmt.Errorf("both %s and %s are set", f.env(), f.env()+fileSuffix)
+		}
+
+		if fromFile {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.env()+fileSuffix, err)
+			}
+			val, ok = strings.TrimRight(string(b), "\r\n"), true
+		}
+
+		if !ok {
+			continue
+		}
+		err := f.set(val)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flags are command-line arguments, config fields are set by their paths, e.g. -bot.check_period_min=10
+type flags struct {
+	configPath string
+	values     map[string]string
+}
+
+// flagValue remembers a flag, it's applied after the config file is read
+type flagValue struct {
+	f      field
+	values map[string]string
+}
+
+func (v flagValue) String() string {
+	return ""
+}
+
+func (v flagValue) Set(s string) error {
+	_, err := parseValue(v.f.value.Type(), s)
+	if err != nil {
+		return err
+	}
+	v.values[v.f.path] = s
+	return nil
+}
+
+func (v flagValue) IsBoolFlag() bool {
+	return v.f.value.Kind() == reflect.Bool
+}
+
+func parseFlags(args []string) (flags, error) {
+	res := flags{values: map[string]string{}}
+
+	fs := flag.NewFlagSet("mdexbot", flag.ContinueOnError)
+	fs.StringVar(&res.configPath, "config", "", "path to the config file, overrides CONFIG_PATH")
+	for _, f := range configFields(&Config{}) {
+		fs.Var(flagValue{f: f, values: res.values}, f.path, "overrides "+f.env())
+	}
+
+	// the error is returned to the caller, usage is printed only when it's asked for
+	fs.SetOutput(io.Discard)
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		fs.SetOutput(os.Stderr)
+		fs.PrintDefaults()
+	}
+	if err != nil {
+		return res, err
+	} else if fs.NArg() > 0 {
+		return res, errors.New("unexpected arguments: " + strings.Join(fs.Args(), " "))
+	}
+	return res, nil
+}
+
+func applyFlags(cfg *Config, fl flags) error {
+	for _, f := range configFields(cfg) {
+		if s, ok := fl.values[f.path]; ok {
+			err := f.set(s)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Changed lists paths of fields which differ in the configs, e.g. bot.rate_limit.max_retries
+func Changed(old *Config, new *Config) []string {
+	oldFields, newFields := configFields(old), configFields(new)
+
+	var res []string
+	for i := range oldFields {
+		if !reflect.DeepEqual(oldFields[i].value.Interface(), newFields[i].value.Interface()) {
+			res = append(res, oldFields[i].path)
+		}
+	}
+	return res
+}
+
+// Redacted returns the config as a tree of its json keys with secrets replaced, it's safe to log
+func (cfg *Config) Redacted() map[string]any {
+	res := map[string]any{}
+	for _, f := range configFields(cfg) {
+		node := res
+		keys := strings.Split(f.path, ".")
+		for _, k := range keys[:len(keys)-1] {
+			child, ok := node[k].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				node[k] = child
+			}
+			node = child
+		}
+
+		var val any = f.value.Interface()
+		if f.secret && !f.value.IsZero() {
+			val = redacted
+		}
+		node[keys[len(keys)-1]] = val
+	}
+	return res
+}
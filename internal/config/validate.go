@@ -0,0 +1,189 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ValidationError lists every problem found in the config
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+func (e *ValidationError) add(format string, args ...any) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+var (
+	botTokenRx    = regexp.MustCompile(`^\d+:[A-Za-z0-9_-]+$`)
+	secretTokenRx = regexp.MustCompile("^[A-Za-z0-9_-]{1,256}$")
+
+	sslModes   = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+	logLevels  = []string{"trace", "debug", "info", "warn", "error", "fatal", "panic", "no", "disabled"}
+	logOutputs = []string{"stdout", "file"}
+
+	// reservedPaths are served on the HTTP server next to the webhook
+	reservedPaths = []string{"/metrics", "/healthz", "/readyz", "/status"}
+)
+
+type intField struct {
+	key   string
+	value int
+}
+
+type stringField struct {
+	key   string
+	value string
+}
+
+// Validate checks every section of the config, it returns *ValidationError listing all problems
+func (cfg *Config) Validate() error {
+	e := &ValidationError{}
+	validateBot(cfg, e)
+	validateWebhook(cfg, e)
+	validateDB(cfg, e)
+	validateLog(cfg, e)
+	validateHTTP(cfg, e)
+
+	if len(e.Problems) > 0 {
+		return e
+	}
+	return nil
+}
+
+func validateBot(cfg *Config, e *ValidationError) {
+	bot := cfg.Bot
+	if bot.Token == "" {
+		e.add("bot.token is required")
+	} else if !botTokenRx.MatchString(bot.Token) {
+		e.add("bot.token must look like 123456:ABC-DEF, as given by BotFather")
+	}
+
+	for _, f := range []intField{
+		{"bot.check_period_min", bot.CheckPeriodMin},
+		{"bot.rate_limit.messages_per_sec", bot.RateLimit.MessagesPerSec},
+		{"bot.rate_limit.chat_interval_ms", bot.RateLimit.ChatIntervalMs},
+		{"bot.command_rate_limit.per_minute", bot.CommandRateLimit.PerMinute},
+		{"bot.command_rate_limit.burst", bot.CommandRateLimit.Burst},
+	} {
+		if f.value < 1 {
+			e.add("%s must be positive, got %d", f.key, f.value)
+		}
+	}
+
+	for _, f := range []intField{
+		{"bot.rate_limit.max_retries", bot.RateLimit.MaxRetries},
+		{"bot.edit_window_min", bot.EditWindowMin},
+		{"bot.max_subscriptions", bot.MaxSubscriptions},
+	} {
+		if f.value < 0 {
+			e.add("%s must not be negative, got %d", f.key, f.value)
+		}
+	}
+
+	for _, id := range bot.Admins {
+		if id < 1 {
+			e.add("bot.admins must be Telegram user ids, got %d", id)
+		}
+	}
+}
+
+func validateWebhook(cfg *Config, e *ValidationError) {
+	webhook := cfg.Bot.Webhook
+	if !webhook.Enabled() {
+		return
+	}
+
+	u, err := url.Parse(webhook.PublicURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		e.add("bot.webhook.public_url must be a valid https url")
+	} else if p := path.Clean("/" + u.Path); p == "/" {
+		// the root path would catch every unknown route of the server
+		e.add("bot.webhook.public_url must have a path, e.g. https://%s/webhook", u.Host)
+	} else if contains(reservedPaths, p) {
+		e.add("bot.webhook.public_url path must not be one of %s, got %q", strings.Join(reservedPaths, ", "), u.Path)
+	}
+
+	if !secretTokenRx.MatchString(webhook.SecretToken) {
+		e.add("bot.webhook.secret_token must be 1-256 characters A-Z, a-z, 0-9, _ and -")
+	}
+
+	if webhook.SelfSigned && (cfg.HTTP.TLSCert == "" || cfg.HTTP.TLSKey == "") {
+		e.add("bot.webhook.self_signed requires http.tls_cert and http.tls_key")
+	}
+}
+
+func validateDB(cfg *Config, e *ValidationError) {
+	db := cfg.DB
+	for _, f := range []stringField{{"db.host", db.Host}, {"db.user", db.User}, {"db.name", db.Name}} {
+		if f.value == "" {
+			e.add("%s is required", f.key)
+		}
+	}
+
+	if db.Port < 1 || db.Port > 65535 {
+		e.add("db.port must be 1-65535, got %d", db.Port)
+	}
+
+	if !contains(sslModes, db.SSLMode) {
+		e.add("db.ssl_mode must be one of %s, got %q", strings.Join(sslModes, ", "), db.SSLMode)
+	}
+}
+
+func validateLog(cfg *Config, e *ValidationError) {
+	lg := &cfg.Log
+	if !contains(logLevels, lg.Level) {
+		e.add("log.level must be one of %s, got %q", strings.Join(logLevels, ", "), lg.Level)
+	}
+
+	if len(lg.Output) == 0 {
+		e.add("log.output must list at least one of %s", strings.Join(logOutputs, ", "))
+	}
+	for _, o := range lg.Output {
+		if !contains(logOutputs, o) {
+			e.add("log.output must be one of %s, got %q", strings.Join(logOutputs, ", "), o)
+		}
+	}
+
+	if contains(lg.Output, "file") && lg.Lumberjack.Filename == "" {
+		e.add("log.lumberjack.filename is required for the file output")
+	}
+}
+
+func validateHTTP(cfg *Config, e *ValidationError) {
+	h := cfg.HTTP
+	_, port, err := net.SplitHostPort(h.Listen)
+	if err != nil || port == "" {
+		e.add("http.listen must be host:port or :port, got %q", h.Listen)
+	}
+
+	if (h.TLSCert == "") != (h.TLSKey == "") {
+		e.add("http.tls_cert and http.tls_key must be set together")
+	}
+	for _, f := range []stringField{{"http.tls_cert", h.TLSCert}, {"http.tls_key", h.TLSKey}} {
+		if f.value == "" {
+			continue
+		}
+		if _, err := os.Stat(f.value); err != nil {
+			e.add("%s: %v", f.key, err)
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
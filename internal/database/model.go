@@ -8,7 +8,25 @@ import (
 
 type ConversationContext struct {
 	Recipient string `gorm:"primarykey"`
-	Command   string
+	// Command is a domain.ConversationState
+	Command string
+	// Payload is a JSON encoded data of the conversation
+	Payload   string
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// ManagedChat is a channel managed by the recipient from a private chat
+type ManagedChat struct {
+	Recipient string `gorm:"primarykey"`
+	Chat      string `gorm:"not null"`
+	Title     string
+	CreatedAt time.Time
+}
+
+// BlockedChat is a chat the bot ignores
+type BlockedChat struct {
+	Recipient string `gorm:"primarykey"`
 	CreatedAt time.Time
 }
 
@@ -25,6 +43,13 @@ type TopicSubscription struct {
 	gorm.Model
 	TopicID   uint   `gorm:"uniqueIndex:idx_topic_subscription_topic_id_recipient,where:deleted_at IS NULL"`
 	Recipient string `gorm:"uniqueIndex:idx_topic_subscription_topic_id_recipient,where:deleted_at IS NULL"`
+	// LastReadChapterID references the last NotifiedChapter marked as read, 0 if none
+	LastReadChapterID uint `gorm:"not null;default:0"`
+	// StatusAlerts enables notifications about manga status changes
+	StatusAlerts bool `gorm:"not null;default:false"`
+	// Priority orders languages of the same manga, 0 is the most preferred
+	Priority          int  `gorm:"not null;default:0"`
+	FirstLanguageOnly bool `gorm:"not null;default:false"`
 }
 
 type NotifiedChapter struct {
@@ -32,4 +57,94 @@ type NotifiedChapter struct {
 	TopicID uint   `gorm:"uniqueIndex:idx_notified_chapters_composite,where:deleted_at IS NULL"`
 	Chapter string `gorm:"uniqueIndex:idx_notified_chapters_composite,where:deleted_at IS NULL"`
 	Volume  string `gorm:"uniqueIndex:idx_notified_chapters_composite,where:deleted_at IS NULL"`
+	// ChapterID is the MangaDex chapter id
+	ChapterID     string `gorm:"index"`
+	Title         string
+	ExternalUrl   string
+	ContentRating string
+	PublishAt     time.Time
+	// Released is false for chapters notified before their publication time
+	Released bool `gorm:"not null;default:true"`
+}
+
+const (
+	DeliveryStatusPending = "pending"
+	DeliveryStatusSent    = "sent"
+	DeliveryStatusFailed  = "failed"
+)
+
+// Delivery is an outbox record of a notification to a single recipient
+type Delivery struct {
+	gorm.Model
+	TopicID   uint   `gorm:"not null"`
+	Recipient string `gorm:"not null;index"`
+	// Payload is a JSON encoded domain.Update
+	Payload       string    `gorm:"not null"`
+	Status        string    `gorm:"not null;default:pending;index:idx_deliveries_status_next_attempt_at"`
+	NextAttemptAt time.Time `gorm:"not null;index:idx_deliveries_status_next_attempt_at"`
+	Attempts      int       `gorm:"not null;default:0"`
+	LastError     string
+	SentAt        *time.Time
+	// Digest deliveries are sent in a single message per recipient
+	Digest bool `gorm:"not null;default:false"`
+}
+
+// NotificationMessage is the last message sent to the recipient about updates of the topic
+type NotificationMessage struct {
+	Recipient string `gorm:"primarykey"`
+	TopicID   uint   `gorm:"primarykey;autoIncrement:false"`
+	MessageID int    `gorm:"not null"`
+	Photo     bool   `gorm:"not null;default:false"`
+	// Payload is a JSON encoded domain.Update
+	Payload string    `gorm:"not null"`
+	SentAt  time.Time `gorm:"not null;index"`
+}
+
+// RecipientFailure counts permanent failures of sending messages to the recipient
+type RecipientFailure struct {
+	Recipient     string `gorm:"primarykey"`
+	Failures      int    `gorm:"not null;default:0"`
+	LastError     string
+	LastFailureAt time.Time
+}
+
+// TopicSnapshot is a state of manga attributes on the last update check
+type TopicSnapshot struct {
+	gorm.Model
+	TopicID        uint `gorm:"uniqueIndex:idx_topic_snapshot_topic_id,where:deleted_at IS NULL"`
+	Status         string
+	Languages      string // comma separated list
+	LastVolume     string
+	LastChapter    string
+	FinalPublished bool `gorm:"not null;default:false"`
+}
+
+// LanguageWatch is a recipient waiting for manga translation to the language
+type LanguageWatch struct {
+	gorm.Model
+	MangaID   string `gorm:"uniqueIndex:idx_language_watch_composite,where:deleted_at IS NULL"`
+	Lang      string `gorm:"uniqueIndex:idx_language_watch_composite,where:deleted_at IS NULL"`
+	Recipient string `gorm:"uniqueIndex:idx_language_watch_composite,where:deleted_at IS NULL"`
+	Title     string
+}
+
+// UserSettings are a recipient's preferences, the default settings are not stored
+type UserSettings struct {
+	Recipient            string `gorm:"primarykey"`
+	Language             string
+	TimeZone             string `gorm:"not null;default:UTC"`
+	Sound                bool   `gorm:"not null;default:false"`
+	DigestMode           string `gorm:"not null;default:off"`
+	SubscriptionLanguage string
+	UpdatedAt            time.Time
+}
+
+// ChapterFilter is a recipient's preferences of chapters to be notified about
+type ChapterFilter struct {
+	Recipient        string `gorm:"primarykey"`
+	ContentRatings   string // comma separated list
+	IncludeExternal  bool
+	IncludeScheduled bool
+	NotifyOnRelease  bool
+	UpdatedAt        time.Time
 }
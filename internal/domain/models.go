@@ -1,71 +1,381 @@
-package domain
-
-import (
-	"fmt"
-	"strconv"
-	"time"
-)
-
-type Manga struct {
-	ID                   string
-	Title                map[string]string // lang : title
-	TranslationLanguages []string
-}
-
-func (m *Manga) GetTitle() string {
-	title, ok := m.Title["en"]
-	if !ok {
-		for _, v := range m.Title {
-			title = v
-			break
-		}
-	}
-	return title
-}
-
-type Chapter struct {
-	ID          string
-	Title       string
-	Volume      string
-	Chapter     string
-	ExternalUrl string
-	PublishedAt time.Time
-}
-
-type Recipient string
-
-func RecipientFromInt64(r int64) Recipient {
-	return Recipient(fmt.Sprint(r))
-}
-
-func (r Recipient) Recipient() string {
-	return string(r)
-}
-
-func (r Recipient) AsInt64() int64 {
-	i, err := strconv.ParseInt(string(r), 10, 64)
-	if err != nil {
-		i = -1
-	}
-	return i
-}
-
-type Update struct {
-	MangaTitle  string
-	MangaID     string
-	Language    string
-	Recipients  []Recipient
-	NewChapters []Chapter
-}
-
-type Subscription struct {
-	MangaID    string
-	MangaTitle string
-	Language   string
-}
-
-type SubscriptionExtended struct {
-	Subscription
-	UpdatedAt  time.Time
-	Recipients []Recipient
-}
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Manga struct {
+	ID                   string
+	Title                map[string]string // lang : title
+	TranslationLanguages []string
+	Status               string // ongoing, completed, hiatus, cancelled
+	LastVolume           string // volume of the final chapter, if known
+	LastChapter          string // number of the final chapter, if known
+	CoverURL             string // empty if the manga has no cover
+}
+
+func (m *Manga) GetTitle() string {
+	title, ok := m.Title["en"]
+	if !ok {
+		for _, v := range m.Title {
+			title = v
+			break
+		}
+	}
+	return title
+}
+
+type Chapter struct {
+	ID            string
+	Title         string
+	Volume        string
+	Chapter       string
+	ExternalUrl   string
+	PublishedAt   time.Time
+	ContentRating string   // content rating of the manga
+	Groups        []string // names of scanlation groups
+}
+
+// IsExternal is true for chapters hosted by official publishers
+func (c *Chapter) IsExternal() bool {
+	return c.ExternalUrl != ""
+}
+
+// IsScheduled is true for chapters that will be published in the future
+func (c *Chapter) IsScheduled(now time.Time) bool {
+	return c.PublishedAt.After(now)
+}
+
+type Recipient string
+
+func RecipientFromInt64(r int64) Recipient {
+	return Recipient(fmt.Sprint(r))
+}
+
+// MemberRecipient identifies a user within a group chat. It's used to keep conversation
+// context of every group member apart, messages can't be sent to it.
+func MemberRecipient(chatID int64, userID int64) Recipient {
+	return Recipient(fmt.Sprintf("%d:%d", chatID, userID))
+}
+
+func (r Recipient) Recipient() string {
+	return string(r)
+}
+
+func (r Recipient) AsInt64() int64 {
+	i, err := strconv.ParseInt(string(r), 10, 64)
+	if err != nil {
+		i = -1
+	}
+	return i
+}
+
+type Update struct {
+	MangaTitle  string
+	MangaID     string
+	Language    string
+	Recipients  []Recipient
+	NewChapters []Chapter
+	Unread      map[Recipient]int // recipient : unread chapters count
+	// Released is true if chapters have been notified in advance and are published now
+	Released bool
+}
+
+// Delivery is a notification about an update for a single recipient stored in the outbox
+// until it is sent
+type Delivery struct {
+	ID        uint
+	TopicID   uint
+	Recipient Recipient
+	Update    Update
+	// Attempts is a number of failed attempts to send the notification
+	Attempts int
+	// Digest is true if the notification is sent in a digest along with others
+	Digest bool
+	// NotBefore postpones the notification until the digest time, zero to send it at once
+	NotBefore time.Time
+}
+
+// NotificationMessage is the last message notifying the recipient about updates of a topic.
+// It's edited to include chapters published shortly after.
+type NotificationMessage struct {
+	MessageID int
+	// Photo is true if the message is a cover with the caption
+	Photo bool
+	// Update contains all chapters listed in the message
+	Update Update
+	SentAt time.Time
+}
+
+// NewDelivery creates a delivery of the update to one of its recipients
+func NewDelivery(upd Update, rec Recipient) Delivery {
+	upd.Recipients = []Recipient{rec}
+	upd.Unread = map[Recipient]int{rec: upd.Unread[rec]}
+	return Delivery{Recipient: rec, Update: upd}
+}
+
+// ConversationState is a step of a command waiting for the user's message,
+// steps of the same command are named "<command>:<step>"
+type ConversationState string
+
+// Command returns the command the state belongs to
+func (s ConversationState) Command() string {
+	cmd, _, _ := strings.Cut(string(s), ":")
+	return cmd
+}
+
+// Conversation is a multi-step command in progress
+type Conversation struct {
+	State     ConversationState
+	Payload   json.RawMessage // data collected by the previous steps
+	ExpiresAt time.Time
+}
+
+// Expired reports whether the user took too long to answer and the command should be forgotten
+func (c Conversation) Expired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
+
+// Decode unmarshals the payload into v, an empty payload leaves v unchanged
+func (c Conversation) Decode(v any) error {
+	if len(c.Payload) == 0 {
+		return nil
+	}
+	return json.Unmarshal(c.Payload, v)
+}
+
+// ManagedChat is a channel which subscriptions are managed by a user from a private chat
+type ManagedChat struct {
+	Chat  Recipient
+	Title string
+}
+
+// RecipientFailure counts permanent failures of sending messages to the recipient
+type RecipientFailure struct {
+	Failures      int
+	LastError     string
+	LastFailureAt time.Time
+}
+
+// Subscription is a recipient's subscription to a manga in a single language.
+// A manga may be followed in several languages ordered by priority.
+type Subscription struct {
+	MangaID      string
+	MangaTitle   string
+	Language     string
+	StatusAlerts bool
+	// Priority is a position of the language in the recipient's list, 0 is the most preferred
+	Priority int
+	// FirstLanguageOnly notifies about a chapter only in the first language it appears in
+	FirstLanguageOnly bool
+	// LastChapterAt is the time the last chapter was notified about, zero if there were none
+	LastChapterAt time.Time
+}
+
+const (
+	SortByTitle    = "title"
+	SortByUpdated  = "updated"
+	SortByLanguage = "language"
+)
+
+// SubscriptionSorts are orders subscriptions can be listed in, the first one is the default
+var SubscriptionSorts = []string{SortByTitle, SortByUpdated, SortByLanguage}
+
+// SubscriptionQuery selects a page of the recipient's subscriptions
+type SubscriptionQuery struct {
+	// Sort is one of SubscriptionSorts
+	Sort string
+	// Filter leaves subscriptions which title contains the text or which language is the text
+	Filter string
+	// Page is a zero-based page number
+	Page     int
+	PageSize int
+}
+
+type SubscriptionPage struct {
+	Subscriptions []Subscription
+	// Page is the number of the page returned, it's the last page if the requested one is out of range
+	Page  int
+	Pages int
+	// Total is the number of subscriptions matching the filter
+	Total int
+}
+
+type UnreadSubscription struct {
+	Subscription
+	Unread int
+}
+
+type SubscriptionExtended struct {
+	Subscription
+	UpdatedAt  time.Time
+	Recipients []Recipient
+	// AlertRecipients are recipients that want to be notified about manga status changes
+	AlertRecipients []Recipient
+	// FirstLanguageOnly contains priorities of the language for recipients
+	// that want to be notified about a chapter only in the first language it appears in
+	FirstLanguageOnly map[Recipient]int
+}
+
+// MangaSnapshot is a state of manga attributes saved on the previous update check
+type MangaSnapshot struct {
+	Status               string
+	TranslationLanguages []string
+	LastVolume           string
+	LastChapter          string
+	FinalPublished       bool
+}
+
+func (m *Manga) Snapshot(finalPublished bool) MangaSnapshot {
+	return MangaSnapshot{
+		Status:               m.Status,
+		TranslationLanguages: m.TranslationLanguages,
+		LastVolume:           m.LastVolume,
+		LastChapter:          m.LastChapter,
+		FinalPublished:       finalPublished,
+	}
+}
+
+type StatusUpdate struct {
+	MangaTitle   string
+	MangaID      string
+	Language     string
+	Recipients   []Recipient
+	OldStatus    string
+	NewStatus    string // empty if status hasn't changed
+	NewLanguages []string
+	// FinalChapter is true if the last chapter of a completed manga has been published
+	FinalChapter bool
+}
+
+// LanguageWatch is a request to notify when manga becomes available in the language
+type LanguageWatch struct {
+	MangaID    string
+	MangaTitle string
+	Language   string
+}
+
+type LanguageWatchExtended struct {
+	LanguageWatch
+	Recipients []Recipient
+	// MangaRemoved is true if the manga is not found anymore and the language never appears
+	MangaRemoved bool
+}
+
+var ContentRatings = []string{"safe", "suggestive", "erotica", "pornographic"}
+
+// ChapterFilter is a recipient's preferences of chapters to be notified about
+type ChapterFilter struct {
+	ContentRatings  []string
+	IncludeExternal bool
+	// IncludeScheduled notifies about chapters with publication time in the future
+	// as soon as they appear, otherwise when they are published
+	IncludeScheduled bool
+	// NotifyOnRelease sends a separate notification when a scheduled chapter is published
+	NotifyOnRelease bool
+}
+
+func DefaultChapterFilter() ChapterFilter {
+	return ChapterFilter{
+		ContentRatings:   ContentRatings,
+		IncludeExternal:  true,
+		IncludeScheduled: true,
+		NotifyOnRelease:  false,
+	}
+}
+
+// Allows checks content rating and publisher of the chapter
+func (f *ChapterFilter) Allows(ch Chapter) bool {
+	if ch.IsExternal() && !f.IncludeExternal {
+		return false
+	}
+
+	// rating may be unknown, e.g. for chapters notified before it was stored
+	if ch.ContentRating == "" {
+		return true
+	}
+	return f.AllowsRating(ch.ContentRating)
+}
+
+func (f *ChapterFilter) AllowsRating(rating string) bool {
+	for _, r := range f.ContentRatings {
+		if r == rating {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	DigestOff    = "off"
+	DigestHourly = "hourly"
+	DigestDaily  = "daily"
+
+	// DigestDailyHour is the local hour the daily digest is sent at
+	DigestDailyHour = 9
+)
+
+var DigestModes = []string{DigestOff, DigestHourly, DigestDaily}
+
+// UserSettings are a recipient's preferences applied to all messages
+type UserSettings struct {
+	// Language of the interface, empty for the language of the user's Telegram client
+	Language string
+	// TimeZone is an IANA time zone name
+	TimeZone string
+	// Sound enables notification sound for new chapters
+	Sound bool
+	// DigestMode collects notifications to send them at once, see DigestModes
+	DigestMode string
+	// SubscriptionLanguage is offered first on subscription, empty if not set
+	SubscriptionLanguage string
+}
+
+func DefaultUserSettings() UserSettings {
+	return UserSettings{
+		TimeZone:   "UTC",
+		DigestMode: DigestOff,
+	}
+}
+
+// Location returns the time zone of the recipient, UTC if the time zone is unknown
+func (s *UserSettings) Location() *time.Location {
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// NextDigest returns the time the digest with notifications queued now should be sent at.
+// Returns now if digest mode is off.
+func (s *UserSettings) NextDigest(now time.Time) time.Time {
+	local := now.In(s.Location())
+	switch s.DigestMode {
+	case DigestHourly:
+		next := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, local.Location())
+		return next.Add(time.Hour).UTC()
+	case DigestDaily:
+		next := time.Date(local.Year(), local.Month(), local.Day(), DigestDailyHour, 0, 0, 0, local.Location())
+		if !next.After(local) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next.UTC()
+	default:
+		return now
+	}
+}
+
+// Stats are numbers shown to the bot operators
+type Stats struct {
+	Recipients    int64 // recipients with at least one subscription
+	Subscriptions int64
+	Topics        int64 // followed manga languages
+	Sent          int64 // notifications sent since the time the stats are collected for
+	Failed        int64 // notifications that could not be sent since the same time
+	Pending       int64 // notifications waiting to be sent
+}
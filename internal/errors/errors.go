@@ -9,4 +9,6 @@ var (
 	DatabaseError = errors.New("database error")
 	// TelegramError wraps message sending error
 	TelegramError = errors.New("telegram error")
+	// PanicError wraps a recovered panic
+	PanicError = errors.New("panic")
 )
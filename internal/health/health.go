@@ -0,0 +1,64 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/log"
+)
+
+// checkTimeout limits all checks of a request
+const checkTimeout = 5 * time.Second
+
+// Check reports a problem of a part of the app, nil means the part is fine
+type Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Handle registers /healthz running the live checks, /readyz running the live and the ready checks and
+// /status serving the result of status as JSON. Failed checks respond with 503.
+func Handle(mux *http.ServeMux, live []Check, ready []Check, status func() any) {
+	mux.Handle("/healthz", checksHandler(live))
+	mux.Handle("/readyz", checksHandler(append(append([]Check{}, live...), ready...)))
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(r.Context(), w, http.StatusOK, status())
+	})
+}
+
+func checksHandler(checks []Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		resp := response{Status: "ok", Checks: make(map[string]string, len(checks))}
+		code := http.StatusOK
+		for _, c := range checks {
+			err := c.Check(ctx)
+			if err != nil {
+				resp.Checks[c.Name] = err.Error()
+				resp.Status, code = "fail", http.StatusServiceUnavailable
+				continue
+			}
+			resp.Checks[c.Name] = "ok"
+		}
+
+		writeJSON(r.Context(), w, code, resp)
+	}
+}
+
+func writeJSON(ctx context.Context, w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Error(ctx, "health.writeJSON", err).Send()
+	}
+}
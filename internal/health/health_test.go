@@ -0,0 +1,55 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ok(context.Context) error {
+	return nil
+}
+
+func fail(context.Context) error {
+	return errors.New("unreachable")
+}
+
+func get(t *testing.T, mux *http.ServeMux, path string) (int, map[string]any) {
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var body map[string]any
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	return rec.Code, body
+}
+
+func TestHandle(t *testing.T) {
+	mux := http.NewServeMux()
+	Handle(
+		mux,
+		[]Check{{Name: "poller", Check: ok}},
+		[]Check{{Name: "database", Check: fail}},
+		func() any { return map[string]int{"cycles": 3} },
+	)
+
+	code, body := get(t, mux, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]any{"status": "ok", "checks": map[string]any{"poller": "ok"}}, body)
+
+	code, body = get(t, mux, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, map[string]any{
+		"status": "fail",
+		"checks": map[string]any{"poller": "ok", "database": "unreachable"},
+	}, body)
+
+	code, body = get(t, mux, "/status")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]any{"cycles": float64(3)}, body)
+}
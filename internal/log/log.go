@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"os"
+	"sync"
 
 	"github.com/neymee/mdexbot/internal/config"
 	"github.com/rs/zerolog"
@@ -16,7 +17,16 @@ const (
 	KeyTraceID ctxKey = "trace_id"
 )
 
+var (
+	mu     sync.RWMutex
+	logger = log.Logger
+	// file is the file output, it's closed when the output is reconfigured
+	file io.Closer
+)
+
+// Configure sets the level and the outputs of the log. It may be called again to apply a reloaded config.
 func Configure(cfg *config.Config) {
+	var newFile io.Closer
 	writers := []io.Writer{}
 	for _, o := range cfg.Log.Output {
 		switch o {
@@ -24,6 +34,7 @@ func Configure(cfg *config.Config) {
 			lumberjack := &cfg.Log.Lumberjack
 			writers = append(writers, lumberjack)
 			lumberjack.Rotate()
+			newFile = lumberjack
 		case "stdout":
 			if os.Getenv("PRETTY_LOGGING") == "true" {
 				writers = append(writers, zerolog.ConsoleWriter{Out: os.Stdout})
@@ -32,7 +43,7 @@ func Configure(cfg *config.Config) {
 			}
 		}
 	}
-	log.Logger = log.Output(zerolog.MultiLevelWriter(writers...))
+	l := log.Output(zerolog.MultiLevelWriter(writers...))
 
 	lvl := map[string]zerolog.Level{
 		"trace":    zerolog.TraceLevel,
@@ -46,11 +57,21 @@ func Configure(cfg *config.Config) {
 		"no":       zerolog.NoLevel,
 		"disabled": zerolog.Disabled,
 	}[cfg.Log.Level]
-	log.Logger = log.Level(lvl)
+
+	mu.Lock()
+	oldFile := file
+	logger, file = l.Level(lvl), newFile
+	mu.Unlock()
+
+	if oldFile != nil {
+		oldFile.Close()
+	}
 }
 
 func Log(ctx context.Context, prefix string) *zerolog.Logger {
-	logCtx := log.With().Str("prefix", prefix)
+	mu.RLock()
+	logCtx := logger.With().Str("prefix", prefix)
+	mu.RUnlock()
 
 	traceID, ok := ctx.Value(KeyTraceID).(*int64)
 	if ok && traceID != nil {
@@ -4,7 +4,12 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/neymee/mdexbot/internal/config"
 	werrors "github.com/neymee/mdexbot/internal/errors"
 	"github.com/neymee/mdexbot/internal/log"
 	"github.com/prometheus/client_golang/prometheus"
@@ -22,31 +27,127 @@ var (
 	errorsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "mdexbot",
 		Name:      "errors_count_total",
-		Help:      "The total number of errors",
+		Help:      "The total number of errors by class: " + strings.Join(errorClasses, ", "),
 	}, []string{"error"})
 
-	commandDuration = promauto.NewSummaryVec(prometheus.SummaryOpts{
+	commandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: "mdexbot",
 		Name:      "command_duration_seconds",
 		Help:      "The duration of processing messages from users",
+		Buckets:   prometheus.DefBuckets,
 	}, []string{"command"})
 
-	httpDuration = promauto.NewSummaryVec(prometheus.SummaryOpts{
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: "mdexbot",
 		Name:      "http_req_duration_seconds",
-		Help:      "The duration of http requests",
-	}, []string{"api"})
+		Help:      "The duration of http requests by api and response status, the status is \"error\" if there is no response",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"api", "status"})
+
+	sendQueueLength = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "mdexbot",
+		Name:      "send_queue_length",
+		Help:      "The number of messages waiting to be sent",
+	}, []string{"priority"})
+
+	sendQueueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "mdexbot",
+		Name:      "send_queue_wait_seconds",
+		Help:      "The time messages spend in the send queue",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"priority"})
+
+	SendRetriesCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "mdexbot",
+		Name:      "send_retries_total",
+		Help:      "The total number of messages resent after flood errors",
+	})
+
+	Recipients = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mdexbot",
+		Name:      "recipients",
+		Help:      "The number of chats with subscriptions or settings",
+	})
+
+	Subscriptions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mdexbot",
+		Name:      "subscriptions",
+		Help:      "The number of subscriptions",
+	})
+
+	Topics = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mdexbot",
+		Name:      "topics",
+		Help:      "The number of manga and language pairs checked for updates",
+	})
+
+	PendingDeliveries = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mdexbot",
+		Name:      "pending_deliveries",
+		Help:      "The number of notifications waiting in the outbox",
+	})
+
+	ChaptersCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "mdexbot",
+		Name:      "chapters_detected_total",
+		Help:      "The total number of new chapters found by update checks",
+	})
+
+	notificationsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mdexbot",
+		Name:      "notifications_total",
+		Help:      "The total number of notifications about updates by result: sent or failed",
+	}, []string{"result"})
+
+	notificationLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "mdexbot",
+		Name:      "notification_lag_seconds",
+		Help:      "The time from publishing a chapter to sending the notification about it",
+		Buckets:   []float64{60, 300, 900, 1800, 3600, 7200, 21600, 43200, 86400},
+	})
+
+	cyclesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mdexbot",
+		Name:      "update_cycles_total",
+		Help:      "The total number of update checks by result: ok or failed",
+	}, []string{"result"})
+
+	CycleDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "mdexbot",
+		Name:      "update_cycle_duration_seconds",
+		Help:      "The duration of update checks",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "mdexbot",
+		Name:      "update_cycle_lag_seconds",
+		Help:      "The time since the end of the last successful update check or the start if there is none",
+	}, func() float64 {
+		lastCycleMu.Lock()
+		defer lastCycleMu.Unlock()
+		return time.Since(lastCycle).Seconds()
+	})
+
+	lastCycleMu sync.Mutex
+	lastCycle   = time.Now()
 )
 
-func HandleHTTP(ctx context.Context) {
-	mux := http.NewServeMux()
+// HandleHTTP serves metrics along with other handlers of the mux on http.listen until ctx is done
+func HandleHTTP(ctx context.Context, cfg *config.Config, mux *http.ServeMux) {
 	mux.Handle("/metrics", promhttp.Handler())
 
-	server := http.Server{Addr: ":2112", Handler: mux}
-	defer server.Shutdown(ctx)
+	server := http.Server{Addr: cfg.HTTP.Listen, Handler: mux}
+	defer server.Shutdown(context.Background())
 
 	go func() {
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		var err error
+		if cfg.HTTP.TLSCert != "" && cfg.HTTP.TLSKey != "" {
+			err = server.ListenAndServeTLS(cfg.HTTP.TLSCert, cfg.HTTP.TLSKey)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
 			log.Log(ctx, "metrics.HandleHTTP").Err(err).Send()
 		}
 	}()
@@ -60,27 +161,94 @@ func CommandDuration(cmd string) prometheus.Observer {
 	})
 }
 
-func HTTPDuration(api string) prometheus.Observer {
+func SendQueueLength(priority string) prometheus.Gauge {
+	return sendQueueLength.With(prometheus.Labels{
+		"priority": priority,
+	})
+}
+
+func SendQueueWait(priority string) prometheus.Observer {
+	return sendQueueWait.With(prometheus.Labels{
+		"priority": priority,
+	})
+}
+
+// HTTPDuration observes a request to the api, status is the response status or 0 if there is no response
+func HTTPDuration(api string, status int) prometheus.Observer {
+	statusLabel := "error"
+	if status != 0 {
+		statusLabel = strconv.Itoa(status)
+	}
+
 	return httpDuration.With(prometheus.Labels{
-		"api": api,
+		"api":    api,
+		"status": statusLabel,
 	})
 }
 
 func ErrorsCounter(err error) prometheus.Counter {
-	var errLabel string
+	return errorsCounter.With(prometheus.Labels{
+		"error": ErrorClass(err),
+	})
+}
 
+var errorClasses = []string{"panic", "database", "http", "telegram", "timeout", "canceled", "unknown"}
+
+// ErrorClass returns one of errorClasses, errors are labeled by classes to not make a series per error text
+func ErrorClass(err error) string {
 	switch {
+	case errors.Is(err, werrors.PanicError):
+		return "panic"
 	case errors.Is(err, werrors.DatabaseError):
-		errLabel = "database"
+		return "database"
 	case errors.Is(err, werrors.FailedHTTPReqError):
-		errLabel = "http"
+		return "http"
 	case errors.Is(err, werrors.TelegramError):
-		errLabel = "telegram"
+		return "telegram"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
 	default:
-		errLabel = "unknown"
+		return "unknown"
 	}
+}
 
-	return errorsCounter.With(prometheus.Labels{
-		"error": errLabel,
+// NotificationsCounter counts a notification sent with the error
+func NotificationsCounter(err error) prometheus.Counter {
+	result := "sent"
+	if err != nil {
+		result = "failed"
+	}
+
+	return notificationsCounter.With(prometheus.Labels{
+		"result": result,
 	})
 }
+
+// ObserveNotificationLag observes the lag of a notification about the chapter published at the time,
+// chapters notified in advance are skipped
+func ObserveNotificationLag(publishedAt time.Time) {
+	if lag := time.Since(publishedAt); !publishedAt.IsZero() && lag > 0 {
+		notificationLag.Observe(lag.Seconds())
+	}
+}
+
+// CyclesCounter counts an update check finished with the error
+func CyclesCounter(err error) prometheus.Counter {
+	result := "ok"
+	if err != nil {
+		result = "failed"
+	}
+
+	return cyclesCounter.With(prometheus.Labels{
+		"result": result,
+	})
+}
+
+// SetLastCycle sets the end of the last successful update check the lag is counted from
+func SetLastCycle(end time.Time) {
+	lastCycleMu.Lock()
+	defer lastCycleMu.Unlock()
+	lastCycle = end
+}
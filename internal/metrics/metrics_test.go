@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	werrors "github.com/neymee/mdexbot/internal/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorClass(t *testing.T) {
+	for err, class := range map[error]string{
+		fmt.Errorf("%w: %w", werrors.DatabaseError, errors.New("connection refused")): "database",
+		fmt.Errorf("%w: request failed with status 500", werrors.FailedHTTPReqError):  "http",
+		fmt.Errorf("%w: %w", werrors.TelegramError, errors.New("chat not found")):     "telegram",
+		fmt.Errorf("%w: index out of range", werrors.PanicError):                      "panic",
+		fmt.Errorf("fetching: %w", context.DeadlineExceeded):                          "timeout",
+		context.Canceled:                   "canceled",
+		errors.New("something unexpected"): "unknown",
+	} {
+		assert.Equal(t, class, ErrorClass(err), err.Error())
+		assert.Contains(t, errorClasses, class)
+	}
+}
@@ -1,165 +1,298 @@
-package mdex
-
-import (
-	"context"
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"net/url"
-	"time"
-
-	"github.com/neymee/mdexbot/internal/domain"
-	"github.com/neymee/mdexbot/internal/errors"
-	"github.com/neymee/mdexbot/internal/log"
-	"github.com/neymee/mdexbot/internal/metrics"
-	"github.com/neymee/mdexbot/internal/service/subscription"
-)
-
-const (
-	urlBase         = "https://api.mangadex.org"
-	apiGetManga     = "/manga/%s"
-	apiGetMangaFeed = "/manga/%s/feed"
-)
-
-func urlGetManga(id string) string {
-	return urlBase + fmt.Sprintf(apiGetManga, id)
-}
-
-func urlGetMangaFeed(id string) string {
-	return urlBase + fmt.Sprintf(apiGetMangaFeed, id)
-}
-
-type Repo struct{}
-
-var _ subscription.MangaDexAPI = (*Repo)(nil)
-
-func New() *Repo {
-	return &Repo{}
-}
-
-func (r *Repo) Manga(ctx context.Context, id string) (domain.Manga, error) {
-	defer func(start time.Time) {
-		duration := time.Since(start)
-		metrics.HTTPDuration(fmt.Sprintf(apiGetManga, "*")).Observe(duration.Seconds())
-		log.Log(ctx, "mdex.Manga").Trace().
-			Dur("duration", duration).
-			Str("id", id).
-			Send()
-	}(time.Now())
-
-	var result domain.Manga
-
-	u := urlGetManga(id)
-	resp, err := http.Get(u)
-	if err != nil {
-		return result, fmt.Errorf("%w: %w", errors.FailedHTTPReqError, err)
-	}
-
-	if resp.StatusCode == 404 {
-		return result, subscription.ErrMangaNotFound
-	} else if resp.StatusCode != 200 {
-		err := fmt.Errorf("%w: request failed with status %d", errors.FailedHTTPReqError, resp.StatusCode)
-		return result, err
-	}
-
-	var manga *apiResponse[apiManga]
-	if err := json.NewDecoder(resp.Body).Decode(&manga); err != nil {
-		return result, err
-	}
-
-	if err := manga.Validate(); err != nil {
-		return result, err
-	}
-
-	result.ID = manga.Data.ID
-	result.Title = manga.Data.Attributes.Title
-	result.TranslationLanguages = manga.Data.Attributes.AvailableLanguages
-
-	return result, nil
-}
-
-func (r *Repo) LastChapters(
-	ctx context.Context,
-	mangaID string,
-	lang *string,
-	publishedSince *time.Time,
-) ([]domain.Chapter, error) {
-	defer func(start time.Time) {
-		duration := time.Since(start)
-		metrics.HTTPDuration(fmt.Sprintf(apiGetMangaFeed, "*")).Observe(duration.Seconds())
-		log.Log(ctx, "mdex.LastChapters").Trace().
-			Dur("duration", duration).
-			Str("manga_id", mangaID).
-			Interface("lang", lang).
-			Interface("published_since", publishedSince).
-			Send()
-	}(time.Now())
-
-	u, err := url.Parse(urlGetMangaFeed(mangaID))
-	if err != nil {
-		return nil, err
-	}
-
-	qry := url.Values{
-		"limit":                []string{"20"},
-		"contentRating[]":      []string{"safe", "suggestive", "erotica", "pornographic"},
-		"includeFutureUpdates": []string{"1"},
-		"order[publishAt]":     []string{"asc"},
-	}
-	if lang != nil {
-		qry.Add("translatedLanguage[]", *lang)
-	}
-	if publishedSince != nil && (*publishedSince != time.Time{}) {
-		qry.Add("publishAtSince", publishedSince.UTC().Format("2006-01-02T15:04:05"))
-	}
-	u.RawQuery = qry.Encode()
-
-	resp, err := http.Get(u.String())
-	if err != nil {
-		return nil, fmt.Errorf("%w: %w", errors.FailedHTTPReqError, err)
-	}
-
-	if resp.StatusCode == 404 {
-		return nil, subscription.ErrMangaNotFound
-	} else if resp.StatusCode != 200 {
-		err := fmt.Errorf("%w: request failed with status %d", errors.FailedHTTPReqError, resp.StatusCode)
-		return nil, err
-	}
-
-	var feeds *apiResponse[[]apiMangaFeedItem]
-
-	if err := json.NewDecoder(resp.Body).Decode(&feeds); err != nil {
-		return nil, err
-	}
-
-	if err := feeds.Validate(); err != nil {
-		return nil, err
-	}
-
-	chapters := []apiMangaFeedItem{}
-	for _, f := range *feeds.Data {
-		if f.Type == "chapter" {
-			chapters = append(chapters, f)
-		}
-	}
-
-	if len(chapters) == 0 {
-		// TODO: and total > limit + offset -> request the rest?
-		return nil, nil
-	}
-
-	result := make([]domain.Chapter, 0, len(chapters))
-	for _, ch := range chapters {
-		r := domain.Chapter{
-			ID:          ch.ID,
-			Title:       ch.Attributes.Title,
-			Volume:      ch.Attributes.Volume,
-			Chapter:     ch.Attributes.Chapter,
-			ExternalUrl: ch.Attributes.ExternalUrl,
-			PublishedAt: ch.Attributes.PublishedAt,
-		}
-		result = append(result, r)
-	}
-
-	return result, nil
-}
+package mdex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/domain"
+	"github.com/neymee/mdexbot/internal/errors"
+	"github.com/neymee/mdexbot/internal/log"
+	"github.com/neymee/mdexbot/internal/metrics"
+	"github.com/neymee/mdexbot/internal/service/subscription"
+)
+
+const (
+	urlBase         = "https://api.mangadex.org"
+	urlCovers       = "https://uploads.mangadex.org/covers"
+	apiGetManga     = "/manga/%s"
+	apiGetMangaFeed = "/manga/%s/feed"
+	apiGetChapters  = "/chapter"
+)
+
+func urlGetManga(id string) string {
+	return urlBase + fmt.Sprintf(apiGetManga, id)
+}
+
+func urlGetMangaFeed(id string) string {
+	return urlBase + fmt.Sprintf(apiGetMangaFeed, id)
+}
+
+func urlGetChapters() string {
+	return urlBase + apiGetChapters
+}
+
+type Repo struct{}
+
+var _ subscription.MangaDexAPI = (*Repo)(nil)
+
+func New() *Repo {
+	return &Repo{}
+}
+
+func (r *Repo) Manga(ctx context.Context, id string) (domain.Manga, error) {
+	// status is the response status, 0 until the response is received
+	var status int
+	defer func(start time.Time) {
+		duration := time.Since(start)
+		metrics.HTTPDuration(fmt.Sprintf(apiGetManga, "*"), status).Observe(duration.Seconds())
+		log.Log(ctx, "mdex.Manga").Trace().
+			Dur("duration", duration).
+			Str("id", id).
+			Send()
+	}(time.Now())
+
+	var result domain.Manga
+
+	u := urlGetManga(id) + "?" + url.Values{"includes[]": []string{"cover_art"}}.Encode()
+	resp, err := http.Get(u)
+	if err != nil {
+		return result, fmt.Errorf("%w: %w", errors.FailedHTTPReqError, err)
+	}
+	status = resp.StatusCode
+
+	if resp.StatusCode == 404 {
+		return result, subscription.ErrMangaNotFound
+	} else if resp.StatusCode != 200 {
+		err := fmt.Errorf("%w: request failed with status %d", errors.FailedHTTPReqError, resp.StatusCode)
+		return result, err
+	}
+
+	var manga *apiResponse[apiManga]
+	if err := json.NewDecoder(resp.Body).Decode(&manga); err != nil {
+		return result, err
+	}
+
+	if err := manga.Validate(); err != nil {
+		return result, err
+	}
+
+	result.ID = manga.Data.ID
+	result.Title = manga.Data.Attributes.Title
+	result.TranslationLanguages = manga.Data.Attributes.AvailableLanguages
+	result.Status = manga.Data.Attributes.Status
+	result.LastVolume = manga.Data.Attributes.LastVolume
+	result.LastChapter = manga.Data.Attributes.LastChapter
+	result.CoverURL = mangaCoverURL(manga.Data.ID, manga.Data.Relationships)
+
+	return result, nil
+}
+
+func (r *Repo) LastChapters(
+	ctx context.Context,
+	mangaID string,
+	lang *string,
+	publishedSince *time.Time,
+) ([]domain.Chapter, error) {
+	// status is the response status, 0 until the response is received
+	var status int
+	defer func(start time.Time) {
+		duration := time.Since(start)
+		metrics.HTTPDuration(fmt.Sprintf(apiGetMangaFeed, "*"), status).Observe(duration.Seconds())
+		log.Log(ctx, "mdex.LastChapters").Trace().
+			Dur("duration", duration).
+			Str("manga_id", mangaID).
+			Interface("lang", lang).
+			Interface("published_since", publishedSince).
+			Send()
+	}(time.Now())
+
+	u, err := url.Parse(urlGetMangaFeed(mangaID))
+	if err != nil {
+		return nil, err
+	}
+
+	qry := url.Values{
+		"limit":                []string{"20"},
+		"contentRating[]":      []string{"safe", "suggestive", "erotica", "pornographic"},
+		"includeFutureUpdates": []string{"1"},
+		"order[publishAt]":     []string{"asc"},
+		"includes[]":           []string{"manga", "scanlation_group"},
+	}
+	if lang != nil {
+		qry.Add("translatedLanguage[]", *lang)
+	}
+	if publishedSince != nil && (*publishedSince != time.Time{}) {
+		qry.Add("publishAtSince", publishedSince.UTC().Format("2006-01-02T15:04:05"))
+	}
+	u.RawQuery = qry.Encode()
+
+	resp, err := http.Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errors.FailedHTTPReqError, err)
+	}
+	status = resp.StatusCode
+
+	if resp.StatusCode == 404 {
+		return nil, subscription.ErrMangaNotFound
+	} else if resp.StatusCode != 200 {
+		err := fmt.Errorf("%w: request failed with status %d", errors.FailedHTTPReqError, resp.StatusCode)
+		return nil, err
+	}
+
+	var feeds *apiResponse[[]apiMangaFeedItem]
+
+	if err := json.NewDecoder(resp.Body).Decode(&feeds); err != nil {
+		return nil, err
+	}
+
+	if err := feeds.Validate(); err != nil {
+		return nil, err
+	}
+
+	chapters := []apiMangaFeedItem{}
+	for _, f := range *feeds.Data {
+		if f.Type == "chapter" {
+			chapters = append(chapters, f)
+		}
+	}
+
+	if len(chapters) == 0 {
+		// TODO: and total > limit + offset -> request the rest?
+		return nil, nil
+	}
+
+	result := make([]domain.Chapter, 0, len(chapters))
+	for _, ch := range chapters {
+		r := domain.Chapter{
+			ID:            ch.ID,
+			Title:         ch.Attributes.Title,
+			Volume:        ch.Attributes.Volume,
+			Chapter:       ch.Attributes.Chapter,
+			ExternalUrl:   ch.Attributes.ExternalUrl,
+			PublishedAt:   ch.Attributes.PublishedAt,
+			ContentRating: mangaContentRating(ch.Relationships),
+			Groups:        chapterGroups(ch.Relationships),
+		}
+		result = append(result, r)
+	}
+
+	return result, nil
+}
+
+// ChapterPublished checks if the chapter with given volume and number
+// has been published in the language
+func (r *Repo) ChapterPublished(
+	ctx context.Context,
+	mangaID string,
+	lang *string,
+	volume string,
+	chapter string,
+) (bool, error) {
+	// status is the response status, 0 until the response is received
+	var status int
+	defer func(start time.Time) {
+		duration := time.Since(start)
+		metrics.HTTPDuration(apiGetChapters, status).Observe(duration.Seconds())
+		log.Log(ctx, "mdex.ChapterPublished").Trace().
+			Dur("duration", duration).
+			Str("manga_id", mangaID).
+			Interface("lang", lang).
+			Str("volume", volume).
+			Str("chapter", chapter).
+			Send()
+	}(time.Now())
+
+	u, err := url.Parse(urlGetChapters())
+	if err != nil {
+		return false, err
+	}
+
+	qry := url.Values{
+		"limit":           []string{"1"},
+		"manga":           []string{mangaID},
+		"chapter":         []string{chapter},
+		"contentRating[]": []string{"safe", "suggestive", "erotica", "pornographic"},
+	}
+	if volume != "" {
+		qry.Add("volume[]", volume)
+	}
+	if lang != nil {
+		qry.Add("translatedLanguage[]", *lang)
+	}
+	u.RawQuery = qry.Encode()
+
+	resp, err := http.Get(u.String())
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", errors.FailedHTTPReqError, err)
+	}
+	status = resp.StatusCode
+
+	if resp.StatusCode != 200 {
+		err := fmt.Errorf("%w: request failed with status %d", errors.FailedHTTPReqError, resp.StatusCode)
+		return false, err
+	}
+
+	var chapters *apiResponse[[]apiMangaFeedItem]
+	if err := json.NewDecoder(resp.Body).Decode(&chapters); err != nil {
+		return false, err
+	}
+
+	if err := chapters.Validate(); err != nil {
+		return false, err
+	}
+
+	return chapters.Total > 0, nil
+}
+
+// mangaContentRating returns content rating of the included manga relationship
+func mangaContentRating(rels []apiRelationship) string {
+	for _, rel := range rels {
+		if rel.Type != "manga" || len(rel.Attributes) == 0 {
+			continue
+		}
+
+		var attrs apiMangaAttrs
+		if err := json.Unmarshal(rel.Attributes, &attrs); err != nil {
+			return ""
+		}
+		return attrs.ContentRating
+	}
+	return ""
+}
+
+// mangaCoverURL returns url of the included cover art thumbnail
+func mangaCoverURL(mangaID string, rels []apiRelationship) string {
+	for _, rel := range rels {
+		if rel.Type != "cover_art" || len(rel.Attributes) == 0 {
+			continue
+		}
+
+		var attrs apiCoverArtAttrs
+		if err := json.Unmarshal(rel.Attributes, &attrs); err != nil || attrs.FileName == "" {
+			return ""
+		}
+		return fmt.Sprintf("%s/%s/%s.512.jpg", urlCovers, mangaID, attrs.FileName)
+	}
+	return ""
+}
+
+// chapterGroups returns names of the included scanlation groups
+func chapterGroups(rels []apiRelationship) []string {
+	var groups []string
+	for _, rel := range rels {
+		if rel.Type != "scanlation_group" || len(rel.Attributes) == 0 {
+			continue
+		}
+
+		var attrs apiScanlationGroupAttrs
+		if err := json.Unmarshal(rel.Attributes, &attrs); err != nil || attrs.Name == "" {
+			continue
+		}
+		groups = append(groups, attrs.Name)
+	}
+	return groups
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/database"
+	"github.com/neymee/mdexbot/internal/domain"
+	werrors "github.com/neymee/mdexbot/internal/errors"
+	"github.com/neymee/mdexbot/internal/log"
+	"gorm.io/gorm/clause"
+)
+
+func (r *Repo) BlockedRecipients(ctx context.Context) ([]domain.Recipient, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.BlockedRecipients").Trace().
+			Dur("duration", time.Since(t)).
+			Send()
+	}(time.Now())
+
+	var rows []database.BlockedChat
+	err := r.db.Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	recipients := make([]domain.Recipient, 0, len(rows))
+	for _, row := range rows {
+		recipients = append(recipients, domain.Recipient(row.Recipient))
+	}
+	return recipients, nil
+}
+
+func (r *Repo) BlockRecipient(ctx context.Context, recipient domain.Recipient) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.BlockRecipient").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Send()
+	}(time.Now())
+
+	err := r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&database.BlockedChat{Recipient: recipient.Recipient()}).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
+
+func (r *Repo) UnblockRecipient(ctx context.Context, recipient domain.Recipient) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.UnblockRecipient").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Send()
+	}(time.Now())
+
+	err := r.db.Delete(&database.BlockedChat{}, "recipient = ?", recipient.Recipient()).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
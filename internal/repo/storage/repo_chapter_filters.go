@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/database"
+	"github.com/neymee/mdexbot/internal/domain"
+	werrors "github.com/neymee/mdexbot/internal/errors"
+	"github.com/neymee/mdexbot/internal/log"
+	"gorm.io/gorm/clause"
+)
+
+// ChapterFilter returns nil if the recipient hasn't changed the default filter
+func (r *Repo) ChapterFilter(ctx context.Context, recipient domain.Recipient) (*domain.ChapterFilter, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.ChapterFilter").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Send()
+	}(time.Now())
+
+	var row database.ChapterFilter
+	res := r.db.Limit(1).Find(&row, "recipient = ?", recipient.Recipient())
+	if res.Error != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, res.Error)
+	} else if res.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	filter := chapterFilterFromModel(row)
+	return &filter, nil
+}
+
+func (r *Repo) SetChapterFilter(ctx context.Context, recipient domain.Recipient, filter domain.ChapterFilter) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.SetChapterFilter").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Interface("filter", filter).
+			Send()
+	}(time.Now())
+
+	err := r.db.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "recipient"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"content_ratings", "include_external", "include_scheduled", "notify_on_release", "updated_at",
+			}),
+		},
+	).Create(&database.ChapterFilter{
+		Recipient:        recipient.Recipient(),
+		ContentRatings:   strings.Join(filter.ContentRatings, ","),
+		IncludeExternal:  filter.IncludeExternal,
+		IncludeScheduled: filter.IncludeScheduled,
+		NotifyOnRelease:  filter.NotifyOnRelease,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
+
+// ChapterFilters returns filters of all recipients that have changed the default one
+func (r *Repo) ChapterFilters(ctx context.Context) (map[domain.Recipient]domain.ChapterFilter, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.ChapterFilters").Trace().
+			Dur("duration", time.Since(t)).
+			Send()
+	}(time.Now())
+
+	var rows []database.ChapterFilter
+	err := r.db.Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	result := make(map[domain.Recipient]domain.ChapterFilter, len(rows))
+	for _, row := range rows {
+		result[domain.Recipient(row.Recipient)] = chapterFilterFromModel(row)
+	}
+
+	return result, nil
+}
+
+// ReleasedChapters returns chapters that have been notified before their publication time
+// and are published now. Chapters are marked as released by SetSubscriptionLastUpdate.
+func (r *Repo) ReleasedChapters(ctx context.Context, sub domain.Subscription, now time.Time) ([]domain.Chapter, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.ReleasedChapters").Trace().
+			Dur("duration", time.Since(t)).
+			Interface("subscription", sub).
+			Time("now", now).
+			Send()
+	}(time.Now())
+
+	var rows []database.NotifiedChapter
+	err := r.db.Model(&database.NotifiedChapter{}).
+		Joins("JOIN topics ON topics.id = notified_chapters.topic_id AND topics.deleted_at IS NULL").
+		Where("topics.manga_id = ? AND topics.lang = ?", sub.MangaID, sub.Language).
+		Where("notified_chapters.released = ? AND notified_chapters.publish_at <= ?", false, now).
+		Order("notified_chapters.publish_at").
+		Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	chapters := make([]domain.Chapter, 0, len(rows))
+	for _, row := range rows {
+		chapters = append(chapters, domain.Chapter{
+			ID:            row.ChapterID,
+			Title:         row.Title,
+			Volume:        row.Volume,
+			Chapter:       row.Chapter,
+			ExternalUrl:   row.ExternalUrl,
+			PublishedAt:   row.PublishAt,
+			ContentRating: row.ContentRating,
+		})
+	}
+
+	return chapters, nil
+}
+
+func chapterFilterFromModel(row database.ChapterFilter) domain.ChapterFilter {
+	var ratings []string
+	if row.ContentRatings != "" {
+		ratings = strings.Split(row.ContentRatings, ",")
+	}
+
+	return domain.ChapterFilter{
+		ContentRatings:   ratings,
+		IncludeExternal:  row.IncludeExternal,
+		IncludeScheduled: row.IncludeScheduled,
+		NotifyOnRelease:  row.NotifyOnRelease,
+	}
+}
@@ -1,74 +1,106 @@
-package storage
-
-import (
-	"context"
-	"fmt"
-	"time"
-
-	"github.com/neymee/mdexbot/internal/database"
-	"github.com/neymee/mdexbot/internal/domain"
-	"github.com/neymee/mdexbot/internal/errors"
-	"github.com/neymee/mdexbot/internal/log"
-	"gorm.io/gorm/clause"
-)
-
-func (r *Repo) ConversationContext(ctx context.Context, recipient domain.Recipient) (string, error) {
-	defer func(t time.Time) {
-		log.Log(ctx, "storage.ConversationContext").Trace().
-			Dur("duration", time.Since(t)).
-			Str("recipient", recipient.Recipient()).
-			Send()
-	}(time.Now())
-
-	var convCtx *database.ConversationContext
-	res := r.db.Limit(1).Find(&convCtx, "recipient = ?", recipient)
-	if res.RowsAffected == 0 {
-		return "", nil
-	} else if res.Error != nil {
-		return "", fmt.Errorf("%w: %w", errors.DatabaseError, res.Error)
-	}
-	return convCtx.Command, nil
-}
-
-func (r *Repo) SetConversationContext(ctx context.Context, recipient domain.Recipient, cmd string) error {
-	defer func(t time.Time) {
-		log.Log(ctx, "storage.SetConversationContext").Trace().
-			Dur("duration", time.Since(t)).
-			Interface("conversation_context", cmd).
-			Send()
-	}(time.Now())
-
-	err := r.db.Clauses(
-		clause.OnConflict{
-			Columns: []clause.Column{{Name: "recipient"}},
-			DoUpdates: clause.Assignments(
-				map[string]interface{}{
-					"command": cmd,
-				},
-			),
-		},
-	).Create(&database.ConversationContext{
-		Recipient: recipient.Recipient(),
-		Command:   cmd,
-	}).Error
-
-	if err != nil {
-		return fmt.Errorf("%w: %w", errors.DatabaseError, err)
-	}
-	return nil
-}
-
-func (r *Repo) DeleteConversationContext(ctx context.Context, recipient domain.Recipient) error {
-	defer func(t time.Time) {
-		log.Log(ctx, "storage.DeleteConversationContext").Trace().
-			Dur("duration", time.Since(t)).
-			Str("recipient", recipient.Recipient()).
-			Send()
-	}(time.Now())
-
-	err := r.db.Delete(&database.ConversationContext{}, "recipient = ?", recipient).Error
-	if err != nil {
-		return fmt.Errorf("%w: %w", errors.DatabaseError, err)
-	}
-	return nil
-}
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/database"
+	"github.com/neymee/mdexbot/internal/domain"
+	"github.com/neymee/mdexbot/internal/errors"
+	"github.com/neymee/mdexbot/internal/log"
+	"gorm.io/gorm/clause"
+)
+
+// Conversation returns nil if the recipient has no command in progress
+func (r *Repo) Conversation(ctx context.Context, recipient domain.Recipient) (*domain.Conversation, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.Conversation").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Send()
+	}(time.Now())
+
+	var convCtx database.ConversationContext
+	res := r.db.Limit(1).Find(&convCtx, "recipient = ?", recipient)
+	if res.Error != nil {
+		return nil, fmt.Errorf("%w: %w", errors.DatabaseError, res.Error)
+	} else if res.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	conv := &domain.Conversation{
+		State:     domain.ConversationState(convCtx.Command),
+		ExpiresAt: convCtx.ExpiresAt.UTC(),
+	}
+	if convCtx.Payload != "" {
+		conv.Payload = []byte(convCtx.Payload)
+	}
+	return conv, nil
+}
+
+func (r *Repo) SetConversation(ctx context.Context, recipient domain.Recipient, conv domain.Conversation) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.SetConversation").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Str("state", string(conv.State)).
+			Time("expires_at", conv.ExpiresAt).
+			Send()
+	}(time.Now())
+
+	err := r.db.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "recipient"}},
+			DoUpdates: clause.Assignments(
+				map[string]interface{}{
+					"command":    string(conv.State),
+					"payload":    string(conv.Payload),
+					"expires_at": conv.ExpiresAt,
+				},
+			),
+		},
+	).Create(&database.ConversationContext{
+		Recipient: recipient.Recipient(),
+		Command:   string(conv.State),
+		Payload:   string(conv.Payload),
+		ExpiresAt: conv.ExpiresAt,
+	}).Error
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", errors.DatabaseError, err)
+	}
+	return nil
+}
+
+func (r *Repo) DeleteConversation(ctx context.Context, recipient domain.Recipient) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.DeleteConversation").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Send()
+	}(time.Now())
+
+	err := r.db.Delete(&database.ConversationContext{}, "recipient = ?", recipient).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", errors.DatabaseError, err)
+	}
+	return nil
+}
+
+// DeleteExpiredConversations forgets commands which expired before the given time
+func (r *Repo) DeleteExpiredConversations(ctx context.Context, before time.Time) (int64, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.DeleteExpiredConversations").Trace().
+			Dur("duration", time.Since(t)).
+			Time("before", before).
+			Send()
+	}(time.Now())
+
+	// contexts saved before expiration was introduced have no expiration time
+	res := r.db.Delete(&database.ConversationContext{}, "expires_at <= ? OR expires_at IS NULL", before)
+	if res.Error != nil {
+		return 0, fmt.Errorf("%w: %w", errors.DatabaseError, res.Error)
+	}
+	return res.RowsAffected, nil
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/database"
+	"github.com/neymee/mdexbot/internal/domain"
+	werrors "github.com/neymee/mdexbot/internal/errors"
+	"github.com/neymee/mdexbot/internal/log"
+	"gorm.io/gorm"
+)
+
+// PendingDeliveries returns deliveries which are due to be sent, the oldest first.
+// Due digest deliveries of the recipients in the batch are returned all together,
+// even beyond the limit, so a digest is never split into several messages.
+func (r *Repo) PendingDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.Delivery, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.PendingDeliveries").Trace().
+			Dur("duration", time.Since(t)).
+			Time("now", now).
+			Int("limit", limit).
+			Send()
+	}(time.Now())
+
+	var rows []database.Delivery
+	err := r.db.Model(&database.Delivery{}).
+		Where("status = ? AND next_attempt_at <= ?", database.DeliveryStatusPending, now).
+		Order("id").
+		Limit(limit).
+		Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	var digestRecipients []string
+	for _, row := range rows {
+		if row.Digest {
+			digestRecipients = append(digestRecipients, row.Recipient)
+		}
+	}
+	if len(rows) == limit && len(digestRecipients) > 0 {
+		var rest []database.Delivery
+		err := r.db.Model(&database.Delivery{}).
+			Where("status = ? AND next_attempt_at <= ?", database.DeliveryStatusPending, now).
+			Where("digest = ? AND recipient IN ? AND id > ?", true, digestRecipients, rows[len(rows)-1].ID).
+			Order("id").
+			Find(&rest).Error
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+		}
+		rows = append(rows, rest...)
+	}
+
+	var broken []uint
+	result := make([]domain.Delivery, 0, len(rows))
+	for _, row := range rows {
+		var upd domain.Update
+		err := json.Unmarshal([]byte(row.Payload), &upd)
+		if err != nil {
+			// a broken record must not block the rest of the outbox
+			log.Error(ctx, "storage.PendingDeliveries", err).
+				Uint("delivery_id", row.ID).
+				Msg("Invalid delivery payload, the delivery is failed")
+			broken = append(broken, row.ID)
+			continue
+		}
+
+		result = append(result, domain.Delivery{
+			ID:        row.ID,
+			TopicID:   row.TopicID,
+			Recipient: domain.Recipient(row.Recipient),
+			Update:    upd,
+			Attempts:  row.Attempts,
+			Digest:    row.Digest,
+		})
+	}
+
+	// broken records are given up, otherwise they are selected on every call
+	if len(broken) > 0 {
+		err := r.db.Model(&database.Delivery{}).
+			Where("id IN ?", broken).
+			Updates(map[string]interface{}{
+				"status":     database.DeliveryStatusFailed,
+				"last_error": "invalid payload",
+			}).Error
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+		}
+	}
+
+	return result, nil
+}
+
+func (r *Repo) SetDeliverySent(ctx context.Context, id uint, sentAt time.Time) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.SetDeliverySent").Trace().
+			Dur("duration", time.Since(t)).
+			Uint("delivery_id", id).
+			Send()
+	}(time.Now())
+
+	err := r.db.Model(&database.Delivery{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":  database.DeliveryStatusSent,
+			"sent_at": sentAt,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
+
+// SetDeliveryFailed counts a failed attempt. The delivery is retried at nextAttemptAt
+// or is given up if nextAttemptAt is nil.
+func (r *Repo) SetDeliveryFailed(ctx context.Context, id uint, reason string, nextAttemptAt *time.Time) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.SetDeliveryFailed").Trace().
+			Dur("duration", time.Since(t)).
+			Uint("delivery_id", id).
+			Str("reason", reason).
+			Interface("next_attempt_at", nextAttemptAt).
+			Send()
+	}(time.Now())
+
+	values := map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": reason,
+	}
+	if nextAttemptAt != nil {
+		values["next_attempt_at"] = *nextAttemptAt
+	} else {
+		values["status"] = database.DeliveryStatusFailed
+	}
+
+	err := r.db.Model(&database.Delivery{}).
+		Where("id = ?", id).
+		Updates(values).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
+
+// DeleteDeliveries removes sent and failed deliveries created before the given time
+func (r *Repo) DeleteDeliveries(ctx context.Context, before time.Time) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.DeleteDeliveries").Trace().
+			Dur("duration", time.Since(t)).
+			Time("before", before).
+			Send()
+	}(time.Now())
+
+	err := r.db.Unscoped().
+		Where("status <> ? AND created_at < ?", database.DeliveryStatusPending, before).
+		Delete(&database.Delivery{}).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
+
+func deliveryToModel(topicID uint, d domain.Delivery, now time.Time) (database.Delivery, error) {
+	payload, err := json.Marshal(d.Update)
+	if err != nil {
+		return database.Delivery{}, err
+	}
+
+	nextAttemptAt := now
+	if d.NotBefore.After(now) {
+		nextAttemptAt = d.NotBefore
+	}
+
+	return database.Delivery{
+		TopicID:       topicID,
+		Recipient:     d.Recipient.Recipient(),
+		Payload:       string(payload),
+		Status:        database.DeliveryStatusPending,
+		NextAttemptAt: nextAttemptAt,
+		Digest:        d.Digest,
+	}, nil
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/database"
+	"github.com/neymee/mdexbot/internal/domain"
+	werrors "github.com/neymee/mdexbot/internal/errors"
+	"github.com/neymee/mdexbot/internal/log"
+)
+
+func (r *Repo) SetLanguageWatch(ctx context.Context, recipient domain.Recipient, watch domain.LanguageWatch) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.SetLanguageWatch").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Interface("watch", watch).
+			Send()
+	}(time.Now())
+
+	row := database.LanguageWatch{
+		MangaID:   watch.MangaID,
+		Lang:      watch.Language,
+		Recipient: recipient.Recipient(),
+	}
+
+	err := r.db.Where(&row).
+		Attrs(database.LanguageWatch{Title: watch.MangaTitle}).
+		FirstOrCreate(&row).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
+
+func (r *Repo) DeleteLanguageWatch(
+	ctx context.Context,
+	recipient domain.Recipient,
+	mangaID string,
+	lang string,
+) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.DeleteLanguageWatch").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Str("manga_id", mangaID).
+			Str("lang", lang).
+			Send()
+	}(time.Now())
+
+	err := r.db.Delete(
+		&database.LanguageWatch{},
+		"recipient = ? AND manga_id = ? AND lang = ?",
+		recipient.Recipient(),
+		mangaID,
+		lang,
+	).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
+
+func (r *Repo) AllLanguageWatches(ctx context.Context) ([]domain.LanguageWatchExtended, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.AllLanguageWatches").Trace().
+			Dur("duration", time.Since(t)).
+			Send()
+	}(time.Now())
+
+	var rows []database.LanguageWatch
+	err := r.db.Order("manga_id, lang").Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	// rows are ordered, so the watches of the same manga and language are adjacent
+	result := []domain.LanguageWatchExtended{}
+	for _, row := range rows {
+		last := len(result) - 1
+		if last >= 0 && result[last].MangaID == row.MangaID && result[last].Language == row.Lang {
+			result[last].Recipients = append(result[last].Recipients, domain.Recipient(row.Recipient))
+			continue
+		}
+
+		result = append(result, domain.LanguageWatchExtended{
+			LanguageWatch: domain.LanguageWatch{
+				MangaID:    row.MangaID,
+				MangaTitle: row.Title,
+				Language:   row.Lang,
+			},
+			Recipients: []domain.Recipient{domain.Recipient(row.Recipient)},
+		})
+	}
+
+	return result, nil
+}
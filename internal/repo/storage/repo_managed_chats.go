@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/database"
+	"github.com/neymee/mdexbot/internal/domain"
+	"github.com/neymee/mdexbot/internal/errors"
+	"github.com/neymee/mdexbot/internal/log"
+	"gorm.io/gorm/clause"
+)
+
+// ManagedChat returns nil if the recipient doesn't manage any channel
+func (r *Repo) ManagedChat(ctx context.Context, recipient domain.Recipient) (*domain.ManagedChat, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.ManagedChat").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Send()
+	}(time.Now())
+
+	var row database.ManagedChat
+	res := r.db.Limit(1).Find(&row, "recipient = ?", recipient.Recipient())
+	if res.Error != nil {
+		return nil, fmt.Errorf("%w: %w", errors.DatabaseError, res.Error)
+	} else if res.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	return &domain.ManagedChat{
+		Chat:  domain.Recipient(row.Chat),
+		Title: row.Title,
+	}, nil
+}
+
+func (r *Repo) SetManagedChat(ctx context.Context, recipient domain.Recipient, chat domain.ManagedChat) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.SetManagedChat").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Interface("chat", chat).
+			Send()
+	}(time.Now())
+
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "recipient"}},
+		DoUpdates: clause.AssignmentColumns([]string{"chat", "title", "created_at"}),
+	}).Create(&database.ManagedChat{
+		Recipient: recipient.Recipient(),
+		Chat:      chat.Chat.Recipient(),
+		Title:     chat.Title,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", errors.DatabaseError, err)
+	}
+	return nil
+}
+
+func (r *Repo) DeleteManagedChat(ctx context.Context, recipient domain.Recipient) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.DeleteManagedChat").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Send()
+	}(time.Now())
+
+	err := r.db.Delete(&database.ManagedChat{}, "recipient = ?", recipient.Recipient()).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", errors.DatabaseError, err)
+	}
+	return nil
+}
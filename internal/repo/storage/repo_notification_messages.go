@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/database"
+	"github.com/neymee/mdexbot/internal/domain"
+	werrors "github.com/neymee/mdexbot/internal/errors"
+	"github.com/neymee/mdexbot/internal/log"
+	"gorm.io/gorm/clause"
+)
+
+// NotificationMessage returns nil if no message about the topic has been sent to the recipient
+func (r *Repo) NotificationMessage(
+	ctx context.Context,
+	recipient domain.Recipient,
+	topicID uint,
+) (*domain.NotificationMessage, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.NotificationMessage").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Uint("topic_id", topicID).
+			Send()
+	}(time.Now())
+
+	var row database.NotificationMessage
+	res := r.db.Limit(1).Find(&row, "recipient = ? AND topic_id = ?", recipient.Recipient(), topicID)
+	if res.Error != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, res.Error)
+	} else if res.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	var upd domain.Update
+	err := json.Unmarshal([]byte(row.Payload), &upd)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.NotificationMessage{
+		MessageID: row.MessageID,
+		Photo:     row.Photo,
+		Update:    upd,
+		SentAt:    row.SentAt,
+	}, nil
+}
+
+func (r *Repo) SetNotificationMessage(
+	ctx context.Context,
+	recipient domain.Recipient,
+	topicID uint,
+	msg domain.NotificationMessage,
+) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.SetNotificationMessage").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Uint("topic_id", topicID).
+			Int("message_id", msg.MessageID).
+			Send()
+	}(time.Now())
+
+	payload, err := json.Marshal(msg.Update)
+	if err != nil {
+		return err
+	}
+
+	err = r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "recipient"}, {Name: "topic_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"message_id", "photo", "payload", "sent_at"}),
+	}).Create(&database.NotificationMessage{
+		Recipient: recipient.Recipient(),
+		TopicID:   topicID,
+		MessageID: msg.MessageID,
+		Photo:     msg.Photo,
+		Payload:   string(payload),
+		SentAt:    msg.SentAt,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
+
+// DeleteNotificationMessages forgets messages sent before the given time
+func (r *Repo) DeleteNotificationMessages(ctx context.Context, before time.Time) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.DeleteNotificationMessages").Trace().
+			Dur("duration", time.Since(t)).
+			Time("before", before).
+			Send()
+	}(time.Now())
+
+	err := r.db.Delete(&database.NotificationMessage{}, "sent_at < ?", before).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
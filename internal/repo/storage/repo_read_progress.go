@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/database"
+	"github.com/neymee/mdexbot/internal/domain"
+	werrors "github.com/neymee/mdexbot/internal/errors"
+	"github.com/neymee/mdexbot/internal/log"
+)
+
+func (r *Repo) MarkChapterRead(
+	ctx context.Context,
+	recipient domain.Recipient,
+	chapterID string,
+) ([]domain.Subscription, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.MarkChapterRead").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Str("chapter_id", chapterID).
+			Send()
+	}(time.Now())
+
+	var rows []struct {
+		SubscriptionID    uint
+		NotifiedChapterID uint
+		MangaID           string
+		Lang              string
+		Title             string
+	}
+
+	// the same chapter may be notified in several topics, e.g. "en" and "any"
+	err := r.db.Table("topic_subscriptions").
+		Select(`topic_subscriptions.id AS subscription_id,
+			notified_chapters.id AS notified_chapter_id,
+			topics.manga_id, topics.lang, topics.title`).
+		Joins("JOIN topics ON topics.id = topic_subscriptions.topic_id AND topics.deleted_at IS NULL").
+		Joins(`JOIN notified_chapters ON notified_chapters.topic_id = topics.id
+			AND notified_chapters.deleted_at IS NULL`).
+		Where(`topic_subscriptions.recipient = ?
+			AND topic_subscriptions.deleted_at IS NULL
+			AND notified_chapters.chapter_id = ?`, recipient.Recipient(), chapterID).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	subs := make([]domain.Subscription, 0, len(rows))
+	for _, row := range rows {
+		// never move the progress backwards if an older chapter is marked
+		err := r.db.Model(&database.TopicSubscription{}).
+			Where("id = ? AND last_read_chapter_id < ?", row.SubscriptionID, row.NotifiedChapterID).
+			Update("last_read_chapter_id", row.NotifiedChapterID).Error
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+		}
+
+		subs = append(subs, domain.Subscription{
+			MangaID:    row.MangaID,
+			MangaTitle: row.Title,
+			Language:   row.Lang,
+		})
+	}
+
+	return subs, nil
+}
+
+func (r *Repo) UnreadSubscriptions(ctx context.Context, recipient domain.Recipient) ([]domain.UnreadSubscription, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.UnreadSubscriptions").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Send()
+	}(time.Now())
+
+	var rows []struct {
+		MangaID string
+		Lang    string
+		Title   string
+		Unread  int
+	}
+
+	err := r.db.Table("topic_subscriptions").
+		Select("topics.manga_id, topics.lang, topics.title, COUNT(notified_chapters.id) AS unread").
+		Joins("JOIN topics ON topics.id = topic_subscriptions.topic_id AND topics.deleted_at IS NULL").
+		Joins(unreadChaptersJoin).
+		Joins(chapterFiltersJoin).
+		Where("topic_subscriptions.recipient = ? AND topic_subscriptions.deleted_at IS NULL", recipient.Recipient()).
+		Where(chapterFiltersCond, time.Now().UTC()).
+		Group("topics.manga_id, topics.lang, topics.title").
+		Order("topics.title").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	result := make([]domain.UnreadSubscription, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, domain.UnreadSubscription{
+			Subscription: domain.Subscription{
+				MangaID:    row.MangaID,
+				MangaTitle: row.Title,
+				Language:   row.Lang,
+			},
+			Unread: row.Unread,
+		})
+	}
+
+	return result, nil
+}
+
+func (r *Repo) UnreadCounts(ctx context.Context, sub domain.Subscription) (map[domain.Recipient]int, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.UnreadCounts").Trace().
+			Dur("duration", time.Since(t)).
+			Interface("subscription", sub).
+			Send()
+	}(time.Now())
+
+	var rows []struct {
+		Recipient string
+		Unread    int
+	}
+
+	err := r.db.Table("topic_subscriptions").
+		Select("topic_subscriptions.recipient, COUNT(notified_chapters.id) AS unread").
+		Joins(`JOIN topics ON topics.id = topic_subscriptions.topic_id
+			AND topics.deleted_at IS NULL
+			AND topics.manga_id = ?
+			AND topics.lang = ?`, sub.MangaID, sub.Language).
+		Joins(unreadChaptersJoin).
+		Joins(chapterFiltersJoin).
+		Where("topic_subscriptions.deleted_at IS NULL").
+		Where(chapterFiltersCond, time.Now().UTC()).
+		Group("topic_subscriptions.recipient").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	result := make(map[domain.Recipient]int, len(rows))
+	for _, row := range rows {
+		result[domain.Recipient(row.Recipient)] = row.Unread
+	}
+
+	return result, nil
+}
+
+// unreadChaptersJoin joins chapters notified after the subscription was created
+// and after the last chapter marked as read
+const unreadChaptersJoin = `JOIN notified_chapters ON notified_chapters.topic_id = topic_subscriptions.topic_id
+	AND notified_chapters.deleted_at IS NULL
+	AND notified_chapters.id > topic_subscriptions.last_read_chapter_id
+	AND notified_chapters.created_at >= topic_subscriptions.created_at`
+
+// chapterFiltersJoin joins the chapter filter of the recipient, there is no filter if it's the default one
+const chapterFiltersJoin = `LEFT JOIN chapter_filters ON chapter_filters.recipient = topic_subscriptions.recipient`
+
+// chapterFiltersCond leaves chapters the recipient has been notified about according to the filter
+// like domain.ChapterFilter.Allows does. Scheduled chapters are counted once they are notified,
+// i.e. when they are published unless the recipient wants to know about them in advance.
+// The only argument is the current time.
+const chapterFiltersCond = `(chapter_filters.recipient IS NULL OR (
+	(notified_chapters.content_rating = ''
+		OR ',' || chapter_filters.content_ratings || ',' LIKE '%,' || notified_chapters.content_rating || ',%')
+	AND (notified_chapters.external_url = '' OR chapter_filters.include_external)
+	AND (notified_chapters.publish_at <= ? OR chapter_filters.include_scheduled)
+))`
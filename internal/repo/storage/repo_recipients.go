@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/database"
+	"github.com/neymee/mdexbot/internal/domain"
+	werrors "github.com/neymee/mdexbot/internal/errors"
+	"github.com/neymee/mdexbot/internal/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RecipientFailure returns nil if there are no failures for the recipient
+func (r *Repo) RecipientFailure(ctx context.Context, recipient domain.Recipient) (*domain.RecipientFailure, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.RecipientFailure").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Send()
+	}(time.Now())
+
+	var row database.RecipientFailure
+	res := r.db.Limit(1).Find(&row, "recipient = ?", recipient.Recipient())
+	if res.Error != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, res.Error)
+	} else if res.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	return &domain.RecipientFailure{
+		Failures:      row.Failures,
+		LastError:     row.LastError,
+		LastFailureAt: row.LastFailureAt,
+	}, nil
+}
+
+// FailedRecipients returns recipients with recorded failures
+func (r *Repo) FailedRecipients(ctx context.Context) ([]domain.Recipient, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.FailedRecipients").Trace().
+			Dur("duration", time.Since(t)).
+			Send()
+	}(time.Now())
+
+	var rows []string
+	err := r.db.Model(&database.RecipientFailure{}).Pluck("recipient", &rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	recs := make([]domain.Recipient, 0, len(rows))
+	for _, row := range rows {
+		recs = append(recs, domain.Recipient(row))
+	}
+	return recs, nil
+}
+
+func (r *Repo) SetRecipientFailure(ctx context.Context, recipient domain.Recipient, failure domain.RecipientFailure) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.SetRecipientFailure").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Interface("failure", failure).
+			Send()
+	}(time.Now())
+
+	row := database.RecipientFailure{
+		Recipient:     recipient.Recipient(),
+		Failures:      failure.Failures,
+		LastError:     failure.LastError,
+		LastFailureAt: failure.LastFailureAt,
+	}
+
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "recipient"}},
+		DoUpdates: clause.AssignmentColumns([]string{"failures", "last_error", "last_failure_at"}),
+	}).Create(&row).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
+
+func (r *Repo) DeleteRecipientFailure(ctx context.Context, recipient domain.Recipient) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.DeleteRecipientFailure").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Send()
+	}(time.Now())
+
+	err := r.db.Delete(&database.RecipientFailure{}, "recipient = ?", recipient.Recipient()).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
+
+// MigrateRecipient moves subscriptions, language watches, chapter filter and pending deliveries
+// to the new chat id. Subscriptions the new chat already has are kept as is.
+func (r *Repo) MigrateRecipient(ctx context.Context, from domain.Recipient, to domain.Recipient) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.MigrateRecipient").Trace().
+			Dur("duration", time.Since(t)).
+			Str("from", from.Recipient()).
+			Str("to", to.Recipient()).
+			Send()
+	}(time.Now())
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("recipient = ?", from.Recipient()).
+			Where("topic_id IN (?)", tx.Model(&database.TopicSubscription{}).
+				Select("topic_id").
+				Where("recipient = ?", to.Recipient())).
+			Delete(&database.TopicSubscription{}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&database.TopicSubscription{}).
+			Where("recipient = ?", from.Recipient()).
+			Update("recipient", to.Recipient()).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("recipient = ?", from.Recipient()).
+			Where("(manga_id, lang) IN (?)", tx.Model(&database.LanguageWatch{}).
+				Select("manga_id, lang").
+				Where("recipient = ?", to.Recipient())).
+			Delete(&database.LanguageWatch{}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&database.LanguageWatch{}).
+			Where("recipient = ?", from.Recipient()).
+			Update("recipient", to.Recipient()).Error
+		if err != nil {
+			return err
+		}
+
+		// preferences of the new chat are kept if it has its own
+		for _, model := range []interface{}{&database.ChapterFilter{}, &database.UserSettings{}} {
+			var exists bool
+			err = tx.Model(model).
+				Select("count(*) > 0").
+				Where("recipient = ?", to.Recipient()).
+				Find(&exists).Error
+			if err != nil {
+				return err
+			}
+
+			if exists {
+				err = tx.Delete(model, "recipient = ?", from.Recipient()).Error
+			} else {
+				err = tx.Model(model).
+					Where("recipient = ?", from.Recipient()).
+					Update("recipient", to.Recipient()).Error
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		err = tx.Model(&database.Delivery{}).
+			Where("recipient = ? AND status = ?", from.Recipient(), database.DeliveryStatusPending).
+			Update("recipient", to.Recipient()).Error
+		if err != nil {
+			return err
+		}
+
+		// messages of the old chat can't be edited
+		err = tx.Delete(&database.NotificationMessage{}, "recipient = ?", from.Recipient()).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Delete(&database.ConversationContext{}, "recipient = ?", from.Recipient()).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(&database.RecipientFailure{}, "recipient = ?", from.Recipient()).Error
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/database"
+	"github.com/neymee/mdexbot/internal/domain"
+	werrors "github.com/neymee/mdexbot/internal/errors"
+	"github.com/neymee/mdexbot/internal/log"
+	"gorm.io/gorm/clause"
+)
+
+// TopicSnapshot returns nil if there is no snapshot for the subscription yet
+func (r *Repo) TopicSnapshot(ctx context.Context, sub domain.Subscription) (*domain.MangaSnapshot, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.TopicSnapshot").Trace().
+			Dur("duration", time.Since(t)).
+			Interface("subscription", sub).
+			Send()
+	}(time.Now())
+
+	var snapshot database.TopicSnapshot
+	res := r.db.Limit(1).
+		Joins("JOIN topics ON topics.id = topic_snapshots.topic_id AND topics.deleted_at IS NULL").
+		Find(&snapshot, "topics.manga_id = ? AND topics.lang = ?", sub.MangaID, sub.Language)
+	if res.Error != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, res.Error)
+	} else if res.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	var langs []string
+	if snapshot.Languages != "" {
+		langs = strings.Split(snapshot.Languages, ",")
+	}
+
+	return &domain.MangaSnapshot{
+		Status:               snapshot.Status,
+		TranslationLanguages: langs,
+		LastVolume:           snapshot.LastVolume,
+		LastChapter:          snapshot.LastChapter,
+		FinalPublished:       snapshot.FinalPublished,
+	}, nil
+}
+
+func (r *Repo) SetTopicSnapshot(ctx context.Context, sub domain.Subscription, snapshot domain.MangaSnapshot) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.SetTopicSnapshot").Trace().
+			Dur("duration", time.Since(t)).
+			Interface("subscription", sub).
+			Interface("snapshot", snapshot).
+			Send()
+	}(time.Now())
+
+	topic := database.Topic{}
+	err := r.db.Model(&database.Topic{}).
+		Find(&topic, "manga_id = ? AND lang = ?", sub.MangaID, sub.Language).
+		Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	row := database.TopicSnapshot{
+		TopicID:        topic.ID,
+		Status:         snapshot.Status,
+		Languages:      strings.Join(snapshot.TranslationLanguages, ","),
+		LastVolume:     snapshot.LastVolume,
+		LastChapter:    snapshot.LastChapter,
+		FinalPublished: snapshot.FinalPublished,
+	}
+
+	err = r.db.Clauses(
+		clause.OnConflict{
+			Columns:     []clause.Column{{Name: "topic_id"}},
+			TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "deleted_at IS NULL"}}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"status", "languages", "last_volume", "last_chapter", "final_published", "updated_at",
+			}),
+		},
+	).Create(&row).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/database"
+	"github.com/neymee/mdexbot/internal/domain"
+	werrors "github.com/neymee/mdexbot/internal/errors"
+	"github.com/neymee/mdexbot/internal/log"
+)
+
+// Stats counts users and notifications, notifications are counted since the given time
+func (r *Repo) Stats(ctx context.Context, since time.Time) (domain.Stats, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.Stats").Trace().
+			Dur("duration", time.Since(t)).
+			Time("since", since).
+			Send()
+	}(time.Now())
+
+	var stats domain.Stats
+	err := r.db.Model(&database.TopicSubscription{}).Distinct("recipient").Count(&stats.Recipients).Error
+	if err == nil {
+		err = r.db.Model(&database.TopicSubscription{}).Count(&stats.Subscriptions).Error
+	}
+	if err == nil {
+		err = r.db.Model(&database.TopicSubscription{}).Distinct("topic_id").Count(&stats.Topics).Error
+	}
+	if err == nil {
+		err = r.db.Model(&database.Delivery{}).
+			Where("status = ? AND sent_at >= ?", database.DeliveryStatusSent, since).
+			Count(&stats.Sent).Error
+	}
+	if err == nil {
+		err = r.db.Model(&database.Delivery{}).
+			Where("status = ? AND updated_at >= ?", database.DeliveryStatusFailed, since).
+			Count(&stats.Failed).Error
+	}
+	if err == nil {
+		err = r.db.Model(&database.Delivery{}).
+			Where("status = ?", database.DeliveryStatusPending).
+			Count(&stats.Pending).Error
+	}
+	if err != nil {
+		return domain.Stats{}, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	return stats, nil
+}
+
+// Recipients returns every recipient that has subscriptions or settings
+func (r *Repo) Recipients(ctx context.Context) ([]domain.Recipient, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.Recipients").Trace().
+			Dur("duration", time.Since(t)).
+			Send()
+	}(time.Now())
+
+	var subscribed, configured []string
+	err := r.db.Model(&database.TopicSubscription{}).Distinct().Pluck("recipient", &subscribed).Error
+	if err == nil {
+		err = r.db.Model(&database.UserSettings{}).Pluck("recipient", &configured).Error
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	seen := make(map[string]bool, len(subscribed)+len(configured))
+	recipients := make([]domain.Recipient, 0, len(subscribed)+len(configured))
+	for _, rec := range append(subscribed, configured...) {
+		if !seen[rec] {
+			seen[rec] = true
+			recipients = append(recipients, domain.Recipient(rec))
+		}
+	}
+
+	return recipients, nil
+}
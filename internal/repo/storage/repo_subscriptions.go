@@ -1,260 +1,476 @@
-package storage
-
-import (
-	"context"
-	"fmt"
-	"time"
-
-	"github.com/neymee/mdexbot/internal/database"
-	"github.com/neymee/mdexbot/internal/domain"
-	werrors "github.com/neymee/mdexbot/internal/errors"
-	"github.com/neymee/mdexbot/internal/log"
-)
-
-func (r *Repo) SetUserSubscription(
-	ctx context.Context,
-	user domain.Recipient,
-	sub domain.Subscription,
-) error {
-	defer func(t time.Time) {
-		log.Log(ctx, "storage.SetUserSubscription").Trace().
-			Dur("duration", time.Since(t)).
-			Interface("subscription", sub).
-			Send()
-	}(time.Now())
-
-	topic := database.Topic{
-		MangaID: sub.MangaID,
-		Lang:    sub.Language,
-		Title:   sub.MangaTitle,
-	}
-
-	err := r.db.FirstOrCreate(&topic, &topic).Error
-	if err != nil {
-		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
-	}
-
-	topicSub := database.TopicSubscription{
-		TopicID:   topic.ID,
-		Recipient: user.Recipient(),
-	}
-
-	err = r.db.Create(&topicSub).Error
-	if err != nil {
-		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
-	}
-	return nil
-}
-
-func (r *Repo) SetSubscriptionLastUpdate(
-	ctx context.Context,
-	sub domain.Subscription,
-	updatedAt time.Time,
-	chapters ...domain.Chapter,
-) error {
-	defer func(t time.Time) {
-		log.Log(ctx, "storage.SetSubscriptionLastUpdate").Trace().
-			Dur("duration", time.Since(t)).
-			Interface("subscription", sub).
-			Time("updated_at", updatedAt).
-			Interface("chapters", chapters).
-			Send()
-	}(time.Now())
-
-	topic := database.Topic{}
-	err := r.db.Model(&database.Topic{}).
-		Find(&topic, "manga_id = ? AND lang = ?", sub.MangaID, sub.Language).
-		Error
-	if err != nil {
-		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
-	}
-
-	for _, c := range chapters {
-		err := r.db.Create(&database.NotifiedChapter{
-			TopicID: topic.ID,
-			Chapter: c.Chapter,
-			Volume:  c.Volume,
-		}).Error
-		if err != nil {
-			return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
-		}
-	}
-
-	err = r.db.Model(&database.Topic{}).
-		Where("id = ?", topic.ID).
-		Update("updated_at", updatedAt).Error
-
-	if err != nil {
-		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
-	}
-	return nil
-}
-
-func (r *Repo) IsChapterNotified(ctx context.Context, sub domain.Subscription, chapter domain.Chapter) (bool, error) {
-	defer func(t time.Time) {
-		log.Log(ctx, "storage.IsChapterNotified").Trace().
-			Dur("duration", time.Since(t)).
-			Interface("subscription", sub).
-			Str("chapter", chapter.Chapter).
-			Str("volume", chapter.Volume).
-			Send()
-	}(time.Now())
-
-	topic := database.Topic{}
-	err := r.db.Model(&database.Topic{}).
-		Find(&topic, "manga_id = ? AND lang = ?", sub.MangaID, sub.Language).
-		Error
-	if err != nil {
-		return false, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
-	}
-
-	var exists bool
-	err = r.db.Model(&database.NotifiedChapter{}).
-		Select("count(*) > 0").
-		Where("topic_id = ? AND chapter = ? AND volume = ?", topic.ID, chapter.Chapter, chapter.Volume).
-		Find(&exists).
-		Error
-
-	if err != nil {
-		return false, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
-	}
-
-	return exists, nil
-}
-
-func (r *Repo) UserSubscriptions(ctx context.Context, recipient domain.Recipient) ([]domain.Subscription, error) {
-	defer func(t time.Time) {
-		log.Log(ctx, "storage.UserSubscriptions").Trace().
-			Dur("duration", time.Since(t)).
-			Str("recipient", recipient.Recipient()).
-			Send()
-	}(time.Now())
-
-	var topics []database.Topic
-
-	err := r.db.Joins(
-		`JOIN topic_subscriptions ON topic_subscriptions.topic_id = topics.id
-			AND topic_subscriptions.recipient = ?
-			AND topic_subscriptions.deleted_at IS NULL`,
-		recipient.Recipient(),
-	).Find(&topics).Error
-	if err != nil {
-		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
-	}
-
-	subs := make([]domain.Subscription, 0, len(topics))
-	for _, s := range topics {
-		subs = append(subs, domain.Subscription{
-			MangaID:    s.MangaID,
-			MangaTitle: s.Title,
-			Language:   s.Lang,
-		})
-	}
-
-	return subs, nil
-}
-
-func (r *Repo) DeleteUserSubscription(
-	ctx context.Context,
-	recipient domain.Recipient,
-	mangaID string,
-	lang string,
-) error {
-	defer func(t time.Time) {
-		log.Log(ctx, "storage.DeleteUserSubscription").Trace().
-			Dur("duration", time.Since(t)).
-			Str("recipient", recipient.Recipient()).
-			Str("lang", lang).
-			Send()
-	}(time.Now())
-
-	topic := database.Topic{}
-	err := r.db.Model(&database.Topic{}).
-		Preload("Subscriptions").
-		Find(&topic, "manga_id = ? AND lang = ?", mangaID, lang).Error
-	if err != nil {
-		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
-	}
-
-	err = r.db.Delete(
-		&database.TopicSubscription{},
-		"recipient = ? AND topic_id = ?",
-		recipient.Recipient(),
-		topic.ID,
-	).Error
-	if err != nil {
-		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
-	}
-
-	if len(topic.Subscriptions) == 1 && topic.Subscriptions[0].Recipient == recipient.Recipient() {
-		err := r.db.Delete(&topic).Error
-		if err != nil {
-			return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
-		}
-	}
-
-	return nil
-}
-
-func (r *Repo) DeleteAllSubscriptions(ctx context.Context, recipient domain.Recipient) error {
-	defer func(t time.Time) {
-		log.Log(ctx, "storage.DeleteAllSubscriptions").Trace().
-			Dur("duration", time.Since(t)).
-			Str("recipient", recipient.Recipient()).
-			Send()
-	}(time.Now())
-
-	err := r.db.Delete(
-		&database.TopicSubscription{},
-		"recipient = ?",
-		recipient.Recipient(),
-	).Error
-	if err != nil {
-		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
-	}
-
-	// if there are no more subscriptions on this topic then remove the topic
-	err = r.db.Delete(
-		&database.Topic{},
-		"id IN (SELECT topic_id FROM topic_subscriptions GROUP BY topic_id HAVING EVERY(deleted_at IS NOT NULL))",
-	).Error
-	if err != nil {
-		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
-	}
-
-	return nil
-}
-
-func (r *Repo) AllSubscriptions(ctx context.Context) ([]domain.SubscriptionExtended, error) {
-	defer func(t time.Time) {
-		log.Log(ctx, "storage.AllSubscriptions").Trace().
-			Dur("duration", time.Since(t)).
-			Send()
-	}(time.Now())
-
-	var topics []database.Topic
-	err := r.db.Preload("Subscriptions").Find(&topics).Error
-	if err != nil {
-		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
-	}
-
-	result := make([]domain.SubscriptionExtended, 0, len(topics))
-	for _, t := range topics {
-		recs := make([]domain.Recipient, 0, len(t.Subscriptions))
-		for _, s := range t.Subscriptions {
-			recs = append(recs, domain.Recipient(s.Recipient))
-		}
-
-		result = append(result, domain.SubscriptionExtended{
-			Subscription: domain.Subscription{
-				MangaID:    t.MangaID,
-				MangaTitle: t.Title,
-				Language:   t.Lang,
-			},
-			UpdatedAt:  t.UpdatedAt,
-			Recipients: recs,
-		})
-	}
-
-	return result, nil
-}
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/database"
+	"github.com/neymee/mdexbot/internal/domain"
+	werrors "github.com/neymee/mdexbot/internal/errors"
+	"github.com/neymee/mdexbot/internal/log"
+	"gorm.io/gorm"
+)
+
+func (r *Repo) SetUserSubscription(
+	ctx context.Context,
+	user domain.Recipient,
+	sub domain.Subscription,
+) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.SetUserSubscription").Trace().
+			Dur("duration", time.Since(t)).
+			Interface("subscription", sub).
+			Send()
+	}(time.Now())
+
+	topic := database.Topic{
+		MangaID: sub.MangaID,
+		Lang:    sub.Language,
+		Title:   sub.MangaTitle,
+	}
+
+	err := r.db.FirstOrCreate(&topic, &topic).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	topicSub := database.TopicSubscription{
+		TopicID:           topic.ID,
+		Recipient:         user.Recipient(),
+		StatusAlerts:      sub.StatusAlerts,
+		Priority:          sub.Priority,
+		FirstLanguageOnly: sub.FirstLanguageOnly,
+	}
+
+	err = r.db.Create(&topicSub).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
+
+// SetSubscriptionLastUpdate saves new chapters of the subscription as notified, marks released
+// chapters and puts deliveries to the outbox in a single transaction
+func (r *Repo) SetSubscriptionLastUpdate(
+	ctx context.Context,
+	sub domain.Subscription,
+	updatedAt time.Time,
+	chapters []domain.Chapter,
+	released []domain.Chapter,
+	deliveries []domain.Delivery,
+) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.SetSubscriptionLastUpdate").Trace().
+			Dur("duration", time.Since(t)).
+			Interface("subscription", sub).
+			Time("updated_at", updatedAt).
+			Interface("chapters", chapters).
+			Interface("released", released).
+			Int("deliveries", len(deliveries)).
+			Send()
+	}(time.Now())
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		topic := database.Topic{}
+		err := tx.Model(&database.Topic{}).
+			Find(&topic, "manga_id = ? AND lang = ?", sub.MangaID, sub.Language).
+			Error
+		if err != nil {
+			return err
+		}
+
+		for _, c := range chapters {
+			err := tx.Create(&database.NotifiedChapter{
+				TopicID:       topic.ID,
+				Chapter:       c.Chapter,
+				Volume:        c.Volume,
+				ChapterID:     c.ID,
+				Title:         c.Title,
+				ExternalUrl:   c.ExternalUrl,
+				ContentRating: c.ContentRating,
+				PublishAt:     c.PublishedAt,
+				Released:      !c.IsScheduled(updatedAt),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(released) > 0 {
+			ids := make([]string, 0, len(released))
+			for _, c := range released {
+				ids = append(ids, c.ID)
+			}
+
+			err = tx.Model(&database.NotifiedChapter{}).
+				Where("topic_id = ? AND chapter_id IN ?", topic.ID, ids).
+				Update("released", true).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, d := range deliveries {
+			row, err := deliveryToModel(topic.ID, d, updatedAt)
+			if err != nil {
+				return err
+			}
+
+			err = tx.Create(&row).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&database.Topic{}).
+			Where("id = ?", topic.ID).
+			Update("updated_at", updatedAt).Error
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
+
+func (r *Repo) IsChapterNotified(ctx context.Context, sub domain.Subscription, chapter domain.Chapter) (bool, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.IsChapterNotified").Trace().
+			Dur("duration", time.Since(t)).
+			Interface("subscription", sub).
+			Str("chapter", chapter.Chapter).
+			Str("volume", chapter.Volume).
+			Send()
+	}(time.Now())
+
+	topic := database.Topic{}
+	err := r.db.Model(&database.Topic{}).
+		Find(&topic, "manga_id = ? AND lang = ?", sub.MangaID, sub.Language).
+		Error
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	var exists bool
+	err = r.db.Model(&database.NotifiedChapter{}).
+		Select("count(*) > 0").
+		Where("topic_id = ? AND chapter = ? AND volume = ?", topic.ID, chapter.Chapter, chapter.Volume).
+		Find(&exists).
+		Error
+
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	return exists, nil
+}
+
+func (r *Repo) UserSubscriptions(ctx context.Context, recipient domain.Recipient) ([]domain.Subscription, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.UserSubscriptions").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Send()
+	}(time.Now())
+
+	var topics []struct {
+		database.Topic
+		StatusAlerts      bool
+		Priority          int
+		FirstLanguageOnly bool
+		LastChapterAt     *time.Time
+	}
+
+	err := r.db.Model(&database.Topic{}).
+		Select(`topics.*,
+			topic_subscriptions.status_alerts,
+			topic_subscriptions.priority,
+			topic_subscriptions.first_language_only,
+			(SELECT MAX(notified_chapters.created_at) FROM notified_chapters
+				WHERE notified_chapters.topic_id = topics.id
+					AND notified_chapters.deleted_at IS NULL) AS last_chapter_at`).
+		Joins(
+			`JOIN topic_subscriptions ON topic_subscriptions.topic_id = topics.id
+				AND topic_subscriptions.recipient = ?
+				AND topic_subscriptions.deleted_at IS NULL`,
+			recipient.Recipient(),
+		).
+		Order("topics.title, topics.manga_id, topic_subscriptions.priority").
+		Find(&topics).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	subs := make([]domain.Subscription, 0, len(topics))
+	for _, s := range topics {
+		sub := domain.Subscription{
+			MangaID:           s.MangaID,
+			MangaTitle:        s.Title,
+			Language:          s.Lang,
+			StatusAlerts:      s.StatusAlerts,
+			Priority:          s.Priority,
+			FirstLanguageOnly: s.FirstLanguageOnly,
+		}
+		if s.LastChapterAt != nil {
+			sub.LastChapterAt = s.LastChapterAt.UTC()
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, nil
+}
+
+func (r *Repo) DeleteUserSubscription(
+	ctx context.Context,
+	recipient domain.Recipient,
+	mangaID string,
+	lang string,
+) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.DeleteUserSubscription").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Str("lang", lang).
+			Send()
+	}(time.Now())
+
+	topic := database.Topic{}
+	err := r.db.Model(&database.Topic{}).
+		Preload("Subscriptions").
+		Find(&topic, "manga_id = ? AND lang = ?", mangaID, lang).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	err = r.db.Delete(
+		&database.TopicSubscription{},
+		"recipient = ? AND topic_id = ?",
+		recipient.Recipient(),
+		topic.ID,
+	).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	if len(topic.Subscriptions) == 1 && topic.Subscriptions[0].Recipient == recipient.Recipient() {
+		err := r.db.Delete(&topic).Error
+		if err != nil {
+			return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *Repo) SetStatusAlerts(
+	ctx context.Context,
+	recipient domain.Recipient,
+	mangaID string,
+	lang string,
+	enabled bool,
+) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.SetStatusAlerts").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Str("manga_id", mangaID).
+			Str("lang", lang).
+			Bool("enabled", enabled).
+			Send()
+	}(time.Now())
+
+	err := r.db.Model(&database.TopicSubscription{}).
+		Where(
+			"recipient = ? AND topic_id IN (SELECT id FROM topics WHERE manga_id = ? AND lang = ? AND deleted_at IS NULL)",
+			recipient.Recipient(),
+			mangaID,
+			lang,
+		).
+		Update("status_alerts", enabled).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
+
+// SetSubscriptionPriority sets the position of the language among languages of the manga
+func (r *Repo) SetSubscriptionPriority(
+	ctx context.Context,
+	recipient domain.Recipient,
+	mangaID string,
+	lang string,
+	priority int,
+) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.SetSubscriptionPriority").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Str("manga_id", mangaID).
+			Str("lang", lang).
+			Int("priority", priority).
+			Send()
+	}(time.Now())
+
+	err := r.db.Model(&database.TopicSubscription{}).
+		Where(
+			"recipient = ? AND topic_id IN (SELECT id FROM topics WHERE manga_id = ? AND lang = ? AND deleted_at IS NULL)",
+			recipient.Recipient(),
+			mangaID,
+			lang,
+		).
+		Update("priority", priority).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
+
+func (r *Repo) SetFirstLanguageOnly(
+	ctx context.Context,
+	recipient domain.Recipient,
+	mangaID string,
+	enabled bool,
+) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.SetFirstLanguageOnly").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Str("manga_id", mangaID).
+			Bool("enabled", enabled).
+			Send()
+	}(time.Now())
+
+	err := r.db.Model(&database.TopicSubscription{}).
+		Where(
+			"recipient = ? AND topic_id IN (SELECT id FROM topics WHERE manga_id = ? AND deleted_at IS NULL)",
+			recipient.Recipient(),
+			mangaID,
+		).
+		Update("first_language_only", enabled).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
+
+// IsChapterNotifiedToRecipient checks if the chapter number has been notified to the recipient
+// in any language of the manga before the given time. The chapter with exceptChapterID is ignored.
+func (r *Repo) IsChapterNotifiedToRecipient(
+	ctx context.Context,
+	recipient domain.Recipient,
+	mangaID string,
+	chapter string,
+	exceptChapterID string,
+	before time.Time,
+) (bool, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.IsChapterNotifiedToRecipient").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Str("manga_id", mangaID).
+			Str("chapter", chapter).
+			Str("except_chapter_id", exceptChapterID).
+			Time("before", before).
+			Send()
+	}(time.Now())
+
+	var exists bool
+	err := r.db.Model(&database.NotifiedChapter{}).
+		Select("count(*) > 0").
+		Joins("JOIN topics ON topics.id = notified_chapters.topic_id AND topics.manga_id = ?", mangaID).
+		Joins(`JOIN topic_subscriptions ON topic_subscriptions.topic_id = topics.id
+			AND topic_subscriptions.recipient = ?
+			AND topic_subscriptions.deleted_at IS NULL
+			AND topic_subscriptions.created_at <= notified_chapters.created_at`, recipient.Recipient()).
+		Where("notified_chapters.chapter = ? AND notified_chapters.created_at < ?", chapter, before).
+		Where("notified_chapters.chapter_id <> ?", exceptChapterID).
+		Find(&exists).
+		Error
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	return exists, nil
+}
+
+func (r *Repo) DeleteAllSubscriptions(ctx context.Context, recipient domain.Recipient) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.DeleteAllSubscriptions").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Send()
+	}(time.Now())
+
+	err := r.db.Delete(
+		&database.TopicSubscription{},
+		"recipient = ?",
+		recipient.Recipient(),
+	).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	err = r.db.Delete(
+		&database.LanguageWatch{},
+		"recipient = ?",
+		recipient.Recipient(),
+	).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	// if there are no more subscriptions on this topic then remove the topic
+	err = r.db.Delete(
+		&database.Topic{},
+		"id IN (SELECT topic_id FROM topic_subscriptions GROUP BY topic_id HAVING EVERY(deleted_at IS NOT NULL))",
+	).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	return nil
+}
+
+func (r *Repo) AllSubscriptions(ctx context.Context) ([]domain.SubscriptionExtended, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.AllSubscriptions").Trace().
+			Dur("duration", time.Since(t)).
+			Send()
+	}(time.Now())
+
+	var topics []database.Topic
+	err := r.db.Preload("Subscriptions").Find(&topics).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	result := make([]domain.SubscriptionExtended, 0, len(topics))
+	for _, t := range topics {
+		recs := make([]domain.Recipient, 0, len(t.Subscriptions))
+		var alertRecs []domain.Recipient
+		firstLangOnly := map[domain.Recipient]int{}
+		for _, s := range t.Subscriptions {
+			recs = append(recs, domain.Recipient(s.Recipient))
+			if s.StatusAlerts {
+				alertRecs = append(alertRecs, domain.Recipient(s.Recipient))
+			}
+			if s.FirstLanguageOnly {
+				firstLangOnly[domain.Recipient(s.Recipient)] = s.Priority
+			}
+		}
+
+		result = append(result, domain.SubscriptionExtended{
+			Subscription: domain.Subscription{
+				MangaID:    t.MangaID,
+				MangaTitle: t.Title,
+				Language:   t.Lang,
+			},
+			UpdatedAt:         t.UpdatedAt,
+			Recipients:        recs,
+			AlertRecipients:   alertRecs,
+			FirstLanguageOnly: firstLangOnly,
+		})
+	}
+
+	return result, nil
+}
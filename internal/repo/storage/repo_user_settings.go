@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/database"
+	"github.com/neymee/mdexbot/internal/domain"
+	werrors "github.com/neymee/mdexbot/internal/errors"
+	"github.com/neymee/mdexbot/internal/log"
+	"gorm.io/gorm/clause"
+)
+
+// UserSettings returns nil if the recipient hasn't changed the default settings
+func (r *Repo) UserSettings(ctx context.Context, recipient domain.Recipient) (*domain.UserSettings, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.UserSettings").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Send()
+	}(time.Now())
+
+	var row database.UserSettings
+	res := r.db.Limit(1).Find(&row, "recipient = ?", recipient.Recipient())
+	if res.Error != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, res.Error)
+	} else if res.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	settings := userSettingsFromModel(row)
+	return &settings, nil
+}
+
+func (r *Repo) SetUserSettings(ctx context.Context, recipient domain.Recipient, settings domain.UserSettings) error {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.SetUserSettings").Trace().
+			Dur("duration", time.Since(t)).
+			Str("recipient", recipient.Recipient()).
+			Interface("settings", settings).
+			Send()
+	}(time.Now())
+
+	err := r.db.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "recipient"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"language", "time_zone", "sound", "digest_mode", "subscription_language", "updated_at",
+			}),
+		},
+	).Create(&database.UserSettings{
+		Recipient:            recipient.Recipient(),
+		Language:             settings.Language,
+		TimeZone:             settings.TimeZone,
+		Sound:                settings.Sound,
+		DigestMode:           settings.DigestMode,
+		SubscriptionLanguage: settings.SubscriptionLanguage,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+	return nil
+}
+
+// AllUserSettings returns settings of all recipients that have changed the default ones
+func (r *Repo) AllUserSettings(ctx context.Context) (map[domain.Recipient]domain.UserSettings, error) {
+	defer func(t time.Time) {
+		log.Log(ctx, "storage.AllUserSettings").Trace().
+			Dur("duration", time.Since(t)).
+			Send()
+	}(time.Now())
+
+	var rows []database.UserSettings
+	err := r.db.Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", werrors.DatabaseError, err)
+	}
+
+	result := make(map[domain.Recipient]domain.UserSettings, len(rows))
+	for _, row := range rows {
+		result[domain.Recipient(row.Recipient)] = userSettingsFromModel(row)
+	}
+
+	return result, nil
+}
+
+func userSettingsFromModel(row database.UserSettings) domain.UserSettings {
+	return domain.UserSettings{
+		Language:             row.Language,
+		TimeZone:             row.TimeZone,
+		Sound:                row.Sound,
+		DigestMode:           row.DigestMode,
+		SubscriptionLanguage: row.SubscriptionLanguage,
+	}
+}
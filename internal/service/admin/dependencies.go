@@ -0,0 +1,16 @@
+package admin
+
+import (
+	"context"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/domain"
+)
+
+type AdminRepo interface {
+	Stats(ctx context.Context, since time.Time) (domain.Stats, error)
+	Recipients(ctx context.Context) ([]domain.Recipient, error)
+	BlockedRecipients(ctx context.Context) ([]domain.Recipient, error)
+	BlockRecipient(ctx context.Context, recipient domain.Recipient) error
+	UnblockRecipient(ctx context.Context, recipient domain.Recipient) error
+}
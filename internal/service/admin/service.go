@@ -0,0 +1,71 @@
+package admin
+
+import (
+	"context"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/domain"
+)
+
+// StatsPeriod is a period notifications are counted for
+const StatsPeriod = 24 * time.Hour
+
+type Service interface {
+	Stats(ctx context.Context) (domain.Stats, error)
+	Recipients(ctx context.Context) ([]domain.Recipient, error)
+	Blocked(ctx context.Context) ([]domain.Recipient, error)
+	Block(ctx context.Context, recipient domain.Recipient) error
+	Unblock(ctx context.Context, recipient domain.Recipient) error
+}
+
+type service struct {
+	repo AdminRepo
+}
+
+func New(r AdminRepo) Service {
+	return &service{repo: r}
+}
+
+// Stats counts users and notifications sent during the last StatsPeriod
+func (s *service) Stats(ctx context.Context) (domain.Stats, error) {
+	return s.repo.Stats(ctx, time.Now().UTC().Add(-StatsPeriod))
+}
+
+// Recipients returns every recipient an announcement is sent to, blocked chats are excluded
+func (s *service) Recipients(ctx context.Context) ([]domain.Recipient, error) {
+	recipients, err := s.repo.Recipients(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	blocked, err := s.repo.BlockedRecipients(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	isBlocked := make(map[domain.Recipient]bool, len(blocked))
+	for _, rec := range blocked {
+		isBlocked[rec] = true
+	}
+
+	result := make([]domain.Recipient, 0, len(recipients))
+	for _, rec := range recipients {
+		if !isBlocked[rec] {
+			result = append(result, rec)
+		}
+	}
+	return result, nil
+}
+
+// Blocked returns chats the bot ignores
+func (s *service) Blocked(ctx context.Context) ([]domain.Recipient, error) {
+	return s.repo.BlockedRecipients(ctx)
+}
+
+func (s *service) Block(ctx context.Context, recipient domain.Recipient) error {
+	return s.repo.BlockRecipient(ctx, recipient)
+}
+
+func (s *service) Unblock(ctx context.Context, recipient domain.Recipient) error {
+	return s.repo.UnblockRecipient(ctx, recipient)
+}
@@ -0,0 +1,113 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type adminRepoMock struct {
+	mock.Mock
+}
+
+func (r *adminRepoMock) Stats(ctx context.Context, since time.Time) (domain.Stats, error) {
+	args := r.Called(ctx, since)
+	return args.Get(0).(domain.Stats), args.Error(1)
+}
+
+func (r *adminRepoMock) Recipients(ctx context.Context) ([]domain.Recipient, error) {
+	args := r.Called(ctx)
+	return args.Get(0).([]domain.Recipient), args.Error(1)
+}
+
+func (r *adminRepoMock) BlockedRecipients(ctx context.Context) ([]domain.Recipient, error) {
+	args := r.Called(ctx)
+	return args.Get(0).([]domain.Recipient), args.Error(1)
+}
+
+func (r *adminRepoMock) BlockRecipient(ctx context.Context, recipient domain.Recipient) error {
+	return r.Called(ctx, recipient).Error(0)
+}
+
+func (r *adminRepoMock) UnblockRecipient(ctx context.Context, recipient domain.Recipient) error {
+	return r.Called(ctx, recipient).Error(0)
+}
+
+func newRecipient() domain.Recipient {
+	return domain.RecipientFromInt64(rand.Int63())
+}
+
+func TestStats(t *testing.T) {
+	r := &adminRepoMock{}
+	s := New(r)
+
+	ctx := context.Background()
+	stats := domain.Stats{Recipients: 2, Subscriptions: 3, Topics: 3, Sent: 10, Failed: 1}
+	start := time.Now().UTC()
+
+	r.On("Stats", ctx, mock.AnythingOfType("time.Time")).Return(stats, nil).Once()
+	r.On("Stats", ctx, mock.AnythingOfType("time.Time")).Return(domain.Stats{}, fmt.Errorf("error")).Once()
+
+	res, err := s.Stats(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, stats, res)
+	since := r.Calls[0].Arguments.Get(1).(time.Time)
+	assert.WithinDuration(t, start.Add(-StatsPeriod), since, time.Second, "notifications of the last period expected")
+
+	_, err = s.Stats(ctx)
+	assert.Error(t, err, "error from repo.Stats expected")
+}
+
+func TestRecipients(t *testing.T) {
+	r := &adminRepoMock{}
+	s := New(r)
+
+	ctx := context.Background()
+	user1, user2, user3 := newRecipient(), newRecipient(), newRecipient()
+
+	r.On("Recipients", ctx).Return([]domain.Recipient{user1, user2, user3}, nil).Once()
+	r.On("BlockedRecipients", ctx).Return([]domain.Recipient{user2}, nil).Once()
+	r.On("Recipients", ctx).Return(([]domain.Recipient)(nil), fmt.Errorf("error")).Once()
+	r.On("Recipients", ctx).Return([]domain.Recipient{user1}, nil).Once()
+	r.On("BlockedRecipients", ctx).Return(([]domain.Recipient)(nil), fmt.Errorf("error")).Once()
+
+	res, err := s.Recipients(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Recipient{user1, user3}, res, "blocked recipients must be excluded")
+
+	_, err = s.Recipients(ctx)
+	assert.Error(t, err, "error from repo.Recipients expected")
+
+	_, err = s.Recipients(ctx)
+	assert.Error(t, err, "error from repo.BlockedRecipients expected")
+}
+
+func TestBlock(t *testing.T) {
+	r := &adminRepoMock{}
+	s := New(r)
+
+	ctx := context.Background()
+	user1, user2 := newRecipient(), newRecipient()
+
+	r.On("BlockRecipient", ctx, user1).Return(nil)
+	r.On("BlockRecipient", ctx, user2).Return(fmt.Errorf("error"))
+	r.On("UnblockRecipient", ctx, user1).Return(nil)
+	r.On("UnblockRecipient", ctx, user2).Return(fmt.Errorf("error"))
+	r.On("BlockedRecipients", ctx).Return([]domain.Recipient{user1}, nil)
+
+	assert.NoError(t, s.Block(ctx, user1))
+	assert.Error(t, s.Block(ctx, user2), "error from repo.BlockRecipient expected")
+
+	blocked, err := s.Blocked(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Recipient{user1}, blocked)
+
+	assert.NoError(t, s.Unblock(ctx, user1))
+	assert.Error(t, s.Unblock(ctx, user2), "error from repo.UnblockRecipient expected")
+}
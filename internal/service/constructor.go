@@ -1,22 +1,35 @@
 package service
 
 import (
+	"github.com/neymee/mdexbot/internal/service/admin"
 	"github.com/neymee/mdexbot/internal/service/conversation"
+	"github.com/neymee/mdexbot/internal/service/outbox"
+	"github.com/neymee/mdexbot/internal/service/settings"
 	"github.com/neymee/mdexbot/internal/service/subscription"
 )
 
 type Services struct {
 	Subscription subscription.Service
 	Conversation conversation.Service
+	Outbox       outbox.Service
+	Settings     settings.Service
+	Admin        admin.Service
 }
 
 func New(
 	mdexAPI subscription.MangaDexAPI,
 	subRepo subscription.SubscriptionRepo,
 	convRepo conversation.ConversationRepo,
+	outboxRepo outbox.OutboxRepo,
+	settingsRepo settings.SettingsRepo,
+	adminRepo admin.AdminRepo,
+	subOpts ...subscription.Option,
 ) *Services {
 	return &Services{
-		Subscription: subscription.New(mdexAPI, subRepo),
+		Subscription: subscription.New(mdexAPI, subRepo, subOpts...),
 		Conversation: conversation.New(convRepo),
+		Outbox:       outbox.New(outboxRepo),
+		Settings:     settings.New(settingsRepo),
+		Admin:        admin.New(adminRepo),
 	}
 }
@@ -2,12 +2,17 @@ package conversation
 
 import (
 	"context"
+	"time"
 
 	"github.com/neymee/mdexbot/internal/domain"
 )
 
 type ConversationRepo interface {
-	ConversationContext(ctx context.Context, recipient domain.Recipient) (string, error)
-	SetConversationContext(ctx context.Context, recipient domain.Recipient, cmd string) error
-	DeleteConversationContext(ctx context.Context, recipient domain.Recipient) error
+	Conversation(ctx context.Context, recipient domain.Recipient) (*domain.Conversation, error)
+	SetConversation(ctx context.Context, recipient domain.Recipient, conv domain.Conversation) error
+	DeleteConversation(ctx context.Context, recipient domain.Recipient) error
+	DeleteExpiredConversations(ctx context.Context, before time.Time) (int64, error)
+	ManagedChat(ctx context.Context, recipient domain.Recipient) (*domain.ManagedChat, error)
+	SetManagedChat(ctx context.Context, recipient domain.Recipient, chat domain.ManagedChat) error
+	DeleteManagedChat(ctx context.Context, recipient domain.Recipient) error
 }
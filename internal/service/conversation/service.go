@@ -2,14 +2,30 @@ package conversation
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/neymee/mdexbot/internal/domain"
 )
 
+// DefaultTTL is used for states registered without a time to live
+const DefaultTTL = 30 * time.Minute
+
 type Service interface {
-	ConversationContext(ctx context.Context, recipient domain.Recipient) (string, error)
-	SetConversationContext(ctx context.Context, recipient domain.Recipient, cmd string) error
-	DeleteConversationContext(ctx context.Context, recipient domain.Recipient) error
+	Conversation(ctx context.Context, recipient domain.Recipient) (*domain.Conversation, error)
+	SetConversation(
+		ctx context.Context,
+		recipient domain.Recipient,
+		state domain.ConversationState,
+		payload any,
+		ttl time.Duration,
+	) error
+	DeleteConversation(ctx context.Context, recipient domain.Recipient) error
+	DeleteExpiredConversations(ctx context.Context) (int64, error)
+	ManagedChat(ctx context.Context, recipient domain.Recipient) (*domain.ManagedChat, error)
+	SetManagedChat(ctx context.Context, recipient domain.Recipient, chat domain.ManagedChat) error
+	DeleteManagedChat(ctx context.Context, recipient domain.Recipient) error
 }
 
 type service struct {
@@ -20,14 +36,70 @@ func New(r ConversationRepo) Service {
 	return &service{repo: r}
 }
 
-func (s *service) ConversationContext(ctx context.Context, recipient domain.Recipient) (string, error) {
-	return s.repo.ConversationContext(ctx, recipient)
+// Conversation returns the command in progress or nil if there is none.
+// An expired conversation is deleted and nil is returned.
+func (s *service) Conversation(ctx context.Context, recipient domain.Recipient) (*domain.Conversation, error) {
+	conv, err := s.repo.Conversation(ctx, recipient)
+	if err != nil || conv == nil {
+		return nil, err
+	}
+
+	if conv.Expired(time.Now().UTC()) {
+		err = s.repo.DeleteConversation(ctx, recipient)
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return conv, nil
+}
+
+// SetConversation moves the recipient to the state, the payload is encoded as JSON.
+// The conversation expires after the ttl unless the state is changed.
+func (s *service) SetConversation(
+	ctx context.Context,
+	recipient domain.Recipient,
+	state domain.ConversationState,
+	payload any,
+	ttl time.Duration,
+) error {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	conv := domain.Conversation{
+		State:     state,
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	}
+	if payload != nil {
+		var err error
+		conv.Payload, err = json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("encoding payload of %q: %w", state, err)
+		}
+	}
+
+	return s.repo.SetConversation(ctx, recipient, conv)
+}
+
+func (s *service) DeleteConversation(ctx context.Context, recipient domain.Recipient) error {
+	return s.repo.DeleteConversation(ctx, recipient)
+}
+
+// DeleteExpiredConversations forgets commands users didn't finish in time and returns their number
+func (s *service) DeleteExpiredConversations(ctx context.Context) (int64, error) {
+	return s.repo.DeleteExpiredConversations(ctx, time.Now().UTC())
+}
+
+// ManagedChat returns a channel the recipient manages or nil if commands are applied to the recipient itself
+func (s *service) ManagedChat(ctx context.Context, recipient domain.Recipient) (*domain.ManagedChat, error) {
+	return s.repo.ManagedChat(ctx, recipient)
 }
 
-func (s *service) SetConversationContext(ctx context.Context, recipient domain.Recipient, cmd string) error {
-	return s.repo.SetConversationContext(ctx, recipient, cmd)
+func (s *service) SetManagedChat(ctx context.Context, recipient domain.Recipient, chat domain.ManagedChat) error {
+	return s.repo.SetManagedChat(ctx, recipient, chat)
 }
 
-func (s *service) DeleteConversationContext(ctx context.Context, recipient domain.Recipient) error {
-	return s.repo.DeleteConversationContext(ctx, recipient)
+func (s *service) DeleteManagedChat(ctx context.Context, recipient domain.Recipient) error {
+	return s.repo.DeleteManagedChat(ctx, recipient)
 }
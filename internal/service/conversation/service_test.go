@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/neymee/mdexbot/internal/domain"
 	"github.com/stretchr/testify/assert"
@@ -15,16 +16,34 @@ type convRepoMock struct {
 	mock.Mock
 }
 
-func (r *convRepoMock) ConversationContext(ctx context.Context, recipient domain.Recipient) (string, error) {
+func (r *convRepoMock) Conversation(ctx context.Context, recipient domain.Recipient) (*domain.Conversation, error) {
 	args := r.Called(ctx, recipient)
-	return args.String(0), args.Error(1)
+	return args.Get(0).(*domain.Conversation), args.Error(1)
 }
 
-func (r *convRepoMock) SetConversationContext(ctx context.Context, recipient domain.Recipient, cmd string) error {
-	return r.Called(ctx, recipient, cmd).Error(0)
+func (r *convRepoMock) SetConversation(ctx context.Context, recipient domain.Recipient, conv domain.Conversation) error {
+	return r.Called(ctx, recipient, conv).Error(0)
 }
 
-func (r *convRepoMock) DeleteConversationContext(ctx context.Context, recipient domain.Recipient) error {
+func (r *convRepoMock) DeleteConversation(ctx context.Context, recipient domain.Recipient) error {
+	return r.Called(ctx, recipient).Error(0)
+}
+
+func (r *convRepoMock) DeleteExpiredConversations(ctx context.Context, before time.Time) (int64, error) {
+	args := r.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (r *convRepoMock) ManagedChat(ctx context.Context, recipient domain.Recipient) (*domain.ManagedChat, error) {
+	args := r.Called(ctx, recipient)
+	return args.Get(0).(*domain.ManagedChat), args.Error(1)
+}
+
+func (r *convRepoMock) SetManagedChat(ctx context.Context, recipient domain.Recipient, chat domain.ManagedChat) error {
+	return r.Called(ctx, recipient, chat).Error(0)
+}
+
+func (r *convRepoMock) DeleteManagedChat(ctx context.Context, recipient domain.Recipient) error {
 	return r.Called(ctx, recipient).Error(0)
 }
 
@@ -32,54 +51,160 @@ func newRecipient() domain.Recipient {
 	return domain.RecipientFromInt64(rand.Int63())
 }
 
-func TestConversationContext(t *testing.T) {
+func TestConversation(t *testing.T) {
+	r := &convRepoMock{}
+	s := New(r)
+
+	ctx := context.Background()
+	user1, user2, user3, user4, user5 := newRecipient(), newRecipient(), newRecipient(), newRecipient(), newRecipient()
+	active := &domain.Conversation{State: "test", ExpiresAt: time.Now().Add(time.Hour)}
+	expired := &domain.Conversation{State: "test", ExpiresAt: time.Now().Add(-time.Minute)}
+
+	r.On("Conversation", ctx, user1).Return(active, nil)
+	r.On("Conversation", ctx, user2).Return((*domain.Conversation)(nil), nil)
+	r.On("Conversation", ctx, user3).Return((*domain.Conversation)(nil), fmt.Errorf("error"))
+	r.On("Conversation", ctx, user4).Return(expired, nil)
+	r.On("Conversation", ctx, user5).Return(expired, nil)
+	r.On("DeleteConversation", ctx, user4).Return(nil)
+	r.On("DeleteConversation", ctx, user5).Return(fmt.Errorf("error"))
+
+	conv1, err1 := s.Conversation(ctx, user1)
+	assert.NoError(t, err1)
+	assert.Equal(t, active, conv1)
+
+	conv2, err2 := s.Conversation(ctx, user2)
+	assert.NoError(t, err2)
+	assert.Nil(t, conv2)
+
+	_, err3 := s.Conversation(ctx, user3)
+	assert.Error(t, err3, "error from repo.Conversation expected")
+
+	conv4, err4 := s.Conversation(ctx, user4)
+	assert.NoError(t, err4)
+	assert.Nil(t, conv4, "expired conversation must be forgotten")
+	r.AssertCalled(t, "DeleteConversation", ctx, user4)
+
+	_, err5 := s.Conversation(ctx, user5)
+	assert.Error(t, err5, "error from repo.DeleteConversation expected")
+}
+
+func TestSetConversation(t *testing.T) {
+	r := &convRepoMock{}
+	s := New(r)
+
+	ctx := context.Background()
+	user1, user2, user3 := newRecipient(), newRecipient(), newRecipient()
+
+	type payload struct {
+		MangaID string `json:"manga_id"`
+	}
+
+	var saved domain.Conversation
+	r.On("SetConversation", ctx, user1, mock.Anything).
+		Run(func(args mock.Arguments) { saved = args.Get(2).(domain.Conversation) }).
+		Return(nil)
+	r.On("SetConversation", ctx, user2, mock.Anything).Return(nil)
+	r.On("SetConversation", ctx, user3, mock.Anything).Return(fmt.Errorf("error"))
+
+	start := time.Now().UTC()
+	err1 := s.SetConversation(ctx, user1, "test:step", payload{MangaID: "id"}, time.Hour)
+	assert.NoError(t, err1)
+	assert.Equal(t, domain.ConversationState("test:step"), saved.State)
+	assert.Equal(t, "test", saved.State.Command())
+	assert.WithinDuration(t, start.Add(time.Hour), saved.ExpiresAt, time.Second)
+
+	var decoded payload
+	assert.NoError(t, saved.Decode(&decoded))
+	assert.Equal(t, "id", decoded.MangaID)
+
+	err2 := s.SetConversation(ctx, user2, "test", nil, 0)
+	assert.NoError(t, err2)
+	saved2 := r.Calls[len(r.Calls)-1].Arguments.Get(2).(domain.Conversation)
+	assert.Empty(t, saved2.Payload)
+	assert.WithinDuration(t, start.Add(DefaultTTL), saved2.ExpiresAt, time.Second, "default ttl expected")
+
+	err3 := s.SetConversation(ctx, user3, "test", nil, time.Hour)
+	assert.Error(t, err3, "error from repo.SetConversation expected")
+
+	err4 := s.SetConversation(ctx, user3, "test", func() {}, time.Hour)
+	assert.Error(t, err4, "payload encoding error expected")
+}
+
+func TestDeleteConversation(t *testing.T) {
 	r := &convRepoMock{}
 	s := New(r)
 
 	ctx := context.Background()
 	user1, user2 := newRecipient(), newRecipient()
 
-	r.On("ConversationContext", ctx, user1).Return("test", nil)
-	r.On("ConversationContext", ctx, user2).Return("", fmt.Errorf("error"))
+	r.On("DeleteConversation", ctx, user1).Return(nil)
+	r.On("DeleteConversation", ctx, user2).Return(fmt.Errorf("error"))
 
-	conv, err1 := s.ConversationContext(ctx, user1)
+	err1 := s.DeleteConversation(ctx, user1)
 	assert.NoError(t, err1)
-	assert.Equal(t, "test", conv)
 
-	_, err2 := s.ConversationContext(ctx, user2)
-	assert.Error(t, err2, "error from repo.ConversationContext expected")
+	err2 := s.DeleteConversation(ctx, user2)
+	assert.Error(t, err2, "error from repo.DeleteConversation expected")
 }
 
-func TestSetConversationContext(t *testing.T) {
+func TestDeleteExpiredConversations(t *testing.T) {
 	r := &convRepoMock{}
 	s := New(r)
 
 	ctx := context.Background()
-	user := newRecipient()
+	start := time.Now().UTC()
 
-	r.On("SetConversationContext", ctx, user, "test1").Return(nil)
-	r.On("SetConversationContext", ctx, user, "test2").Return(fmt.Errorf("error"))
+	r.On("DeleteExpiredConversations", ctx, mock.AnythingOfType("time.Time")).Return(int64(2), nil).Once()
+	r.On("DeleteExpiredConversations", ctx, mock.AnythingOfType("time.Time")).Return(int64(0), fmt.Errorf("error")).Once()
 
-	err1 := s.SetConversationContext(ctx, user, "test1")
+	n, err1 := s.DeleteExpiredConversations(ctx)
 	assert.NoError(t, err1)
+	assert.Equal(t, int64(2), n)
+	assert.WithinDuration(t, start, r.Calls[0].Arguments.Get(1).(time.Time), time.Second)
 
-	err2 := s.SetConversationContext(ctx, user, "test2")
-	assert.Error(t, err2, "error from repo.SetConversationContext expected")
+	_, err2 := s.DeleteExpiredConversations(ctx)
+	assert.Error(t, err2, "error from repo.DeleteExpiredConversations expected")
 }
 
-func TestDeleteConversationContext(t *testing.T) {
+func TestManagedChat(t *testing.T) {
 	r := &convRepoMock{}
 	s := New(r)
 
 	ctx := context.Background()
-	user1, user2 := newRecipient(), newRecipient()
+	user1, user2, user3 := newRecipient(), newRecipient(), newRecipient()
+	chat := &domain.ManagedChat{Chat: newRecipient(), Title: "channel"}
 
-	r.On("DeleteConversationContext", ctx, user1).Return(nil)
-	r.On("DeleteConversationContext", ctx, user2).Return(fmt.Errorf("error"))
+	r.On("ManagedChat", ctx, user1).Return(chat, nil)
+	r.On("ManagedChat", ctx, user2).Return((*domain.ManagedChat)(nil), nil)
+	r.On("ManagedChat", ctx, user3).Return((*domain.ManagedChat)(nil), fmt.Errorf("error"))
 
-	err1 := s.DeleteConversationContext(ctx, user1)
+	res1, err1 := s.ManagedChat(ctx, user1)
 	assert.NoError(t, err1)
+	assert.Equal(t, chat, res1)
+
+	res2, err2 := s.ManagedChat(ctx, user2)
+	assert.NoError(t, err2)
+	assert.Nil(t, res2)
+
+	_, err3 := s.ManagedChat(ctx, user3)
+	assert.Error(t, err3, "error from repo.ManagedChat expected")
+}
+
+func TestSetManagedChat(t *testing.T) {
+	r := &convRepoMock{}
+	s := New(r)
+
+	ctx := context.Background()
+	user1, user2 := newRecipient(), newRecipient()
+	chat := domain.ManagedChat{Chat: newRecipient(), Title: "channel"}
+
+	r.On("SetManagedChat", ctx, user1, chat).Return(nil)
+	r.On("SetManagedChat", ctx, user2, chat).Return(fmt.Errorf("error"))
+	r.On("DeleteManagedChat", ctx, user1).Return(nil)
+	r.On("DeleteManagedChat", ctx, user2).Return(fmt.Errorf("error"))
 
-	err2 := s.DeleteConversationContext(ctx, user2)
-	assert.Error(t, err2, "error from repo.DeleteConversationContext expected")
+	assert.NoError(t, s.SetManagedChat(ctx, user1, chat))
+	assert.Error(t, s.SetManagedChat(ctx, user2, chat), "error from repo.SetManagedChat expected")
+	assert.NoError(t, s.DeleteManagedChat(ctx, user1))
+	assert.Error(t, s.DeleteManagedChat(ctx, user2), "error from repo.DeleteManagedChat expected")
 }
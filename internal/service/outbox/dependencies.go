@@ -0,0 +1,23 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/domain"
+)
+
+type OutboxRepo interface {
+	PendingDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.Delivery, error)
+	SetDeliverySent(ctx context.Context, id uint, sentAt time.Time) error
+	SetDeliveryFailed(ctx context.Context, id uint, reason string, nextAttemptAt *time.Time) error
+	DeleteDeliveries(ctx context.Context, before time.Time) error
+	NotificationMessage(ctx context.Context, recipient domain.Recipient, topicID uint) (*domain.NotificationMessage, error)
+	SetNotificationMessage(
+		ctx context.Context,
+		recipient domain.Recipient,
+		topicID uint,
+		msg domain.NotificationMessage,
+	) error
+	DeleteNotificationMessages(ctx context.Context, before time.Time) error
+}
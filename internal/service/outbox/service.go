@@ -0,0 +1,108 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/domain"
+)
+
+const (
+	// BatchSize is a max number of deliveries returned by Pending at once,
+	// only the rest of a digest in the batch may exceed it
+	BatchSize = 100
+	// MaxAttempts is a number of failed attempts after which the delivery is given up
+	MaxAttempts = 10
+	// RetryDelay is a delay before the first retry, it's doubled on every next attempt
+	RetryDelay = time.Minute
+	// MaxRetryDelay limits the delay between attempts
+	MaxRetryDelay = time.Hour * 6
+	// Retention is a time sent and failed deliveries are kept for
+	Retention = time.Hour * 24 * 7
+)
+
+type Service interface {
+	Pending(ctx context.Context) ([]domain.Delivery, error)
+	Sent(ctx context.Context, d domain.Delivery) error
+	Failed(ctx context.Context, d domain.Delivery, reason error, retry bool) error
+	Cleanup(ctx context.Context) error
+	LastMessage(ctx context.Context, d domain.Delivery, window time.Duration) (*domain.NotificationMessage, error)
+	SetLastMessage(ctx context.Context, d domain.Delivery, msg domain.NotificationMessage) error
+}
+
+type service struct {
+	repo OutboxRepo
+}
+
+func New(r OutboxRepo) Service {
+	return &service{repo: r}
+}
+
+// Pending returns deliveries which are due to be sent
+func (s *service) Pending(ctx context.Context) ([]domain.Delivery, error) {
+	return s.repo.PendingDeliveries(ctx, time.Now().UTC(), BatchSize)
+}
+
+func (s *service) Sent(ctx context.Context, d domain.Delivery) error {
+	return s.repo.SetDeliverySent(ctx, d.ID, time.Now().UTC())
+}
+
+// Failed schedules the next attempt with exponential backoff.
+// The delivery is given up if retry is false or attempts are exhausted.
+func (s *service) Failed(ctx context.Context, d domain.Delivery, reason error, retry bool) error {
+	attempts := d.Attempts + 1
+
+	var next *time.Time
+	if retry && attempts < MaxAttempts {
+		t := time.Now().UTC().Add(retryDelay(attempts))
+		next = &t
+	}
+
+	return s.repo.SetDeliveryFailed(ctx, d.ID, reason.Error(), next)
+}
+
+// Cleanup removes sent and failed deliveries and notification messages older than Retention
+func (s *service) Cleanup(ctx context.Context) error {
+	before := time.Now().UTC().Add(-Retention)
+
+	err := s.repo.DeleteDeliveries(ctx, before)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.DeleteNotificationMessages(ctx, before)
+}
+
+// LastMessage returns the message about the delivery topic sent to the recipient within the window.
+// Returns nil if there is no such message.
+func (s *service) LastMessage(
+	ctx context.Context,
+	d domain.Delivery,
+	window time.Duration,
+) (*domain.NotificationMessage, error) {
+	msg, err := s.repo.NotificationMessage(ctx, d.Recipient, d.TopicID)
+	if err != nil || msg == nil {
+		return nil, err
+	}
+
+	if time.Since(msg.SentAt) > window {
+		return nil, nil
+	}
+	return msg, nil
+}
+
+// SetLastMessage remembers the message listing chapters of the delivery topic
+func (s *service) SetLastMessage(ctx context.Context, d domain.Delivery, msg domain.NotificationMessage) error {
+	return s.repo.SetNotificationMessage(ctx, d.Recipient, d.TopicID, msg)
+}
+
+func retryDelay(attempts int) time.Duration {
+	delay := RetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= MaxRetryDelay {
+			return MaxRetryDelay
+		}
+	}
+	return delay
+}
@@ -0,0 +1,157 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type outboxRepoMock struct {
+	mock.Mock
+}
+
+func (r *outboxRepoMock) PendingDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.Delivery, error) {
+	args := r.Called(ctx, now, limit)
+	return args.Get(0).([]domain.Delivery), args.Error(1)
+}
+
+func (r *outboxRepoMock) SetDeliverySent(ctx context.Context, id uint, sentAt time.Time) error {
+	return r.Called(ctx, id, sentAt).Error(0)
+}
+
+func (r *outboxRepoMock) SetDeliveryFailed(ctx context.Context, id uint, reason string, nextAttemptAt *time.Time) error {
+	return r.Called(ctx, id, reason, nextAttemptAt).Error(0)
+}
+
+func (r *outboxRepoMock) DeleteDeliveries(ctx context.Context, before time.Time) error {
+	return r.Called(ctx, before).Error(0)
+}
+
+func (r *outboxRepoMock) NotificationMessage(
+	ctx context.Context,
+	recipient domain.Recipient,
+	topicID uint,
+) (*domain.NotificationMessage, error) {
+	args := r.Called(ctx, recipient, topicID)
+	return args.Get(0).(*domain.NotificationMessage), args.Error(1)
+}
+
+func (r *outboxRepoMock) SetNotificationMessage(
+	ctx context.Context,
+	recipient domain.Recipient,
+	topicID uint,
+	msg domain.NotificationMessage,
+) error {
+	return r.Called(ctx, recipient, topicID, msg).Error(0)
+}
+
+func (r *outboxRepoMock) DeleteNotificationMessages(ctx context.Context, before time.Time) error {
+	return r.Called(ctx, before).Error(0)
+}
+
+func newDelivery(attempts int) domain.Delivery {
+	return domain.Delivery{
+		ID:        uint(rand.Uint32()),
+		TopicID:   uint(rand.Uint32()),
+		Recipient: domain.RecipientFromInt64(rand.Int63()),
+		Attempts:  attempts,
+	}
+}
+
+func TestPending(t *testing.T) {
+	ctx := context.Background()
+	exp := []domain.Delivery{newDelivery(0), newDelivery(2)}
+
+	repo := &outboxRepoMock{}
+	repo.On("PendingDeliveries", ctx, mock.Anything, BatchSize).Return(exp, nil)
+
+	s := New(repo)
+
+	res, err := s.Pending(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, exp, res)
+	repo.AssertExpectations(t)
+}
+
+func TestFailed(t *testing.T) {
+	ctx := context.Background()
+	reason := fmt.Errorf("error")
+
+	retried, notRetried, exhausted := newDelivery(0), newDelivery(0), newDelivery(MaxAttempts-1)
+
+	repo := &outboxRepoMock{}
+	repo.On("SetDeliveryFailed", ctx, retried.ID, reason.Error(), mock.MatchedBy(func(next *time.Time) bool {
+		return next != nil && next.After(time.Now())
+	})).Return(nil)
+	repo.On("SetDeliveryFailed", ctx, notRetried.ID, reason.Error(), (*time.Time)(nil)).Return(nil)
+	repo.On("SetDeliveryFailed", ctx, exhausted.ID, reason.Error(), (*time.Time)(nil)).Return(fmt.Errorf("error"))
+
+	s := New(repo)
+
+	assert.NoError(t, s.Failed(ctx, retried, reason, true))
+	assert.NoError(t, s.Failed(ctx, notRetried, reason, false))
+	assert.Error(t, s.Failed(ctx, exhausted, reason, true), "error from storage.SetDeliveryFailed expected")
+	repo.AssertExpectations(t)
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, RetryDelay, retryDelay(1))
+	assert.Equal(t, RetryDelay*2, retryDelay(2))
+	assert.Equal(t, RetryDelay*8, retryDelay(4))
+	assert.Equal(t, MaxRetryDelay, retryDelay(MaxAttempts))
+}
+
+func TestLastMessage(t *testing.T) {
+	ctx := context.Background()
+	window := time.Hour
+
+	recent, old, none, failed := newDelivery(0), newDelivery(0), newDelivery(0), newDelivery(0)
+	recentMsg := &domain.NotificationMessage{MessageID: 1, SentAt: time.Now().Add(-window / 2)}
+	oldMsg := &domain.NotificationMessage{MessageID: 2, SentAt: time.Now().Add(-window * 2)}
+
+	repo := &outboxRepoMock{}
+	repo.On("NotificationMessage", ctx, recent.Recipient, recent.TopicID).Return(recentMsg, nil)
+	repo.On("NotificationMessage", ctx, old.Recipient, old.TopicID).Return(oldMsg, nil)
+	repo.On("NotificationMessage", ctx, none.Recipient, none.TopicID).Return((*domain.NotificationMessage)(nil), nil)
+	repo.On("NotificationMessage", ctx, failed.Recipient, failed.TopicID).
+		Return((*domain.NotificationMessage)(nil), fmt.Errorf("error"))
+
+	s := New(repo)
+
+	res, err := s.LastMessage(ctx, recent, window)
+	assert.NoError(t, err)
+	assert.Equal(t, recentMsg, res)
+
+	res, err = s.LastMessage(ctx, old, window)
+	assert.NoError(t, err)
+	assert.Nil(t, res, "the message sent out of the window must not be returned")
+
+	res, err = s.LastMessage(ctx, none, window)
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+
+	_, err = s.LastMessage(ctx, failed, window)
+	assert.Error(t, err, "error from storage.NotificationMessage expected")
+	repo.AssertExpectations(t)
+}
+
+func TestCleanup(t *testing.T) {
+	ctx := context.Background()
+
+	repo := &outboxRepoMock{}
+	repo.On("DeleteDeliveries", ctx, mock.Anything).Return(nil).Once()
+	repo.On("DeleteNotificationMessages", ctx, mock.Anything).Return(nil).Once()
+
+	s := New(repo)
+	assert.NoError(t, s.Cleanup(ctx))
+
+	repo.On("DeleteDeliveries", ctx, mock.Anything).Return(fmt.Errorf("error")).Once()
+	assert.Error(t, s.Cleanup(ctx), "error from storage.DeleteDeliveries expected")
+	repo.AssertExpectations(t)
+}
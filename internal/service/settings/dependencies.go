@@ -0,0 +1,12 @@
+package settings
+
+import (
+	"context"
+
+	"github.com/neymee/mdexbot/internal/domain"
+)
+
+type SettingsRepo interface {
+	UserSettings(ctx context.Context, recipient domain.Recipient) (*domain.UserSettings, error)
+	SetUserSettings(ctx context.Context, recipient domain.Recipient, settings domain.UserSettings) error
+}
@@ -0,0 +1,8 @@
+package settings
+
+import "fmt"
+
+var (
+	ErrInvalidTimeZone   = fmt.Errorf("invalid time zone")
+	ErrInvalidDigestMode = fmt.Errorf("invalid digest mode")
+)
@@ -0,0 +1,50 @@
+package settings
+
+import (
+	"context"
+	"time"
+	// time zones are available even if the system has no tz database
+	_ "time/tzdata"
+
+	"github.com/neymee/mdexbot/internal/domain"
+)
+
+type Service interface {
+	Settings(ctx context.Context, recipient domain.Recipient) (domain.UserSettings, error)
+	SetSettings(ctx context.Context, recipient domain.Recipient, settings domain.UserSettings) error
+}
+
+type service struct {
+	repo SettingsRepo
+}
+
+func New(r SettingsRepo) Service {
+	return &service{repo: r}
+}
+
+// Settings returns the recipient's settings or the defaults if they have never been changed
+func (s *service) Settings(ctx context.Context, recipient domain.Recipient) (domain.UserSettings, error) {
+	settings, err := s.repo.UserSettings(ctx, recipient)
+	if err != nil {
+		return domain.UserSettings{}, err
+	} else if settings == nil {
+		return domain.DefaultUserSettings(), nil
+	}
+	return *settings, nil
+}
+
+func (s *service) SetSettings(ctx context.Context, recipient domain.Recipient, settings domain.UserSettings) error {
+	if _, err := time.LoadLocation(settings.TimeZone); err != nil || settings.TimeZone == "" {
+		return ErrInvalidTimeZone
+	}
+
+	validMode := false
+	for _, mode := range domain.DigestModes {
+		validMode = validMode || mode == settings.DigestMode
+	}
+	if !validMode {
+		return ErrInvalidDigestMode
+	}
+
+	return s.repo.SetUserSettings(ctx, recipient, settings)
+}
@@ -0,0 +1,82 @@
+package settings
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/neymee/mdexbot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type settingsRepoMock struct {
+	mock.Mock
+}
+
+func (r *settingsRepoMock) UserSettings(ctx context.Context, recipient domain.Recipient) (*domain.UserSettings, error) {
+	args := r.Called(ctx, recipient)
+	return args.Get(0).(*domain.UserSettings), args.Error(1)
+}
+
+func (r *settingsRepoMock) SetUserSettings(
+	ctx context.Context,
+	recipient domain.Recipient,
+	settings domain.UserSettings,
+) error {
+	return r.Called(ctx, recipient, settings).Error(0)
+}
+
+func newRecipient() domain.Recipient {
+	return domain.RecipientFromInt64(rand.Int63())
+}
+
+func TestSettings(t *testing.T) {
+	r := &settingsRepoMock{}
+	s := New(r)
+
+	ctx := context.Background()
+	user1, user2, user3 := newRecipient(), newRecipient(), newRecipient()
+	saved := domain.UserSettings{TimeZone: "Europe/Berlin", Sound: true, DigestMode: domain.DigestDaily}
+
+	r.On("UserSettings", ctx, user1).Return(&saved, nil)
+	r.On("UserSettings", ctx, user2).Return((*domain.UserSettings)(nil), nil)
+	r.On("UserSettings", ctx, user3).Return((*domain.UserSettings)(nil), fmt.Errorf("error"))
+
+	settings, err := s.Settings(ctx, user1)
+	assert.NoError(t, err)
+	assert.Equal(t, saved, settings)
+
+	settings, err = s.Settings(ctx, user2)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.DefaultUserSettings(), settings, "defaults expected for a new user")
+
+	_, err = s.Settings(ctx, user3)
+	assert.Error(t, err, "error from repo.UserSettings expected")
+}
+
+func TestSetSettings(t *testing.T) {
+	r := &settingsRepoMock{}
+	s := New(r)
+
+	ctx := context.Background()
+	user := newRecipient()
+	valid := domain.UserSettings{TimeZone: "Asia/Tokyo", DigestMode: domain.DigestHourly}
+
+	r.On("SetUserSettings", ctx, user, valid).Return(nil)
+
+	err := s.SetSettings(ctx, user, valid)
+	assert.NoError(t, err)
+
+	err = s.SetSettings(ctx, user, domain.UserSettings{TimeZone: "Mars/Olympus", DigestMode: domain.DigestOff})
+	assert.ErrorIs(t, err, ErrInvalidTimeZone)
+
+	err = s.SetSettings(ctx, user, domain.UserSettings{TimeZone: "", DigestMode: domain.DigestOff})
+	assert.ErrorIs(t, err, ErrInvalidTimeZone)
+
+	err = s.SetSettings(ctx, user, domain.UserSettings{TimeZone: "UTC", DigestMode: "weekly"})
+	assert.ErrorIs(t, err, ErrInvalidDigestMode)
+
+	r.AssertExpectations(t)
+}
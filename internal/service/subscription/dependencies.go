@@ -1,42 +1,102 @@
-package subscription
-
-import (
-	"context"
-	"time"
-
-	"github.com/neymee/mdexbot/internal/domain"
-)
-
-type MangaDexAPI interface {
-	Manga(ctx context.Context, id string) (domain.Manga, error)
-	LastChapters(
-		ctx context.Context,
-		mangaID string,
-		lang *string,
-		publishedSince *time.Time,
-	) ([]domain.Chapter, error)
-}
-
-type SubscriptionRepo interface {
-	UserSubscriptions(ctx context.Context, recipient domain.Recipient) ([]domain.Subscription, error)
-	SetUserSubscription(
-		ctx context.Context,
-		recipient domain.Recipient,
-		sub domain.Subscription,
-	) error
-	DeleteUserSubscription(
-		ctx context.Context,
-		recipient domain.Recipient,
-		mangaID string,
-		lang string,
-	) error
-	AllSubscriptions(ctx context.Context) ([]domain.SubscriptionExtended, error)
-	SetSubscriptionLastUpdate(
-		ctx context.Context,
-		sub domain.Subscription,
-		updatedAt time.Time,
-		chapters ...domain.Chapter,
-	) error
-	IsChapterNotified(ctx context.Context, sub domain.Subscription, chapter domain.Chapter) (bool, error)
-	DeleteAllSubscriptions(context.Context, domain.Recipient) error
-}
+package subscription
+
+import (
+	"context"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/domain"
+)
+
+type MangaDexAPI interface {
+	Manga(ctx context.Context, id string) (domain.Manga, error)
+	LastChapters(
+		ctx context.Context,
+		mangaID string,
+		lang *string,
+		publishedSince *time.Time,
+	) ([]domain.Chapter, error)
+	ChapterPublished(
+		ctx context.Context,
+		mangaID string,
+		lang *string,
+		volume string,
+		chapter string,
+	) (bool, error)
+}
+
+type SubscriptionRepo interface {
+	UserSubscriptions(ctx context.Context, recipient domain.Recipient) ([]domain.Subscription, error)
+	SetUserSubscription(
+		ctx context.Context,
+		recipient domain.Recipient,
+		sub domain.Subscription,
+	) error
+	DeleteUserSubscription(
+		ctx context.Context,
+		recipient domain.Recipient,
+		mangaID string,
+		lang string,
+	) error
+	AllSubscriptions(ctx context.Context) ([]domain.SubscriptionExtended, error)
+	SetSubscriptionLastUpdate(
+		ctx context.Context,
+		sub domain.Subscription,
+		updatedAt time.Time,
+		chapters []domain.Chapter,
+		released []domain.Chapter,
+		deliveries []domain.Delivery,
+	) error
+	IsChapterNotified(ctx context.Context, sub domain.Subscription, chapter domain.Chapter) (bool, error)
+	DeleteAllSubscriptions(context.Context, domain.Recipient) error
+	SetSubscriptionPriority(
+		ctx context.Context,
+		recipient domain.Recipient,
+		mangaID string,
+		lang string,
+		priority int,
+	) error
+	SetFirstLanguageOnly(
+		ctx context.Context,
+		recipient domain.Recipient,
+		mangaID string,
+		enabled bool,
+	) error
+	IsChapterNotifiedToRecipient(
+		ctx context.Context,
+		recipient domain.Recipient,
+		mangaID string,
+		chapter string,
+		exceptChapterID string,
+		before time.Time,
+	) (bool, error)
+	MarkChapterRead(ctx context.Context, recipient domain.Recipient, chapterID string) ([]domain.Subscription, error)
+	UnreadSubscriptions(ctx context.Context, recipient domain.Recipient) ([]domain.UnreadSubscription, error)
+	UnreadCounts(ctx context.Context, sub domain.Subscription) (map[domain.Recipient]int, error)
+	SetStatusAlerts(
+		ctx context.Context,
+		recipient domain.Recipient,
+		mangaID string,
+		lang string,
+		enabled bool,
+	) error
+	TopicSnapshot(ctx context.Context, sub domain.Subscription) (*domain.MangaSnapshot, error)
+	SetTopicSnapshot(ctx context.Context, sub domain.Subscription, snapshot domain.MangaSnapshot) error
+	SetLanguageWatch(ctx context.Context, recipient domain.Recipient, watch domain.LanguageWatch) error
+	DeleteLanguageWatch(
+		ctx context.Context,
+		recipient domain.Recipient,
+		mangaID string,
+		lang string,
+	) error
+	AllLanguageWatches(ctx context.Context) ([]domain.LanguageWatchExtended, error)
+	ChapterFilter(ctx context.Context, recipient domain.Recipient) (*domain.ChapterFilter, error)
+	SetChapterFilter(ctx context.Context, recipient domain.Recipient, filter domain.ChapterFilter) error
+	ChapterFilters(ctx context.Context) (map[domain.Recipient]domain.ChapterFilter, error)
+	ReleasedChapters(ctx context.Context, sub domain.Subscription, now time.Time) ([]domain.Chapter, error)
+	RecipientFailure(ctx context.Context, recipient domain.Recipient) (*domain.RecipientFailure, error)
+	FailedRecipients(ctx context.Context) ([]domain.Recipient, error)
+	SetRecipientFailure(ctx context.Context, recipient domain.Recipient, failure domain.RecipientFailure) error
+	DeleteRecipientFailure(ctx context.Context, recipient domain.Recipient) error
+	MigrateRecipient(ctx context.Context, from domain.Recipient, to domain.Recipient) error
+	AllUserSettings(ctx context.Context) (map[domain.Recipient]domain.UserSettings, error)
+}
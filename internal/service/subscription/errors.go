@@ -5,6 +5,7 @@ import "fmt"
 var (
 	ErrNoSuchSubscription = fmt.Errorf("no such subscription")
 	ErrMangaNotFound      = fmt.Errorf("manga not found")
+	ErrLanguageAvailable  = fmt.Errorf("language is already available")
 )
 
 type AlreadySubscribedError struct {
@@ -15,3 +16,12 @@ type AlreadySubscribedError struct {
 func (e *AlreadySubscribedError) Error() string {
 	return fmt.Sprintf("already subscribed to [%s] %s", e.Lang, e.Manga)
 }
+
+// SubscriptionLimitError is returned if the recipient already has the max number of subscriptions
+type SubscriptionLimitError struct {
+	Limit int
+}
+
+func (e *SubscriptionLimitError) Error() string {
+	return fmt.Sprintf("subscription limit of %d is reached", e.Limit)
+}
@@ -1,213 +1,1177 @@
-package subscription
-
-import (
-	"context"
-	"errors"
-	"fmt"
-	"time"
-
-	"github.com/neymee/mdexbot/internal/domain"
-	"github.com/neymee/mdexbot/internal/log"
-)
-
-const (
-	PublishedSinceDelay = time.Minute * 3
-)
-
-type Service interface {
-	Manga(ctx context.Context, mangaID string) (domain.Manga, error)
-	List(ctx context.Context, rec domain.Recipient) ([]domain.Subscription, error)
-	Subscribe(ctx context.Context, user domain.Recipient, mangaID string, lang string) (domain.Subscription, error)
-	Unsubscribe(ctx context.Context, user domain.Recipient, mangaID string, lang string) (domain.Subscription, error)
-	UnsubscribeAll(ctx context.Context, user domain.Recipient) error
-	Updates(ctx context.Context) ([]domain.Update, error)
-}
-
-type service struct {
-	mdex    MangaDexAPI
-	storage SubscriptionRepo
-}
-
-func New(
-	mdex MangaDexAPI,
-	storage SubscriptionRepo,
-) Service {
-	return &service{
-		mdex:    mdex,
-		storage: storage,
-	}
-}
-
-func (s *service) Manga(ctx context.Context, mangaID string) (domain.Manga, error) {
-	return s.mdex.Manga(ctx, mangaID)
-}
-
-func (s *service) List(ctx context.Context, rec domain.Recipient) ([]domain.Subscription, error) {
-	return s.storage.UserSubscriptions(ctx, rec)
-}
-
-func (s *service) Subscribe(ctx context.Context, user domain.Recipient, mangaID string, lang string) (domain.Subscription, error) {
-	allSubs, err := s.storage.UserSubscriptions(ctx, user)
-	if err != nil {
-		return domain.Subscription{}, err
-	}
-
-	// find all subs to this manga, check if already subscribed
-	var mangaSubs []domain.Subscription
-	for _, sub := range allSubs {
-		if sub.MangaID == mangaID {
-			if sub.Language == lang {
-				return domain.Subscription{}, &AlreadySubscribedError{Manga: sub.MangaTitle, Lang: sub.Language}
-			}
-			mangaSubs = append(mangaSubs, sub)
-		}
-	}
-
-	// remove sub to "any" if lang != "any" OR remove all subs if lang == "any"
-	if lang == "any" && len(mangaSubs) > 0 || len(mangaSubs) == 1 && mangaSubs[0].Language == "any" {
-		for _, sub := range mangaSubs {
-			if sub.MangaID == mangaID {
-				err := s.storage.DeleteUserSubscription(ctx, user, sub.MangaID, sub.Language)
-				if err != nil {
-					return domain.Subscription{}, err
-				}
-			}
-		}
-	}
-
-	manga, err := s.mdex.Manga(ctx, mangaID)
-	if err != nil {
-		return domain.Subscription{}, err
-	}
-
-	sub := domain.Subscription{
-		MangaID:    mangaID,
-		MangaTitle: manga.GetTitle(),
-		Language:   lang,
-	}
-
-	err = s.storage.SetUserSubscription(ctx, user, sub)
-	if err != nil {
-		return domain.Subscription{}, err
-	}
-
-	return sub, nil
-}
-
-func (s *service) Unsubscribe(ctx context.Context, user domain.Recipient, mangaID string, lang string) (domain.Subscription, error) {
-	currentSubs, err := s.storage.UserSubscriptions(ctx, user)
-	if err != nil {
-		return domain.Subscription{}, err
-	}
-
-	var deletedSub *domain.Subscription
-	for _, sub := range currentSubs {
-		if sub.MangaID == mangaID && sub.Language == lang {
-			deletedSub = &sub
-			break
-		}
-	}
-
-	if deletedSub == nil {
-		return domain.Subscription{}, ErrNoSuchSubscription
-	}
-
-	err = s.storage.DeleteUserSubscription(ctx, user, mangaID, lang)
-	if err != nil {
-		return domain.Subscription{}, err
-	}
-
-	return *deletedSub, nil
-}
-
-func (s *service) UnsubscribeAll(ctx context.Context, user domain.Recipient) error {
-	return s.storage.DeleteAllSubscriptions(ctx, user)
-}
-
-func (s *service) Updates(ctx context.Context) ([]domain.Update, error) {
-	subs, err := s.storage.AllSubscriptions(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	var updates []domain.Update
-	for _, sub := range subs {
-		select {
-		case <-ctx.Done():
-			return nil, fmt.Errorf("interrupted: context is cancelled")
-		default:
-		}
-
-		chapters, err := s.newChapters(ctx, sub)
-		if errors.Is(err, ErrMangaNotFound) {
-			log.Log(ctx, "subscription.Updates").Warn().
-				Str("manga_id", sub.MangaID).
-				Msg("Manga not found, subscription is skipped")
-			continue
-		} else if err != nil {
-			return nil, err
-		}
-
-		err = s.storage.SetSubscriptionLastUpdate(ctx, sub.Subscription, time.Now().UTC(), chapters...)
-		if err != nil {
-			return nil, err
-		}
-
-		chaptersLen := len(chapters)
-		if chaptersLen == 0 {
-			continue
-		}
-
-		updates = append(
-			updates,
-			domain.Update{
-				MangaTitle:  sub.MangaTitle,
-				MangaID:     sub.MangaID,
-				Language:    sub.Language,
-				NewChapters: chapters,
-				Recipients:  sub.Recipients,
-			},
-		)
-	}
-
-	return updates, nil
-}
-
-// newChapters returns chapters published since last subscription update.
-// Chapters that have already been notified will be filtered.
-func (s *service) newChapters(ctx context.Context, sub domain.SubscriptionExtended) ([]domain.Chapter, error) {
-	var lang *string
-	if sub.Language != "any" {
-		lang = &sub.Language
-	}
-
-	// Sometimes manga appears in responses with a little delay from publication time
-	// so we need to recheck last few minutes before the previous request.
-	// In case of duplicate it will be filtered later.
-	publishedSince := sub.UpdatedAt.Add(-PublishedSinceDelay)
-
-	lastChapters, err := s.mdex.LastChapters(ctx, sub.MangaID, lang, &publishedSince)
-	if err != nil {
-		return nil, err
-	}
-
-	// filter chapters that have already been notified
-	type key struct{ vol, ch string }
-	chaptersAdded := map[key]struct{}{}
-	chapters := []domain.Chapter{}
-	for _, ch := range lastChapters {
-		isNotified, err := s.storage.IsChapterNotified(ctx, sub.Subscription, ch)
-		if err != nil {
-			return nil, err
-		}
-
-		key := key{vol: ch.Volume, ch: ch.Chapter}
-		_, isAdded := chaptersAdded[key]
-
-		if !isNotified && !isAdded {
-			chapters = append(chapters, ch)
-			chaptersAdded[key] = struct{}{}
-		}
-	}
-	return chapters, nil
-}
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neymee/mdexbot/internal/domain"
+	"github.com/neymee/mdexbot/internal/log"
+	"github.com/neymee/mdexbot/internal/metrics"
+)
+
+const (
+	PublishedSinceDelay = time.Minute * 3
+	// MaxRecipientFailures is a number of permanent failures after which
+	// all subscriptions of the recipient are removed
+	MaxRecipientFailures = 3
+	// RecipientFailureInterval is a min interval between counted failures,
+	// so a burst of messages to an unavailable recipient counts as a single failure
+	RecipientFailureInterval = time.Hour
+)
+
+type Service interface {
+	Manga(ctx context.Context, mangaID string) (domain.Manga, error)
+	CycleManga(ctx context.Context, mangaID string) (domain.Manga, error)
+	List(ctx context.Context, rec domain.Recipient) ([]domain.Subscription, error)
+	ListPage(ctx context.Context, rec domain.Recipient, query domain.SubscriptionQuery) (domain.SubscriptionPage, error)
+	Subscribe(ctx context.Context, user domain.Recipient, mangaID string, lang string) (domain.Subscription, error)
+	Unsubscribe(ctx context.Context, user domain.Recipient, mangaID string, lang string) (domain.Subscription, error)
+	UnsubscribeAll(ctx context.Context, user domain.Recipient) error
+	ToggleFirstLanguageOnly(ctx context.Context, user domain.Recipient, mangaID string) (bool, error)
+	QueueUpdates(ctx context.Context) ([]domain.Update, error)
+	ChapterFilter(ctx context.Context, user domain.Recipient) (domain.ChapterFilter, error)
+	SetChapterFilter(ctx context.Context, user domain.Recipient, filter domain.ChapterFilter) error
+	MarkRead(ctx context.Context, user domain.Recipient, chapterID string) ([]domain.Subscription, error)
+	Unread(ctx context.Context, user domain.Recipient) ([]domain.UnreadSubscription, error)
+	ToggleStatusAlerts(ctx context.Context, user domain.Recipient, mangaID string, lang string) (domain.Subscription, error)
+	StatusUpdates(ctx context.Context) ([]domain.StatusUpdate, error)
+	WatchLanguage(ctx context.Context, user domain.Recipient, mangaID string, lang string) (domain.LanguageWatch, error)
+	UnwatchLanguage(ctx context.Context, user domain.Recipient, mangaID string, lang string) error
+	LanguageUpdates(ctx context.Context) ([]domain.LanguageWatchExtended, error)
+	RecipientFailed(ctx context.Context, user domain.Recipient, reason error) (bool, error)
+	RecipientReachable(ctx context.Context, user domain.Recipient) error
+	MigrateRecipient(ctx context.Context, from domain.Recipient, to domain.Recipient) error
+}
+
+type service struct {
+	mdex    MangaDexAPI
+	storage SubscriptionRepo
+	// maxSubscriptions limits subscriptions of a recipient, 0 means no limit
+	maxSubscriptions int
+
+	// lastCycle keeps chapters found by the last QueueUpdates per topic,
+	// StatusUpdates uses them to avoid extra requests to MangaDex.
+	// mangas are requested once per update check, errors included.
+	cycleMu   sync.Mutex
+	lastCycle map[topicKey][]domain.Chapter
+	mangas    map[string]cycleManga
+
+	// failing caches recipients with recorded failures, so successful sends don't touch the database.
+	// It's loaded on the first use, nil until then.
+	failingMu sync.Mutex
+	failing   map[domain.Recipient]bool
+}
+
+// cycleManga is a result of requesting the manga during an update check
+type cycleManga struct {
+	manga domain.Manga
+	err   error
+}
+
+type topicKey struct {
+	mangaID string
+	lang    string
+}
+
+// Option configures the service
+type Option func(s *service)
+
+// WithMaxSubscriptions limits the number of subscriptions of a recipient, 0 means no limit
+func WithMaxSubscriptions(max int) Option {
+	return func(s *service) {
+		s.maxSubscriptions = max
+	}
+}
+
+func New(
+	mdex MangaDexAPI,
+	storage SubscriptionRepo,
+	opts ...Option,
+) Service {
+	s := &service{
+		mdex:    mdex,
+		storage: storage,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *service) Manga(ctx context.Context, mangaID string) (domain.Manga, error) {
+	return s.mdex.Manga(ctx, mangaID)
+}
+
+// CycleManga returns the manga requested once per update check, so status updates,
+// language watches and cover art share a single request. QueueUpdates starts a new check.
+func (s *service) CycleManga(ctx context.Context, mangaID string) (domain.Manga, error) {
+	s.cycleMu.Lock()
+	cached, ok := s.mangas[mangaID]
+	s.cycleMu.Unlock()
+	if ok {
+		return cached.manga, cached.err
+	}
+
+	manga, err := s.mdex.Manga(ctx, mangaID)
+
+	s.cycleMu.Lock()
+	if s.mangas == nil {
+		s.mangas = map[string]cycleManga{}
+	}
+	s.mangas[mangaID] = cycleManga{manga: manga, err: err}
+	s.cycleMu.Unlock()
+
+	return manga, err
+}
+
+func (s *service) List(ctx context.Context, rec domain.Recipient) ([]domain.Subscription, error) {
+	return s.storage.UserSubscriptions(ctx, rec)
+}
+
+// ListPage returns a page of the recipient's subscriptions matching the filter in the requested order
+func (s *service) ListPage(
+	ctx context.Context,
+	rec domain.Recipient,
+	query domain.SubscriptionQuery,
+) (domain.SubscriptionPage, error) {
+	all, err := s.storage.UserSubscriptions(ctx, rec)
+	if err != nil {
+		return domain.SubscriptionPage{}, err
+	}
+
+	filter := strings.ToLower(strings.TrimSpace(query.Filter))
+	subs := make([]domain.Subscription, 0, len(all))
+	for _, sub := range all {
+		if filter == "" || strings.Contains(strings.ToLower(sub.MangaTitle), filter) || sub.Language == filter {
+			subs = append(subs, sub)
+		}
+	}
+
+	// subscriptions come ordered by title, languages of the same manga by priority
+	switch query.Sort {
+	case domain.SortByUpdated:
+		sort.SliceStable(subs, func(i, j int) bool {
+			return subs[i].LastChapterAt.After(subs[j].LastChapterAt)
+		})
+	case domain.SortByLanguage:
+		sort.SliceStable(subs, func(i, j int) bool {
+			return subs[i].Language < subs[j].Language
+		})
+	}
+
+	pageSize := query.PageSize
+	if pageSize <= 0 {
+		pageSize = len(subs)
+	}
+
+	page := domain.SubscriptionPage{Total: len(subs)}
+	if len(subs) == 0 {
+		return page, nil
+	}
+
+	page.Pages = (len(subs) + pageSize - 1) / pageSize
+	page.Page = query.Page
+	if page.Page >= page.Pages {
+		page.Page = page.Pages - 1
+	} else if page.Page < 0 {
+		page.Page = 0
+	}
+
+	end := (page.Page + 1) * pageSize
+	if end > len(subs) {
+		end = len(subs)
+	}
+	page.Subscriptions = subs[page.Page*pageSize : end]
+
+	return page, nil
+}
+
+// Subscribe adds the language to the end of the recipient's language list of the manga
+func (s *service) Subscribe(ctx context.Context, user domain.Recipient, mangaID string, lang string) (domain.Subscription, error) {
+	allSubs, err := s.storage.UserSubscriptions(ctx, user)
+	if err != nil {
+		return domain.Subscription{}, err
+	}
+
+	// find all subs to this manga, check if already subscribed
+	var mangaSubs []domain.Subscription
+	for _, sub := range allSubs {
+		if sub.MangaID == mangaID {
+			if sub.Language == lang {
+				return domain.Subscription{}, &AlreadySubscribedError{Manga: sub.MangaTitle, Lang: sub.Language}
+			}
+			mangaSubs = append(mangaSubs, sub)
+		}
+	}
+
+	if s.maxSubscriptions > 0 && len(allSubs) >= s.maxSubscriptions {
+		return domain.Subscription{}, &SubscriptionLimitError{Limit: s.maxSubscriptions}
+	}
+
+	manga, err := s.mdex.Manga(ctx, mangaID)
+	if err != nil {
+		return domain.Subscription{}, err
+	}
+
+	sub := domain.Subscription{
+		MangaID:    mangaID,
+		MangaTitle: manga.GetTitle(),
+		Language:   lang,
+	}
+
+	// the new language inherits the settings of the manga and goes last
+	for _, ms := range mangaSubs {
+		if ms.Priority >= sub.Priority {
+			sub.Priority = ms.Priority + 1
+		}
+		sub.StatusAlerts = sub.StatusAlerts || ms.StatusAlerts
+		sub.FirstLanguageOnly = sub.FirstLanguageOnly || ms.FirstLanguageOnly
+	}
+
+	err = s.storage.SetUserSubscription(ctx, user, sub)
+	if err != nil {
+		return domain.Subscription{}, err
+	}
+
+	return sub, nil
+}
+
+// ToggleFirstLanguageOnly switches notifying about a chapter only in the first language
+// it appears in for all languages of the manga. Returns the new state.
+func (s *service) ToggleFirstLanguageOnly(ctx context.Context, user domain.Recipient, mangaID string) (bool, error) {
+	currentSubs, err := s.storage.UserSubscriptions(ctx, user)
+	if err != nil {
+		return false, err
+	}
+
+	var mangaSub *domain.Subscription
+	for _, sub := range currentSubs {
+		if sub.MangaID == mangaID {
+			mangaSub = &sub
+			break
+		}
+	}
+
+	if mangaSub == nil {
+		return false, ErrNoSuchSubscription
+	}
+
+	enabled := !mangaSub.FirstLanguageOnly
+	err = s.storage.SetFirstLanguageOnly(ctx, user, mangaID, enabled)
+	if err != nil {
+		return false, err
+	}
+
+	return enabled, nil
+}
+
+func (s *service) Unsubscribe(ctx context.Context, user domain.Recipient, mangaID string, lang string) (domain.Subscription, error) {
+	currentSubs, err := s.storage.UserSubscriptions(ctx, user)
+	if err != nil {
+		return domain.Subscription{}, err
+	}
+
+	var deletedSub *domain.Subscription
+	for _, sub := range currentSubs {
+		if sub.MangaID == mangaID && sub.Language == lang {
+			deletedSub = &sub
+			break
+		}
+	}
+
+	if deletedSub == nil {
+		return domain.Subscription{}, ErrNoSuchSubscription
+	}
+
+	err = s.storage.DeleteUserSubscription(ctx, user, mangaID, lang)
+	if err != nil {
+		return domain.Subscription{}, err
+	}
+
+	// remaining languages of the manga are renumbered, so priorities have no gaps;
+	// subscriptions come ordered by priority
+	priority := 0
+	for _, sub := range currentSubs {
+		if sub.MangaID != mangaID || sub.Language == lang {
+			continue
+		}
+		if sub.Priority != priority {
+			err := s.storage.SetSubscriptionPriority(ctx, user, sub.MangaID, sub.Language, priority)
+			if err != nil {
+				return domain.Subscription{}, err
+			}
+		}
+		priority++
+	}
+
+	return *deletedSub, nil
+}
+
+func (s *service) UnsubscribeAll(ctx context.Context, user domain.Recipient) error {
+	return s.storage.DeleteAllSubscriptions(ctx, user)
+}
+
+// QueueUpdates checks subscriptions for new chapters and puts notifications to the outbox.
+// Chapters are saved as notified together with the notifications, so they are never lost
+// if sending fails. Returns queued updates.
+func (s *service) QueueUpdates(ctx context.Context) ([]domain.Update, error) {
+	cycleStart := time.Now()
+
+	s.cycleMu.Lock()
+	s.mangas = nil
+	s.cycleMu.Unlock()
+
+	subs, err := s.storage.AllSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filters, err := s.storage.ChapterFilters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type topicUpdate struct {
+		sub       domain.SubscriptionExtended
+		updatedAt time.Time
+		chapters  []domain.Chapter
+		released  []domain.Chapter
+	}
+
+	var (
+		topics        []topicUpdate
+		updates       []domain.Update
+		firstLangOnly []map[domain.Recipient]int
+		// unread counts of saved chapters and ids of new chapters of every updated topic
+		unread      = map[topicKey]map[domain.Recipient]int{}
+		newChapters = map[topicKey]map[string]struct{}{}
+	)
+	for _, sub := range subs {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("interrupted: context is cancelled")
+		default:
+		}
+
+		chapters, err := s.newChapters(ctx, sub)
+		if errors.Is(err, ErrMangaNotFound) {
+			log.Log(ctx, "subscription.QueueUpdates").Warn().
+				Str("manga_id", sub.MangaID).
+				Msg("Manga not found, subscription is skipped")
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		now := time.Now().UTC()
+		released, err := s.storage.ReleasedChapters(ctx, sub.Subscription, now)
+		if err != nil {
+			return nil, err
+		}
+
+		topics = append(topics, topicUpdate{sub: sub, updatedAt: now, chapters: chapters, released: released})
+
+		if len(chapters) == 0 && len(released) == 0 {
+			continue
+		}
+
+		k := topicKey{mangaID: sub.MangaID, lang: sub.Language}
+		unread[k], err = s.storage.UnreadCounts(ctx, sub.Subscription)
+		if err != nil {
+			return nil, err
+		}
+		newChapters[k] = make(map[string]struct{}, len(chapters))
+		for _, ch := range chapters {
+			newChapters[k][ch.ID] = struct{}{}
+		}
+
+		for _, upd := range splitByFilters(sub, chapters, released, filters, now) {
+			updates = append(updates, upd)
+			firstLangOnly = append(firstLangOnly, sub.FirstLanguageOnly)
+		}
+	}
+
+	updates, err = s.filterFirstLanguage(ctx, updates, firstLangOnly, cycleStart)
+	if err != nil {
+		return nil, err
+	}
+	updates = dedupeChapters(updates)
+	setUnread(updates, unread, newChapters)
+
+	var settings map[domain.Recipient]domain.UserSettings
+	if len(updates) > 0 {
+		settings, err = s.storage.AllUserSettings(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	deliveries := map[topicKey][]domain.Delivery{}
+	for _, upd := range updates {
+		k := topicKey{mangaID: upd.MangaID, lang: upd.Language}
+		for _, rec := range upd.Recipients {
+			d := domain.NewDelivery(upd, rec)
+			if st, ok := settings[rec]; ok && st.DigestMode != domain.DigestOff {
+				d.Digest = true
+				d.NotBefore = st.NextDigest(time.Now().UTC())
+			}
+			deliveries[k] = append(deliveries[k], d)
+		}
+	}
+
+	cycle := make(map[topicKey][]domain.Chapter, len(topics))
+	for _, t := range topics {
+		k := topicKey{mangaID: t.sub.MangaID, lang: t.sub.Language}
+		err := s.storage.SetSubscriptionLastUpdate(ctx, t.sub.Subscription, t.updatedAt, t.chapters, t.released, deliveries[k])
+		if err != nil {
+			return nil, err
+		}
+		cycle[k] = append(append(cycle[k], t.chapters...), t.released...)
+		// each chapter is counted once, whatever the number of filter groups
+		metrics.ChaptersCounter.Add(float64(len(t.chapters)))
+	}
+
+	s.cycleMu.Lock()
+	s.lastCycle = cycle
+	s.cycleMu.Unlock()
+
+	return updates, nil
+}
+
+// splitByFilters groups recipients of the subscription by chapters they should be notified about.
+// Scheduled chapters that are published now are notified as new ones to recipients
+// who don't want to know about them in advance, and as released to those who want both.
+func splitByFilters(
+	sub domain.SubscriptionExtended,
+	chapters []domain.Chapter,
+	released []domain.Chapter,
+	filters map[domain.Recipient]domain.ChapterFilter,
+	now time.Time,
+) []domain.Update {
+	var (
+		keys   []string
+		groups = map[string]*domain.Update{}
+	)
+
+	add := func(rec domain.Recipient, chapters []domain.Chapter, isReleased bool) {
+		if len(chapters) == 0 {
+			return
+		}
+
+		ids := make([]string, 0, len(chapters)+1)
+		ids = append(ids, fmt.Sprint(isReleased))
+		for _, ch := range chapters {
+			ids = append(ids, ch.ID)
+		}
+		key := strings.Join(ids, "/")
+
+		if upd, ok := groups[key]; ok {
+			upd.Recipients = append(upd.Recipients, rec)
+			return
+		}
+
+		keys = append(keys, key)
+		groups[key] = &domain.Update{
+			MangaTitle:  sub.MangaTitle,
+			MangaID:     sub.MangaID,
+			Language:    sub.Language,
+			NewChapters: chapters,
+			Recipients:  []domain.Recipient{rec},
+			Released:    isReleased,
+		}
+	}
+
+	for _, rec := range sub.Recipients {
+		filter, ok := filters[rec]
+		if !ok {
+			filter = domain.DefaultChapterFilter()
+		}
+
+		newChapters := []domain.Chapter{}
+		for _, ch := range chapters {
+			if filter.Allows(ch) && (filter.IncludeScheduled || !ch.IsScheduled(now)) {
+				newChapters = append(newChapters, ch)
+			}
+		}
+
+		releasedChapters := []domain.Chapter{}
+		for _, ch := range released {
+			if filter.Allows(ch) {
+				releasedChapters = append(releasedChapters, ch)
+			}
+		}
+
+		if !filter.IncludeScheduled {
+			// the recipient hasn't been notified about these chapters yet
+			add(rec, append(newChapters, releasedChapters...), false)
+			continue
+		}
+
+		add(rec, newChapters, false)
+		if filter.NotifyOnRelease {
+			add(rec, releasedChapters, true)
+		}
+	}
+
+	result := make([]domain.Update, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *groups[key])
+	}
+	return result
+}
+
+func (s *service) ChapterFilter(ctx context.Context, user domain.Recipient) (domain.ChapterFilter, error) {
+	filter, err := s.storage.ChapterFilter(ctx, user)
+	if err != nil {
+		return domain.ChapterFilter{}, err
+	}
+
+	if filter == nil {
+		return domain.DefaultChapterFilter(), nil
+	}
+	return *filter, nil
+}
+
+func (s *service) SetChapterFilter(ctx context.Context, user domain.Recipient, filter domain.ChapterFilter) error {
+	return s.storage.SetChapterFilter(ctx, user, filter)
+}
+
+// filterFirstLanguage removes chapters that have already been notified in another language
+// for recipients that want to be notified only in the first language a chapter appears in.
+// If the same chapter is published in several languages at once, the language with
+// the highest priority wins. firstLangOnly[i] contains priorities of updates[i] language.
+func (s *service) filterFirstLanguage(
+	ctx context.Context,
+	updates []domain.Update,
+	firstLangOnly []map[domain.Recipient]int,
+	before time.Time,
+) ([]domain.Update, error) {
+	type key struct {
+		rec     domain.Recipient
+		mangaID string
+	}
+
+	// updates of the same manga for every recipient
+	recUpdates := map[key][]int{}
+	var keys []key
+	for i, upd := range updates {
+		// released chapters have already been notified in advance
+		if upd.Released {
+			continue
+		}
+
+		for _, rec := range upd.Recipients {
+			if _, ok := firstLangOnly[i][rec]; !ok {
+				continue
+			}
+			k := key{rec: rec, mangaID: upd.MangaID}
+			if _, ok := recUpdates[k]; !ok {
+				keys = append(keys, k)
+			}
+			recUpdates[k] = append(recUpdates[k], i)
+		}
+	}
+
+	excluded := map[key]map[int]struct{}{}
+	var personal []domain.Update
+	for _, k := range keys {
+		idxs := recUpdates[k]
+		sort.SliceStable(idxs, func(a, b int) bool {
+			return firstLangOnly[idxs[a]][k.rec] < firstLangOnly[idxs[b]][k.rec]
+		})
+
+		seen := map[string]struct{}{}
+		for _, i := range idxs {
+			upd := updates[i]
+
+			chapters := []domain.Chapter{}
+			for _, ch := range upd.NewChapters {
+				// chapters without a number can't be matched between languages
+				if ch.Chapter == "" {
+					chapters = append(chapters, ch)
+					continue
+				}
+				if _, ok := seen[ch.Chapter]; ok {
+					continue
+				}
+
+				notified, err := s.storage.IsChapterNotifiedToRecipient(ctx, k.rec, k.mangaID, ch.Chapter, ch.ID, before)
+				if err != nil {
+					return nil, err
+				}
+				if notified {
+					continue
+				}
+
+				seen[ch.Chapter] = struct{}{}
+				chapters = append(chapters, ch)
+			}
+
+			if len(chapters) == len(upd.NewChapters) {
+				continue
+			}
+
+			if excluded[k] == nil {
+				excluded[k] = map[int]struct{}{}
+			}
+			excluded[k][i] = struct{}{}
+
+			if len(chapters) > 0 {
+				personal = append(personal, domain.Update{
+					MangaTitle:  upd.MangaTitle,
+					MangaID:     upd.MangaID,
+					Language:    upd.Language,
+					NewChapters: chapters,
+					Recipients:  []domain.Recipient{k.rec},
+					Unread:      map[domain.Recipient]int{k.rec: upd.Unread[k.rec]},
+				})
+			}
+		}
+	}
+
+	if len(excluded) == 0 {
+		return updates, nil
+	}
+
+	result := make([]domain.Update, 0, len(updates)+len(personal))
+	for i, upd := range updates {
+		recs := make([]domain.Recipient, 0, len(upd.Recipients))
+		for _, rec := range upd.Recipients {
+			if _, ok := excluded[key{rec: rec, mangaID: upd.MangaID}][i]; !ok {
+				recs = append(recs, rec)
+			}
+		}
+		if len(recs) == 0 {
+			continue
+		}
+		unread := make(map[domain.Recipient]int, len(recs))
+		for _, rec := range recs {
+			unread[rec] = upd.Unread[rec]
+		}
+		upd.Recipients = recs
+		upd.Unread = unread
+		result = append(result, upd)
+	}
+
+	return append(result, personal...), nil
+}
+
+// setUnread counts unread chapters of every recipient of the updates. New chapters aren't saved yet,
+// so only the ones the recipient is notified about are added to the saved unread chapters.
+func setUnread(
+	updates []domain.Update,
+	unread map[topicKey]map[domain.Recipient]int,
+	newChapters map[topicKey]map[string]struct{},
+) {
+	type key struct {
+		topic topicKey
+		rec   domain.Recipient
+	}
+
+	notified := map[key]map[string]struct{}{}
+	for _, upd := range updates {
+		k := topicKey{mangaID: upd.MangaID, lang: upd.Language}
+		for _, rec := range upd.Recipients {
+			rk := key{topic: k, rec: rec}
+			if notified[rk] == nil {
+				notified[rk] = map[string]struct{}{}
+			}
+			for _, ch := range upd.NewChapters {
+				if _, ok := newChapters[k][ch.ID]; ok {
+					notified[rk][ch.ID] = struct{}{}
+				}
+			}
+		}
+	}
+
+	for i, upd := range updates {
+		k := topicKey{mangaID: upd.MangaID, lang: upd.Language}
+		updates[i].Unread = make(map[domain.Recipient]int, len(upd.Recipients))
+		for _, rec := range upd.Recipients {
+			updates[i].Unread[rec] = unread[k][rec] + len(notified[key{topic: k, rec: rec}])
+		}
+	}
+}
+
+// dedupeChapters notifies a recipient about a chapter once, when it is found by several subscriptions
+// to the manga, e.g. to "any" and to the language of the chapter. Specific languages are preferred.
+func dedupeChapters(updates []domain.Update) []domain.Update {
+	order := make([]int, len(updates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return updates[order[a]].Language != "any" && updates[order[b]].Language == "any"
+	})
+
+	type key struct {
+		rec       domain.Recipient
+		chapterID string
+		released  bool
+	}
+
+	seen := map[key]struct{}{}
+	// excluded recipients of every update
+	excluded := map[int]map[domain.Recipient]struct{}{}
+	var personal []domain.Update
+	for _, i := range order {
+		upd := updates[i]
+		for _, rec := range upd.Recipients {
+			chapters := []domain.Chapter{}
+			for _, ch := range upd.NewChapters {
+				k := key{rec: rec, chapterID: ch.ID, released: upd.Released}
+				if _, ok := seen[k]; ok {
+					continue
+				}
+				seen[k] = struct{}{}
+				chapters = append(chapters, ch)
+			}
+
+			if len(chapters) == len(upd.NewChapters) {
+				continue
+			}
+
+			if excluded[i] == nil {
+				excluded[i] = map[domain.Recipient]struct{}{}
+			}
+			excluded[i][rec] = struct{}{}
+
+			if len(chapters) > 0 {
+				personal = append(personal, domain.Update{
+					MangaTitle:  upd.MangaTitle,
+					MangaID:     upd.MangaID,
+					Language:    upd.Language,
+					NewChapters: chapters,
+					Recipients:  []domain.Recipient{rec},
+					Unread:      map[domain.Recipient]int{rec: upd.Unread[rec]},
+					Released:    upd.Released,
+				})
+			}
+		}
+	}
+
+	if len(excluded) == 0 {
+		return updates
+	}
+
+	result := make([]domain.Update, 0, len(updates)+len(personal))
+	for i, upd := range updates {
+		recs := make([]domain.Recipient, 0, len(upd.Recipients))
+		for _, rec := range upd.Recipients {
+			if _, ok := excluded[i][rec]; !ok {
+				recs = append(recs, rec)
+			}
+		}
+		if len(recs) == 0 {
+			continue
+		}
+		unread := make(map[domain.Recipient]int, len(recs))
+		for _, rec := range recs {
+			unread[rec] = upd.Unread[rec]
+		}
+		upd.Recipients = recs
+		upd.Unread = unread
+		result = append(result, upd)
+	}
+
+	return append(result, personal...)
+}
+
+func (s *service) MarkRead(ctx context.Context, user domain.Recipient, chapterID string) ([]domain.Subscription, error) {
+	subs, err := s.storage.MarkChapterRead(ctx, user, chapterID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(subs) == 0 {
+		return nil, ErrNoSuchSubscription
+	}
+
+	return subs, nil
+}
+
+func (s *service) Unread(ctx context.Context, user domain.Recipient) ([]domain.UnreadSubscription, error) {
+	return s.storage.UnreadSubscriptions(ctx, user)
+}
+
+func (s *service) ToggleStatusAlerts(
+	ctx context.Context,
+	user domain.Recipient,
+	mangaID string,
+	lang string,
+) (domain.Subscription, error) {
+	currentSubs, err := s.storage.UserSubscriptions(ctx, user)
+	if err != nil {
+		return domain.Subscription{}, err
+	}
+
+	var toggledSub *domain.Subscription
+	for _, sub := range currentSubs {
+		if sub.MangaID == mangaID && sub.Language == lang {
+			toggledSub = &sub
+			break
+		}
+	}
+
+	if toggledSub == nil {
+		return domain.Subscription{}, ErrNoSuchSubscription
+	}
+
+	toggledSub.StatusAlerts = !toggledSub.StatusAlerts
+	err = s.storage.SetStatusAlerts(ctx, user, mangaID, lang, toggledSub.StatusAlerts)
+	if err != nil {
+		return domain.Subscription{}, err
+	}
+
+	return *toggledSub, nil
+}
+
+// StatusUpdates compares manga attributes with the snapshot saved on the previous check
+// and returns changes for subscriptions with enabled status alerts.
+func (s *service) StatusUpdates(ctx context.Context) ([]domain.StatusUpdate, error) {
+	subs, err := s.storage.AllSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// chapters found by the last QueueUpdates, each cycle uses them once
+	s.cycleMu.Lock()
+	cycle := s.lastCycle
+	s.lastCycle = nil
+	s.cycleMu.Unlock()
+
+	var updates []domain.StatusUpdate
+	for _, sub := range subs {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("interrupted: context is cancelled")
+		default:
+		}
+
+		manga, err := s.CycleManga(ctx, sub.MangaID)
+		if errors.Is(err, ErrMangaNotFound) {
+			log.Log(ctx, "subscription.StatusUpdates").Warn().
+				Str("manga_id", sub.MangaID).
+				Msg("Manga not found, subscription is skipped")
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		prev, err := s.storage.TopicSnapshot(ctx, sub.Subscription)
+		if err != nil {
+			return nil, err
+		}
+
+		chapters, checked := cycle[topicKey{mangaID: sub.MangaID, lang: sub.Language}]
+		finalPublished, err := s.finalPublished(ctx, sub.Subscription, manga, prev, chapters, checked)
+		if err != nil {
+			return nil, err
+		}
+
+		// the snapshot is kept up to date even if nobody is alerted,
+		// so enabling alerts later doesn't report old changes
+		cur := manga.Snapshot(finalPublished)
+		err = s.storage.SetTopicSnapshot(ctx, sub.Subscription, cur)
+		if err != nil {
+			return nil, err
+		}
+
+		// the first snapshot of the topic has nothing to compare with
+		if prev == nil || len(sub.AlertRecipients) == 0 {
+			continue
+		}
+
+		upd, changed := diffSnapshots(*prev, cur)
+		if !changed {
+			continue
+		}
+
+		upd.MangaTitle = sub.MangaTitle
+		upd.MangaID = sub.MangaID
+		upd.Language = sub.Language
+		upd.Recipients = sub.AlertRecipients
+		updates = append(updates, upd)
+	}
+
+	return updates, nil
+}
+
+// finalPublished reports whether the last chapter of the manga is published in the topic language.
+// Chapters found by the last QueueUpdates are used when the last chapter is unchanged since the previous
+// snapshot, MangaDex is requested only if the topic wasn't checked or the last chapter has changed.
+func (s *service) finalPublished(
+	ctx context.Context,
+	sub domain.Subscription,
+	manga domain.Manga,
+	prev *domain.MangaSnapshot,
+	chapters []domain.Chapter,
+	checked bool,
+) (bool, error) {
+	if manga.LastChapter == "" {
+		return false, nil
+	}
+	sameLast := prev != nil && prev.LastChapter == manga.LastChapter
+	if sameLast && prev.FinalPublished {
+		return true, nil
+	}
+
+	if checked && sameLast {
+		now := time.Now()
+		for _, ch := range chapters {
+			if !ch.IsScheduled(now) && ch.Chapter == manga.LastChapter && (manga.LastVolume == "" || ch.Volume == manga.LastVolume) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	var lang *string
+	if sub.Language != "any" {
+		lang = &sub.Language
+	}
+	return s.mdex.ChapterPublished(ctx, sub.MangaID, lang, manga.LastVolume, manga.LastChapter)
+}
+
+func (s *service) WatchLanguage(
+	ctx context.Context,
+	user domain.Recipient,
+	mangaID string,
+	lang string,
+) (domain.LanguageWatch, error) {
+	manga, err := s.mdex.Manga(ctx, mangaID)
+	if err != nil {
+		return domain.LanguageWatch{}, err
+	}
+
+	for _, l := range manga.TranslationLanguages {
+		if l == lang {
+			return domain.LanguageWatch{}, ErrLanguageAvailable
+		}
+	}
+
+	watch := domain.LanguageWatch{
+		MangaID:    mangaID,
+		MangaTitle: manga.GetTitle(),
+		Language:   lang,
+	}
+
+	err = s.storage.SetLanguageWatch(ctx, user, watch)
+	if err != nil {
+		return domain.LanguageWatch{}, err
+	}
+
+	return watch, nil
+}
+
+func (s *service) UnwatchLanguage(ctx context.Context, user domain.Recipient, mangaID string, lang string) error {
+	return s.storage.DeleteLanguageWatch(ctx, user, mangaID, lang)
+}
+
+// LanguageUpdates returns watches whose languages have become available. Watches are kept until
+// the recipients are notified and call UnwatchLanguage, so they are never lost if sending fails.
+// Watches of a removed manga are returned with MangaRemoved to tell the recipients and delete them.
+// A manga which can't be fetched is skipped until the next check.
+func (s *service) LanguageUpdates(ctx context.Context) ([]domain.LanguageWatchExtended, error) {
+	watches, err := s.storage.AllLanguageWatches(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []domain.LanguageWatchExtended
+	for _, w := range watches {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("interrupted: context is cancelled")
+		default:
+		}
+
+		manga, err := s.CycleManga(ctx, w.MangaID)
+		if errors.Is(err, ErrMangaNotFound) {
+			log.Log(ctx, "subscription.LanguageUpdates").Warn().
+				Str("manga_id", w.MangaID).
+				Msg("Manga not found, language watch is removed")
+			w.MangaRemoved = true
+			updates = append(updates, w)
+			continue
+		} else if err != nil {
+			metrics.ErrorsCounter(err).Inc()
+			log.Error(ctx, "subscription.LanguageUpdates", err).
+				Str("manga_id", w.MangaID).
+				Msg("Fetching manga error, language watch is skipped")
+			continue
+		}
+
+		for _, l := range manga.TranslationLanguages {
+			if l == w.Language {
+				updates = append(updates, w)
+				break
+			}
+		}
+	}
+
+	return updates, nil
+}
+
+func diffSnapshots(prev, cur domain.MangaSnapshot) (upd domain.StatusUpdate, changed bool) {
+	if prev.Status != cur.Status && cur.Status != "" {
+		upd.OldStatus = prev.Status
+		upd.NewStatus = cur.Status
+		changed = true
+	}
+
+	prevLangs := map[string]struct{}{}
+	for _, l := range prev.TranslationLanguages {
+		prevLangs[l] = struct{}{}
+	}
+	for _, l := range cur.TranslationLanguages {
+		if _, ok := prevLangs[l]; !ok && l != "" {
+			upd.NewLanguages = append(upd.NewLanguages, l)
+			changed = true
+		}
+	}
+
+	if !prev.FinalPublished && cur.FinalPublished {
+		upd.FinalChapter = true
+		changed = true
+	}
+
+	return upd, changed
+}
+
+// newChapters returns chapters published since last subscription update.
+// Chapters that have already been notified will be filtered.
+func (s *service) newChapters(ctx context.Context, sub domain.SubscriptionExtended) ([]domain.Chapter, error) {
+	var lang *string
+	if sub.Language != "any" {
+		lang = &sub.Language
+	}
+
+	// Sometimes manga appears in responses with a little delay from publication time
+	// so we need to recheck last few minutes before the previous request.
+	// In case of duplicate it will be filtered later.
+	publishedSince := sub.UpdatedAt.Add(-PublishedSinceDelay)
+
+	lastChapters, err := s.mdex.LastChapters(ctx, sub.MangaID, lang, &publishedSince)
+	if err != nil {
+		return nil, err
+	}
+
+	// filter chapters that have already been notified
+	type key struct{ vol, ch string }
+	chaptersAdded := map[key]struct{}{}
+	chapters := []domain.Chapter{}
+	for _, ch := range lastChapters {
+		isNotified, err := s.storage.IsChapterNotified(ctx, sub.Subscription, ch)
+		if err != nil {
+			return nil, err
+		}
+
+		key := key{vol: ch.Volume, ch: ch.Chapter}
+		_, isAdded := chaptersAdded[key]
+
+		if !isNotified && !isAdded {
+			chapters = append(chapters, ch)
+			chaptersAdded[key] = struct{}{}
+		}
+	}
+	return chapters, nil
+}
+
+// RecipientFailed counts a permanent failure of sending a message to the recipient.
+// All subscriptions are removed after MaxRecipientFailures, it returns true in this case.
+func (s *service) RecipientFailed(ctx context.Context, user domain.Recipient, reason error) (bool, error) {
+	failure, err := s.storage.RecipientFailure(ctx, user)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now().UTC()
+	failures := 1
+	if failure != nil {
+		if now.Sub(failure.LastFailureAt) < RecipientFailureInterval {
+			return false, nil
+		}
+		failures = failure.Failures + 1
+	}
+
+	if failures < MaxRecipientFailures {
+		err := s.storage.SetRecipientFailure(ctx, user, domain.RecipientFailure{
+			Failures:      failures,
+			LastError:     reason.Error(),
+			LastFailureAt: now,
+		})
+		if err != nil {
+			return false, err
+		}
+		s.setFailing(user, true)
+		return false, nil
+	}
+
+	err = s.storage.DeleteAllSubscriptions(ctx, user)
+	if err != nil {
+		return false, err
+	}
+
+	err = s.storage.DeleteRecipientFailure(ctx, user)
+	if err != nil {
+		return false, err
+	}
+	s.setFailing(user, false)
+
+	return true, nil
+}
+
+// RecipientReachable resets failures of the recipient after a message is delivered
+func (s *service) RecipientReachable(ctx context.Context, user domain.Recipient) error {
+	s.failingMu.Lock()
+	defer s.failingMu.Unlock()
+
+	if s.failing == nil {
+		recs, err := s.storage.FailedRecipients(ctx)
+		if err != nil {
+			return err
+		}
+		s.failing = make(map[domain.Recipient]bool, len(recs))
+		for _, rec := range recs {
+			s.failing[rec] = true
+		}
+	}
+
+	if !s.failing[user] {
+		return nil
+	}
+
+	err := s.storage.DeleteRecipientFailure(ctx, user)
+	if err != nil {
+		return err
+	}
+	delete(s.failing, user)
+	return nil
+}
+
+// setFailing updates the cache of recipients with failures if it's loaded,
+// otherwise the state is loaded from the database later
+func (s *service) setFailing(user domain.Recipient, failing bool) {
+	s.failingMu.Lock()
+	defer s.failingMu.Unlock()
+
+	if s.failing == nil {
+		return
+	}
+	if failing {
+		s.failing[user] = true
+	} else {
+		delete(s.failing, user)
+	}
+}
+
+// MigrateRecipient moves everything of the group to the supergroup it's been upgraded to
+func (s *service) MigrateRecipient(ctx context.Context, from domain.Recipient, to domain.Recipient) error {
+	return s.storage.MigrateRecipient(ctx, from, to)
+}
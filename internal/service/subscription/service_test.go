@@ -2,6 +2,7 @@ package subscription
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"testing"
@@ -43,6 +44,11 @@ func (m *mdexAPIMock) LastChapters(ctx context.Context, mangaID string, lang *st
 	return args.Get(0).([]domain.Chapter), args.Error(1)
 }
 
+func (m *mdexAPIMock) ChapterPublished(ctx context.Context, mangaID string, lang *string, volume string, chapter string) (bool, error) {
+	args := m.Called(ctx, mangaID, lang, volume, chapter)
+	return args.Bool(0), args.Error(1)
+}
+
 type subRepoMock struct {
 	mock.Mock
 }
@@ -65,8 +71,8 @@ func (m *subRepoMock) AllSubscriptions(ctx context.Context) ([]domain.Subscripti
 	return args.Get(0).([]domain.SubscriptionExtended), args.Error(1)
 }
 
-func (m *subRepoMock) SetSubscriptionLastUpdate(ctx context.Context, sub domain.Subscription, updatedAt time.Time, chapters ...domain.Chapter) error {
-	return m.Called(ctx, sub, updatedAt, chapters).Error(0)
+func (m *subRepoMock) SetSubscriptionLastUpdate(ctx context.Context, sub domain.Subscription, updatedAt time.Time, chapters []domain.Chapter, released []domain.Chapter, deliveries []domain.Delivery) error {
+	return m.Called(ctx, sub, updatedAt, chapters, released, deliveries).Error(0)
 }
 
 func (m *subRepoMock) IsChapterNotified(ctx context.Context, sub domain.Subscription, chapter domain.Chapter) (bool, error) {
@@ -78,6 +84,106 @@ func (m *subRepoMock) DeleteAllSubscriptions(ctx context.Context, recipient doma
 	return m.Called(ctx, recipient).Error(0)
 }
 
+func (m *subRepoMock) MarkChapterRead(ctx context.Context, recipient domain.Recipient, chapterID string) ([]domain.Subscription, error) {
+	args := m.Called(ctx, recipient, chapterID)
+	return args.Get(0).([]domain.Subscription), args.Error(1)
+}
+
+func (m *subRepoMock) UnreadSubscriptions(ctx context.Context, recipient domain.Recipient) ([]domain.UnreadSubscription, error) {
+	args := m.Called(ctx, recipient)
+	return args.Get(0).([]domain.UnreadSubscription), args.Error(1)
+}
+
+func (m *subRepoMock) UnreadCounts(ctx context.Context, sub domain.Subscription) (map[domain.Recipient]int, error) {
+	args := m.Called(ctx, sub)
+	return args.Get(0).(map[domain.Recipient]int), args.Error(1)
+}
+
+func (m *subRepoMock) SetStatusAlerts(ctx context.Context, recipient domain.Recipient, mangaID string, lang string, enabled bool) error {
+	return m.Called(ctx, recipient, mangaID, lang, enabled).Error(0)
+}
+
+func (m *subRepoMock) TopicSnapshot(ctx context.Context, sub domain.Subscription) (*domain.MangaSnapshot, error) {
+	args := m.Called(ctx, sub)
+	return args.Get(0).(*domain.MangaSnapshot), args.Error(1)
+}
+
+func (m *subRepoMock) SetTopicSnapshot(ctx context.Context, sub domain.Subscription, snapshot domain.MangaSnapshot) error {
+	return m.Called(ctx, sub, snapshot).Error(0)
+}
+
+func (m *subRepoMock) SetLanguageWatch(ctx context.Context, recipient domain.Recipient, watch domain.LanguageWatch) error {
+	return m.Called(ctx, recipient, watch).Error(0)
+}
+
+func (m *subRepoMock) DeleteLanguageWatch(ctx context.Context, recipient domain.Recipient, mangaID string, lang string) error {
+	return m.Called(ctx, recipient, mangaID, lang).Error(0)
+}
+
+func (m *subRepoMock) AllLanguageWatches(ctx context.Context) ([]domain.LanguageWatchExtended, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]domain.LanguageWatchExtended), args.Error(1)
+}
+
+func (m *subRepoMock) SetSubscriptionPriority(ctx context.Context, recipient domain.Recipient, mangaID string, lang string, priority int) error {
+	return m.Called(ctx, recipient, mangaID, lang, priority).Error(0)
+}
+
+func (m *subRepoMock) SetFirstLanguageOnly(ctx context.Context, recipient domain.Recipient, mangaID string, enabled bool) error {
+	return m.Called(ctx, recipient, mangaID, enabled).Error(0)
+}
+
+func (m *subRepoMock) IsChapterNotifiedToRecipient(ctx context.Context, recipient domain.Recipient, mangaID string, chapter string, exceptChapterID string, before time.Time) (bool, error) {
+	args := m.Called(ctx, recipient, mangaID, chapter, exceptChapterID, before)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *subRepoMock) ChapterFilter(ctx context.Context, recipient domain.Recipient) (*domain.ChapterFilter, error) {
+	args := m.Called(ctx, recipient)
+	return args.Get(0).(*domain.ChapterFilter), args.Error(1)
+}
+
+func (m *subRepoMock) SetChapterFilter(ctx context.Context, recipient domain.Recipient, filter domain.ChapterFilter) error {
+	return m.Called(ctx, recipient, filter).Error(0)
+}
+
+func (m *subRepoMock) ChapterFilters(ctx context.Context) (map[domain.Recipient]domain.ChapterFilter, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(map[domain.Recipient]domain.ChapterFilter), args.Error(1)
+}
+
+func (m *subRepoMock) AllUserSettings(ctx context.Context) (map[domain.Recipient]domain.UserSettings, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(map[domain.Recipient]domain.UserSettings), args.Error(1)
+}
+
+func (m *subRepoMock) RecipientFailure(ctx context.Context, recipient domain.Recipient) (*domain.RecipientFailure, error) {
+	args := m.Called(ctx, recipient)
+	return args.Get(0).(*domain.RecipientFailure), args.Error(1)
+}
+
+func (m *subRepoMock) FailedRecipients(ctx context.Context) ([]domain.Recipient, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]domain.Recipient), args.Error(1)
+}
+
+func (m *subRepoMock) SetRecipientFailure(ctx context.Context, recipient domain.Recipient, failure domain.RecipientFailure) error {
+	return m.Called(ctx, recipient, failure).Error(0)
+}
+
+func (m *subRepoMock) DeleteRecipientFailure(ctx context.Context, recipient domain.Recipient) error {
+	return m.Called(ctx, recipient).Error(0)
+}
+
+func (m *subRepoMock) MigrateRecipient(ctx context.Context, from domain.Recipient, to domain.Recipient) error {
+	return m.Called(ctx, from, to).Error(0)
+}
+
+func (m *subRepoMock) ReleasedChapters(ctx context.Context, sub domain.Subscription, now time.Time) ([]domain.Chapter, error) {
+	args := m.Called(ctx, sub, now)
+	return args.Get(0).([]domain.Chapter), args.Error(1)
+}
+
 func newRecipient() domain.Recipient {
 	return domain.RecipientFromInt64(rand.Int63())
 }
@@ -102,6 +208,40 @@ func TestManga(t *testing.T) {
 	mdexApi.AssertExpectations(t)
 }
 
+func TestCycleManga(t *testing.T) {
+	ctx := context.Background()
+	manga1 := domain.Manga{ID: "manga_1"}
+
+	mdexApi := &mdexAPIMock{}
+	subRepo := &subRepoMock{}
+	s := New(mdexApi, subRepo)
+
+	// every manga is requested once per update check, errors included
+	mdexApi.On("Manga", ctx, "manga_1").Return(manga1, nil).Twice()
+	mdexApi.On("Manga", ctx, "manga_2").Return(domain.Manga{}, ErrMangaNotFound).Once()
+
+	for i := 0; i < 2; i++ {
+		res, err := s.CycleManga(ctx, "manga_1")
+		assert.NoError(t, err)
+		assert.Equal(t, manga1, res)
+
+		_, err = s.CycleManga(ctx, "manga_2")
+		assert.ErrorIs(t, err, ErrMangaNotFound)
+	}
+
+	// a new check requests the manga again
+	subRepo.On("AllSubscriptions", ctx).Return(([]domain.SubscriptionExtended)(nil), fmt.Errorf("error")).Once()
+	_, err := s.QueueUpdates(ctx)
+	assert.Error(t, err)
+
+	res, err := s.CycleManga(ctx, "manga_1")
+	assert.NoError(t, err)
+	assert.Equal(t, manga1, res)
+
+	mdexApi.AssertExpectations(t)
+	subRepo.AssertExpectations(t)
+}
+
 func TestList(t *testing.T) {
 	rec1, rec2 := newRecipient(), newRecipient()
 
@@ -124,6 +264,63 @@ func TestList(t *testing.T) {
 	subRepo.AssertExpectations(t)
 }
 
+func TestListPage(t *testing.T) {
+	rec1, rec2 := newRecipient(), newRecipient()
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	subA := domain.Subscription{MangaID: "manga_a", MangaTitle: "Alpha", Language: "ja", LastChapterAt: now.Add(-time.Hour)}
+	subB := domain.Subscription{MangaID: "manga_b", MangaTitle: "Beta", Language: "en"}
+	subC := domain.Subscription{MangaID: "manga_c", MangaTitle: "Gamma", Language: "en", LastChapterAt: now}
+	subD := domain.Subscription{MangaID: "manga_d", MangaTitle: "Delta Beta", Language: "es", LastChapterAt: now.Add(-2 * time.Hour)}
+	// ordered by title as returned by storage
+	subs := []domain.Subscription{subA, subB, subD, subC}
+
+	subRepo := &subRepoMock{}
+	subRepo.On("UserSubscriptions", ctx, rec1).Return(subs, nil)
+	subRepo.On("UserSubscriptions", ctx, rec2).Return(([]domain.Subscription)(nil), fmt.Errorf("error"))
+
+	s := New(nil, subRepo)
+
+	page, err := s.ListPage(ctx, rec1, domain.SubscriptionQuery{Sort: domain.SortByTitle, PageSize: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, domain.SubscriptionPage{Subscriptions: []domain.Subscription{subA, subB, subD}, Page: 0, Pages: 2, Total: 4}, page)
+
+	page, err = s.ListPage(ctx, rec1, domain.SubscriptionQuery{Sort: domain.SortByTitle, Page: 1, PageSize: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Subscription{subC}, page.Subscriptions)
+
+	page, err = s.ListPage(ctx, rec1, domain.SubscriptionQuery{Sort: domain.SortByTitle, Page: 5, PageSize: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, page.Page, "the last page expected when the page is out of range")
+
+	page, err = s.ListPage(ctx, rec1, domain.SubscriptionQuery{Sort: domain.SortByUpdated, PageSize: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Subscription{subC, subA, subD, subB}, page.Subscriptions)
+
+	page, err = s.ListPage(ctx, rec1, domain.SubscriptionQuery{Sort: domain.SortByLanguage, PageSize: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Subscription{subB, subC, subD, subA}, page.Subscriptions)
+
+	page, err = s.ListPage(ctx, rec1, domain.SubscriptionQuery{Filter: " beta", PageSize: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Subscription{subB, subD}, page.Subscriptions)
+	assert.Equal(t, 2, page.Total)
+
+	page, err = s.ListPage(ctx, rec1, domain.SubscriptionQuery{Filter: "EN", PageSize: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Subscription{subB, subC}, page.Subscriptions, "filter by language expected")
+
+	page, err = s.ListPage(ctx, rec1, domain.SubscriptionQuery{Filter: "omega", PageSize: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, domain.SubscriptionPage{}, page)
+
+	_, err = s.ListPage(ctx, rec2, domain.SubscriptionQuery{PageSize: 10})
+	assert.Error(t, err, "error from storage.UserSubscriptions expected")
+
+	subRepo.AssertExpectations(t)
+}
+
 func TestSubscribe_Errors(t *testing.T) {
 	user := newRecipient()
 	ctx := context.Background()
@@ -152,15 +349,6 @@ func TestSubscribe_Errors(t *testing.T) {
 	subRepo.AssertExpectations(t)
 	calls.Reset()
 
-	// delete any
-	calls.Add(subRepo.On("UserSubscriptions", ctx, user).Return([]domain.Subscription{sub}, nil))
-	calls.Add(subRepo.On("DeleteUserSubscription", ctx, user, sub.MangaID, sub.Language).Return(fmt.Errorf("error")))
-	_, err = s.Subscribe(ctx, user, sub.MangaID, "en")
-	assert.Error(t, err, "error from storage.DeleteUserSubscription expected")
-	mdexApi.AssertExpectations(t)
-	subRepo.AssertExpectations(t)
-	calls.Reset()
-
 	// mdex.Manga error
 	calls.Add(subRepo.On("UserSubscriptions", ctx, user).Return([]domain.Subscription{}, nil))
 	calls.Add(mdexApi.On("Manga", ctx, sub.MangaID).Return(domain.Manga{}, fmt.Errorf("error")))
@@ -184,17 +372,16 @@ func TestSubscribe_Errors(t *testing.T) {
 func TestSubscribe_Success(t *testing.T) {
 	user := newRecipient()
 	ctx := context.Background()
-	sub1 := domain.Subscription{MangaID: "manga_1", Language: "en", MangaTitle: "manga 1"}
-	sub2 := domain.Subscription{MangaID: "manga_1", Language: "es", MangaTitle: "manga 1"}
-	expRes := domain.Subscription{MangaID: "manga_1", Language: "any", MangaTitle: "manga 1"}
+	sub1 := domain.Subscription{MangaID: "manga_1", Language: "en", MangaTitle: "manga 1", Priority: 0, FirstLanguageOnly: true}
+	sub2 := domain.Subscription{MangaID: "manga_1", Language: "es", MangaTitle: "manga 1", Priority: 1, FirstLanguageOnly: true}
+	sub3 := domain.Subscription{MangaID: "manga_2", Language: "ru", MangaTitle: "manga 2", Priority: 5}
+	expRes := domain.Subscription{MangaID: "manga_1", Language: "any", MangaTitle: "manga 1", Priority: 2, FirstLanguageOnly: true}
 
 	mdexApi := &mdexAPIMock{}
 	subRepo := &subRepoMock{}
 	s := New(mdexApi, subRepo)
 
-	subRepo.On("UserSubscriptions", ctx, user).Return([]domain.Subscription{sub1, sub2}, nil)
-	subRepo.On("DeleteUserSubscription", ctx, user, sub1.MangaID, sub1.Language).Return(nil)
-	subRepo.On("DeleteUserSubscription", ctx, user, sub2.MangaID, sub2.Language).Return(nil)
+	subRepo.On("UserSubscriptions", ctx, user).Return([]domain.Subscription{sub1, sub2, sub3}, nil)
 	mdexApi.On("Manga", ctx, expRes.MangaID).Return(
 		domain.Manga{ID: expRes.MangaID, Title: map[string]string{expRes.Language: expRes.MangaTitle}},
 		nil,
@@ -208,6 +395,30 @@ func TestSubscribe_Success(t *testing.T) {
 	subRepo.AssertExpectations(t)
 }
 
+func TestSubscribe_Limit(t *testing.T) {
+	user := newRecipient()
+	ctx := context.Background()
+	sub1 := domain.Subscription{MangaID: "manga_1", Language: "en", MangaTitle: "manga 1"}
+	sub2 := domain.Subscription{MangaID: "manga_2", Language: "en", MangaTitle: "manga 2"}
+
+	mdexApi := &mdexAPIMock{}
+	subRepo := &subRepoMock{}
+	s := New(mdexApi, subRepo, WithMaxSubscriptions(2))
+
+	subRepo.On("UserSubscriptions", ctx, user).Return([]domain.Subscription{sub1, sub2}, nil)
+
+	// the limit is checked before MangaDex is requested
+	_, err := s.Subscribe(ctx, user, "manga_3", "en")
+	assert.Equal(t, &SubscriptionLimitError{Limit: 2}, err)
+
+	// a subscription that already exists is reported as such
+	_, err = s.Subscribe(ctx, user, sub1.MangaID, sub1.Language)
+	assert.Equal(t, &AlreadySubscribedError{Manga: sub1.MangaTitle, Lang: sub1.Language}, err)
+
+	mdexApi.AssertExpectations(t)
+	subRepo.AssertExpectations(t)
+}
+
 func TestUnsubscribe_Errors(t *testing.T) {
 	user := newRecipient()
 	ctx := context.Background()
@@ -249,11 +460,13 @@ func TestUnsubscribe_Success(t *testing.T) {
 	s := New(nil, subRepo)
 
 	sub1 := domain.Subscription{MangaID: "manga_1", Language: "en"}
-	sub2 := domain.Subscription{MangaID: "manga_1", Language: "es"}
+	sub2 := domain.Subscription{MangaID: "manga_1", Language: "es", Priority: 1}
+	sub3 := domain.Subscription{MangaID: "manga_2", Language: "en", Priority: 1}
 
-	// storage.DeleteUserSubscription errr
-	subRepo.On("UserSubscriptions", ctx, user).Return([]domain.Subscription{sub1, sub2}, nil)
+	// languages after the deleted one are moved up
+	subRepo.On("UserSubscriptions", ctx, user).Return([]domain.Subscription{sub1, sub2, sub3}, nil)
 	subRepo.On("DeleteUserSubscription", ctx, user, sub1.MangaID, sub1.Language).Return(nil)
+	subRepo.On("SetSubscriptionPriority", ctx, user, sub2.MangaID, sub2.Language, 0).Return(nil)
 	resSub, err := s.Unsubscribe(ctx, user, sub1.MangaID, sub1.Language)
 	assert.NoError(t, err)
 	assert.Equal(t, sub1, resSub)
@@ -279,7 +492,7 @@ func TestUnsubscribeAll(t *testing.T) {
 	subRepo.AssertExpectations(t)
 }
 
-func TestUpdates_Error(t *testing.T) {
+func TestQueueUpdates_Error(t *testing.T) {
 	user := newRecipient()
 	ctx := context.Background()
 
@@ -301,17 +514,27 @@ func TestUpdates_Error(t *testing.T) {
 
 	// storage.AllSubscriptions error
 	calls.Add(subRepo.On("AllSubscriptions", ctx).Return(([]domain.SubscriptionExtended)(nil), fmt.Errorf("error")))
-	_, err := s.Updates(ctx)
+	_, err := s.QueueUpdates(ctx)
 	assert.Error(t, err, "error from storage.AllSubscriptions expected")
 	subRepo.AssertExpectations(t)
 	mdexApi.AssertExpectations(t)
 	calls.Reset()
 
+	// storage.ChapterFilters error
+	calls.Add(subRepo.On("AllSubscriptions", ctx).Return([]domain.SubscriptionExtended{sub1}, nil))
+	calls.Add(subRepo.On("ChapterFilters", ctx).Return((map[domain.Recipient]domain.ChapterFilter)(nil), fmt.Errorf("error")))
+	_, err = s.QueueUpdates(ctx)
+	assert.Error(t, err, "error from storage.ChapterFilters expected")
+	subRepo.AssertExpectations(t)
+	mdexApi.AssertExpectations(t)
+	calls.Reset()
+
 	// cancelled context error
 	cancelledCtx, cancel := context.WithCancel(ctx)
 	cancel()
 	calls.Add(subRepo.On("AllSubscriptions", cancelledCtx).Return([]domain.SubscriptionExtended{sub1}, nil))
-	_, err = s.Updates(cancelledCtx)
+	calls.Add(subRepo.On("ChapterFilters", cancelledCtx).Return(map[domain.Recipient]domain.ChapterFilter{}, nil))
+	_, err = s.QueueUpdates(cancelledCtx)
 	assert.Error(t, err, "error caused by cancelled context expected")
 	subRepo.AssertExpectations(t)
 	mdexApi.AssertExpectations(t)
@@ -319,8 +542,9 @@ func TestUpdates_Error(t *testing.T) {
 
 	// mdex.LastChapters error
 	calls.Add(subRepo.On("AllSubscriptions", ctx).Return([]domain.SubscriptionExtended{sub1}, nil))
+	calls.Add(subRepo.On("ChapterFilters", ctx).Return(map[domain.Recipient]domain.ChapterFilter{}, nil))
 	calls.Add(mdexApi.On("LastChapters", ctx, sub1.MangaID, &sub1.Language, &publishedSince).Return(([]domain.Chapter)(nil), fmt.Errorf("error")))
-	_, err = s.Updates(ctx)
+	_, err = s.QueueUpdates(ctx)
 	assert.Error(t, err, "error mdex.LastChapters expected")
 	subRepo.AssertExpectations(t)
 	mdexApi.AssertExpectations(t)
@@ -328,9 +552,10 @@ func TestUpdates_Error(t *testing.T) {
 
 	// storage.IsChapterNotified error
 	calls.Add(subRepo.On("AllSubscriptions", ctx).Return([]domain.SubscriptionExtended{sub1}, nil))
+	calls.Add(subRepo.On("ChapterFilters", ctx).Return(map[domain.Recipient]domain.ChapterFilter{}, nil))
 	calls.Add(mdexApi.On("LastChapters", ctx, sub1.MangaID, &sub1.Language, &publishedSince).Return([]domain.Chapter{chap1}, nil))
 	calls.Add(subRepo.On("IsChapterNotified", ctx, sub1.Subscription, chap1).Return(false, fmt.Errorf("error")))
-	_, err = s.Updates(ctx)
+	_, err = s.QueueUpdates(ctx)
 	assert.Error(t, err, "error storage.IsChapterNotified expected")
 	subRepo.AssertExpectations(t)
 	mdexApi.AssertExpectations(t)
@@ -338,16 +563,45 @@ func TestUpdates_Error(t *testing.T) {
 
 	// storage.SetSubscriptionLastUpdate error
 	calls.Add(subRepo.On("AllSubscriptions", ctx).Return([]domain.SubscriptionExtended{sub1}, nil))
+	calls.Add(subRepo.On("ChapterFilters", ctx).Return(map[domain.Recipient]domain.ChapterFilter{}, nil))
 	calls.Add(mdexApi.On("LastChapters", ctx, sub1.MangaID, &sub1.Language, &publishedSince).Return([]domain.Chapter{}, nil))
-	calls.Add(subRepo.On("SetSubscriptionLastUpdate", ctx, sub1.Subscription, mock.Anything, []domain.Chapter{}).Return(fmt.Errorf("error")))
-	_, err = s.Updates(ctx)
+	calls.Add(subRepo.On("ReleasedChapters", ctx, sub1.Subscription, mock.Anything).Return(([]domain.Chapter)(nil), nil))
+	calls.Add(subRepo.On("SetSubscriptionLastUpdate", ctx, sub1.Subscription, mock.Anything, []domain.Chapter{}, ([]domain.Chapter)(nil), ([]domain.Delivery)(nil)).Return(fmt.Errorf("error")))
+	_, err = s.QueueUpdates(ctx)
 	assert.Error(t, err, "error storage.SetSubscriptionLastUpdate expected")
 	subRepo.AssertExpectations(t)
 	mdexApi.AssertExpectations(t)
 	calls.Reset()
+
+	// storage.UnreadCounts error
+	calls.Add(subRepo.On("AllSubscriptions", ctx).Return([]domain.SubscriptionExtended{sub1}, nil))
+	calls.Add(subRepo.On("ChapterFilters", ctx).Return(map[domain.Recipient]domain.ChapterFilter{}, nil))
+	calls.Add(mdexApi.On("LastChapters", ctx, sub1.MangaID, &sub1.Language, &publishedSince).Return([]domain.Chapter{chap1}, nil))
+	calls.Add(subRepo.On("IsChapterNotified", ctx, sub1.Subscription, chap1).Return(false, nil))
+	calls.Add(subRepo.On("ReleasedChapters", ctx, sub1.Subscription, mock.Anything).Return(([]domain.Chapter)(nil), nil))
+	calls.Add(subRepo.On("UnreadCounts", ctx, sub1.Subscription).Return((map[domain.Recipient]int)(nil), fmt.Errorf("error")))
+	_, err = s.QueueUpdates(ctx)
+	assert.Error(t, err, "error storage.UnreadCounts expected")
+	subRepo.AssertExpectations(t)
+	mdexApi.AssertExpectations(t)
+	calls.Reset()
+
+	// storage.AllUserSettings error
+	calls.Add(subRepo.On("AllSubscriptions", ctx).Return([]domain.SubscriptionExtended{sub1}, nil))
+	calls.Add(subRepo.On("ChapterFilters", ctx).Return(map[domain.Recipient]domain.ChapterFilter{}, nil))
+	calls.Add(mdexApi.On("LastChapters", ctx, sub1.MangaID, &sub1.Language, &publishedSince).Return([]domain.Chapter{chap1}, nil))
+	calls.Add(subRepo.On("IsChapterNotified", ctx, sub1.Subscription, chap1).Return(false, nil))
+	calls.Add(subRepo.On("ReleasedChapters", ctx, sub1.Subscription, mock.Anything).Return(([]domain.Chapter)(nil), nil))
+	calls.Add(subRepo.On("UnreadCounts", ctx, sub1.Subscription).Return(map[domain.Recipient]int{}, nil))
+	calls.Add(subRepo.On("AllUserSettings", ctx).Return((map[domain.Recipient]domain.UserSettings)(nil), fmt.Errorf("error")))
+	_, err = s.QueueUpdates(ctx)
+	assert.Error(t, err, "error storage.AllUserSettings expected")
+	subRepo.AssertExpectations(t)
+	mdexApi.AssertExpectations(t)
+	calls.Reset()
 }
 
-func TestUpdates_Success(t *testing.T) {
+func TestQueueUpdates_Success(t *testing.T) {
 	user := newRecipient()
 	ctx := context.Background()
 
@@ -367,21 +621,734 @@ func TestUpdates_Success(t *testing.T) {
 			Language:    sub1.Language,
 			NewChapters: []domain.Chapter{chap1},
 			Recipients:  sub1.Recipients,
+			Unread:      map[domain.Recipient]int{user: 4},
 		},
 	}
+	expDeliveries := []domain.Delivery{domain.NewDelivery(expUpdates[0], user)}
 
 	mdexApi := &mdexAPIMock{}
 	subRepo := &subRepoMock{}
 	s := New(mdexApi, subRepo)
 
 	subRepo.On("AllSubscriptions", ctx).Return([]domain.SubscriptionExtended{sub1}, nil)
+	subRepo.On("ChapterFilters", ctx).Return(map[domain.Recipient]domain.ChapterFilter{}, nil)
 	mdexApi.On("LastChapters", ctx, sub1.MangaID, (*string)(nil), &publishedSince).Return([]domain.Chapter{chap1, chap1dup}, nil)
 	subRepo.On("IsChapterNotified", ctx, sub1.Subscription, chap1).Return(false, nil)
 	subRepo.On("IsChapterNotified", ctx, sub1.Subscription, chap1dup).Return(false, nil)
-	subRepo.On("SetSubscriptionLastUpdate", ctx, sub1.Subscription, mock.Anything, []domain.Chapter{chap1}).Return(nil)
-	updates, err := s.Updates(ctx)
+	subRepo.On("SetSubscriptionLastUpdate", ctx, sub1.Subscription, mock.Anything, []domain.Chapter{chap1}, ([]domain.Chapter)(nil), expDeliveries).Return(nil)
+	subRepo.On("ReleasedChapters", ctx, sub1.Subscription, mock.Anything).Return(([]domain.Chapter)(nil), nil)
+	subRepo.On("UnreadCounts", ctx, sub1.Subscription).Return(map[domain.Recipient]int{user: 3}, nil)
+	subRepo.On("AllUserSettings", ctx).Return(map[domain.Recipient]domain.UserSettings{}, nil)
+	updates, err := s.QueueUpdates(ctx)
 	assert.NoError(t, err)
 	assert.ElementsMatch(t, updates, expUpdates)
 	subRepo.AssertExpectations(t)
 	mdexApi.AssertExpectations(t)
 }
+
+func TestQueueUpdates_ChapterFilters(t *testing.T) {
+	userDefault, userSafe, userLater, userRelease := newRecipient(), newRecipient(), newRecipient(), newRecipient()
+	ctx := context.Background()
+
+	sub1 := domain.SubscriptionExtended{
+		Subscription: domain.Subscription{MangaID: "manga_1", Language: "en", MangaTitle: "manga 1"},
+		Recipients:   []domain.Recipient{userDefault, userSafe, userLater, userRelease},
+		UpdatedAt:    time.Date(2022, 12, 1, 0, 0, 0, 0, time.Local),
+	}
+	publishedSince := sub1.UpdatedAt.Add(-PublishedSinceDelay)
+
+	chapSafe := domain.Chapter{ID: "ch_1", Chapter: "1", ContentRating: "safe"}
+	chapErotica := domain.Chapter{ID: "ch_2", Chapter: "2", ContentRating: "erotica"}
+	chapScheduled := domain.Chapter{ID: "ch_3", Chapter: "3", ContentRating: "safe", PublishedAt: time.Now().Add(time.Hour)}
+	chapReleased := domain.Chapter{ID: "ch_0", Chapter: "0", ContentRating: "safe"}
+
+	filters := map[domain.Recipient]domain.ChapterFilter{
+		userSafe:    {ContentRatings: []string{"safe"}, IncludeExternal: true, IncludeScheduled: true},
+		userLater:   {ContentRatings: domain.ContentRatings, IncludeExternal: true},
+		userRelease: {ContentRatings: domain.ContentRatings, IncludeExternal: true, IncludeScheduled: true, NotifyOnRelease: true},
+	}
+
+	expUpdates := []domain.Update{
+		{
+			MangaID:     sub1.MangaID,
+			MangaTitle:  sub1.MangaTitle,
+			Language:    sub1.Language,
+			NewChapters: []domain.Chapter{chapSafe, chapErotica, chapScheduled},
+			Recipients:  []domain.Recipient{userDefault, userRelease},
+			Unread:      map[domain.Recipient]int{userDefault: 4, userRelease: 4},
+		},
+		{
+			MangaID:     sub1.MangaID,
+			MangaTitle:  sub1.MangaTitle,
+			Language:    sub1.Language,
+			NewChapters: []domain.Chapter{chapSafe, chapScheduled},
+			Recipients:  []domain.Recipient{userSafe},
+			Unread:      map[domain.Recipient]int{userSafe: 3},
+		},
+		{
+			MangaID:     sub1.MangaID,
+			MangaTitle:  sub1.MangaTitle,
+			Language:    sub1.Language,
+			NewChapters: []domain.Chapter{chapSafe, chapErotica, chapReleased},
+			Recipients:  []domain.Recipient{userLater},
+			// the released chapter has been saved earlier and is counted already
+			Unread: map[domain.Recipient]int{userLater: 3},
+		},
+		{
+			MangaID:     sub1.MangaID,
+			MangaTitle:  sub1.MangaTitle,
+			Language:    sub1.Language,
+			NewChapters: []domain.Chapter{chapReleased},
+			Recipients:  []domain.Recipient{userRelease},
+			Unread:      map[domain.Recipient]int{userRelease: 4},
+			Released:    true,
+		},
+	}
+
+	mdexApi := &mdexAPIMock{}
+	subRepo := &subRepoMock{}
+	s := New(mdexApi, subRepo)
+
+	chapters := []domain.Chapter{chapSafe, chapErotica, chapScheduled}
+
+	subRepo.On("AllSubscriptions", ctx).Return([]domain.SubscriptionExtended{sub1}, nil)
+	subRepo.On("ChapterFilters", ctx).Return(filters, nil)
+	mdexApi.On("LastChapters", ctx, sub1.MangaID, &sub1.Language, &publishedSince).Return(chapters, nil)
+	subRepo.On("IsChapterNotified", ctx, sub1.Subscription, mock.Anything).Return(false, nil)
+	subRepo.On("SetSubscriptionLastUpdate", ctx, sub1.Subscription, mock.Anything, chapters, []domain.Chapter{chapReleased}, mock.Anything).Return(nil)
+	subRepo.On("ReleasedChapters", ctx, sub1.Subscription, mock.Anything).Return([]domain.Chapter{chapReleased}, nil)
+	// the released chapter is unread by everyone
+	subRepo.On("UnreadCounts", ctx, sub1.Subscription).Return(map[domain.Recipient]int{
+		userDefault: 1, userSafe: 1, userLater: 1, userRelease: 1,
+	}, nil)
+	subRepo.On("AllUserSettings", ctx).Return(map[domain.Recipient]domain.UserSettings{}, nil)
+
+	updates, err := s.QueueUpdates(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, expUpdates, updates)
+	subRepo.AssertExpectations(t)
+	mdexApi.AssertExpectations(t)
+}
+
+func TestQueueUpdates_Digest(t *testing.T) {
+	userInstant, userDigest := newRecipient(), newRecipient()
+	ctx := context.Background()
+
+	sub1 := domain.SubscriptionExtended{
+		Subscription: domain.Subscription{MangaID: "manga_1", Language: "en", MangaTitle: "manga 1"},
+		Recipients:   []domain.Recipient{userInstant, userDigest},
+		UpdatedAt:    time.Date(2022, 12, 1, 0, 0, 0, 0, time.Local),
+	}
+	chap1 := domain.Chapter{ID: "ch_1", Chapter: "1"}
+
+	settings := map[domain.Recipient]domain.UserSettings{
+		userInstant: domain.DefaultUserSettings(),
+		userDigest:  {TimeZone: "UTC", DigestMode: domain.DigestHourly},
+	}
+
+	mdexApi := &mdexAPIMock{}
+	subRepo := &subRepoMock{}
+	s := New(mdexApi, subRepo)
+
+	var deliveries []domain.Delivery
+	subRepo.On("AllSubscriptions", ctx).Return([]domain.SubscriptionExtended{sub1}, nil)
+	subRepo.On("ChapterFilters", ctx).Return(map[domain.Recipient]domain.ChapterFilter{}, nil)
+	mdexApi.On("LastChapters", ctx, sub1.MangaID, &sub1.Language, mock.Anything).Return([]domain.Chapter{chap1}, nil)
+	subRepo.On("IsChapterNotified", ctx, sub1.Subscription, chap1).Return(false, nil)
+	subRepo.On("ReleasedChapters", ctx, sub1.Subscription, mock.Anything).Return(([]domain.Chapter)(nil), nil)
+	subRepo.On("UnreadCounts", ctx, sub1.Subscription).Return(map[domain.Recipient]int{}, nil)
+	subRepo.On("AllUserSettings", ctx).Return(settings, nil)
+	subRepo.On("SetSubscriptionLastUpdate", ctx, sub1.Subscription, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { deliveries = args.Get(5).([]domain.Delivery) }).
+		Return(nil)
+
+	_, err := s.QueueUpdates(ctx)
+	assert.NoError(t, err)
+	subRepo.AssertExpectations(t)
+
+	assert.Len(t, deliveries, 2)
+	for _, d := range deliveries {
+		switch d.Recipient {
+		case userInstant:
+			assert.False(t, d.Digest)
+			assert.True(t, d.NotBefore.IsZero())
+		case userDigest:
+			assert.True(t, d.Digest)
+			assert.True(t, d.NotBefore.After(time.Now()), "digest must be postponed")
+			assert.Zero(t, d.NotBefore.Minute())
+		}
+	}
+}
+
+func TestChapterFilter(t *testing.T) {
+	rec1, rec2, rec3 := newRecipient(), newRecipient(), newRecipient()
+	ctx := context.Background()
+
+	filter := domain.ChapterFilter{ContentRatings: []string{"safe"}}
+
+	subRepo := &subRepoMock{}
+	subRepo.On("ChapterFilter", ctx, rec1).Return(&filter, nil)
+	subRepo.On("ChapterFilter", ctx, rec2).Return((*domain.ChapterFilter)(nil), nil)
+	subRepo.On("ChapterFilter", ctx, rec3).Return((*domain.ChapterFilter)(nil), fmt.Errorf("error"))
+
+	s := New(nil, subRepo)
+
+	res1, err1 := s.ChapterFilter(ctx, rec1)
+	assert.NoError(t, err1)
+	assert.Equal(t, filter, res1)
+
+	res2, err2 := s.ChapterFilter(ctx, rec2)
+	assert.NoError(t, err2)
+	assert.Equal(t, domain.DefaultChapterFilter(), res2, "default filter expected")
+
+	_, err3 := s.ChapterFilter(ctx, rec3)
+	assert.Error(t, err3, "error from storage.ChapterFilter expected")
+
+	subRepo.AssertExpectations(t)
+}
+
+func TestMarkRead(t *testing.T) {
+	rec := newRecipient()
+	ctx := context.Background()
+
+	sub1 := domain.Subscription{MangaID: "manga_1", Language: "en", MangaTitle: "manga 1"}
+
+	subRepo := &subRepoMock{}
+	subRepo.On("MarkChapterRead", ctx, rec, "ch_1").Return([]domain.Subscription{sub1}, nil)
+	subRepo.On("MarkChapterRead", ctx, rec, "ch_2").Return([]domain.Subscription{}, nil)
+	subRepo.On("MarkChapterRead", ctx, rec, "ch_3").Return(([]domain.Subscription)(nil), fmt.Errorf("error"))
+
+	s := New(nil, subRepo)
+
+	res1, err1 := s.MarkRead(ctx, rec, "ch_1")
+	assert.NoError(t, err1)
+	assert.Equal(t, []domain.Subscription{sub1}, res1)
+
+	_, err2 := s.MarkRead(ctx, rec, "ch_2")
+	assert.ErrorIs(t, err2, ErrNoSuchSubscription, "ErrNoSuchSubscription error expected")
+
+	_, err3 := s.MarkRead(ctx, rec, "ch_3")
+	assert.Error(t, err3, "error from storage.MarkChapterRead expected")
+
+	subRepo.AssertExpectations(t)
+}
+
+func TestUnread(t *testing.T) {
+	rec1, rec2 := newRecipient(), newRecipient()
+	ctx := context.Background()
+
+	expRes1 := []domain.UnreadSubscription{
+		{Subscription: domain.Subscription{MangaID: "manga_1", Language: "en"}, Unread: 2},
+	}
+
+	subRepo := &subRepoMock{}
+	subRepo.On("UnreadSubscriptions", ctx, rec1).Return(expRes1, nil)
+	subRepo.On("UnreadSubscriptions", ctx, rec2).Return(([]domain.UnreadSubscription)(nil), fmt.Errorf("error"))
+
+	s := New(nil, subRepo)
+
+	res1, err1 := s.Unread(ctx, rec1)
+	assert.NoError(t, err1)
+	assert.Equal(t, expRes1, res1)
+
+	_, err2 := s.Unread(ctx, rec2)
+	assert.Error(t, err2, "error from storage.UnreadSubscriptions expected")
+
+	subRepo.AssertExpectations(t)
+}
+
+func TestToggleStatusAlerts(t *testing.T) {
+	user := newRecipient()
+	ctx := context.Background()
+
+	sub1 := domain.Subscription{MangaID: "manga_1", Language: "en"}
+	sub2 := domain.Subscription{MangaID: "manga_2", Language: "es", StatusAlerts: true}
+
+	subRepo := &subRepoMock{}
+	s := New(nil, subRepo)
+
+	calls := mockCalls{}
+
+	// ErrNoSuchSubscription
+	calls.Add(subRepo.On("UserSubscriptions", ctx, user).Return([]domain.Subscription{sub1}, nil))
+	_, err := s.ToggleStatusAlerts(ctx, user, "manga_3", "en")
+	assert.ErrorIs(t, err, ErrNoSuchSubscription, "ErrNoSuchSubscription error expected")
+	subRepo.AssertExpectations(t)
+	calls.Reset()
+
+	// storage.SetStatusAlerts error
+	calls.Add(subRepo.On("UserSubscriptions", ctx, user).Return([]domain.Subscription{sub1}, nil))
+	calls.Add(subRepo.On("SetStatusAlerts", ctx, user, sub1.MangaID, sub1.Language, true).Return(fmt.Errorf("error")))
+	_, err = s.ToggleStatusAlerts(ctx, user, sub1.MangaID, sub1.Language)
+	assert.Error(t, err, "error from storage.SetStatusAlerts expected")
+	subRepo.AssertExpectations(t)
+	calls.Reset()
+
+	// success
+	calls.Add(subRepo.On("UserSubscriptions", ctx, user).Return([]domain.Subscription{sub1, sub2}, nil))
+	calls.Add(subRepo.On("SetStatusAlerts", ctx, user, sub2.MangaID, sub2.Language, false).Return(nil))
+	res, err := s.ToggleStatusAlerts(ctx, user, sub2.MangaID, sub2.Language)
+	assert.NoError(t, err)
+	assert.False(t, res.StatusAlerts)
+	subRepo.AssertExpectations(t)
+	calls.Reset()
+}
+
+func TestStatusUpdates(t *testing.T) {
+	user1, user2 := newRecipient(), newRecipient()
+	ctx := context.Background()
+
+	sub1 := domain.SubscriptionExtended{
+		Subscription:    domain.Subscription{MangaID: "manga_1", Language: "en", MangaTitle: "manga 1"},
+		Recipients:      []domain.Recipient{user1, user2},
+		AlertRecipients: []domain.Recipient{user1},
+	}
+	sub2 := domain.SubscriptionExtended{
+		Subscription: domain.Subscription{MangaID: "manga_2", Language: "en", MangaTitle: "manga 2"},
+		Recipients:   []domain.Recipient{user2},
+	}
+
+	manga1 := domain.Manga{
+		ID:                   "manga_1",
+		Status:               "completed",
+		TranslationLanguages: []string{"en", "es"},
+		LastChapter:          "100",
+	}
+	manga2 := domain.Manga{ID: "manga_2", Status: "hiatus"}
+	prev := &domain.MangaSnapshot{
+		Status:               "ongoing",
+		TranslationLanguages: []string{"en"},
+	}
+
+	expUpdates := []domain.StatusUpdate{
+		{
+			MangaTitle:   sub1.MangaTitle,
+			MangaID:      sub1.MangaID,
+			Language:     sub1.Language,
+			Recipients:   sub1.AlertRecipients,
+			OldStatus:    "ongoing",
+			NewStatus:    "completed",
+			NewLanguages: []string{"es"},
+			FinalChapter: true,
+		},
+	}
+
+	mdexApi := &mdexAPIMock{}
+	subRepo := &subRepoMock{}
+	s := New(mdexApi, subRepo)
+
+	subRepo.On("AllSubscriptions", ctx).Return([]domain.SubscriptionExtended{sub1, sub2}, nil)
+	mdexApi.On("Manga", ctx, sub1.MangaID).Return(manga1, nil)
+	subRepo.On("TopicSnapshot", ctx, sub1.Subscription).Return(prev, nil)
+	mdexApi.On("ChapterPublished", ctx, sub1.MangaID, &sub1.Language, "", "100").Return(true, nil)
+	subRepo.On("SetTopicSnapshot", ctx, sub1.Subscription, manga1.Snapshot(true)).Return(nil)
+	// the snapshot is refreshed without alert recipients
+	mdexApi.On("Manga", ctx, sub2.MangaID).Return(manga2, nil)
+	subRepo.On("TopicSnapshot", ctx, sub2.Subscription).Return(&domain.MangaSnapshot{Status: "ongoing"}, nil)
+	subRepo.On("SetTopicSnapshot", ctx, sub2.Subscription, manga2.Snapshot(false)).Return(nil)
+
+	updates, err := s.StatusUpdates(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, expUpdates, updates)
+	subRepo.AssertExpectations(t)
+	mdexApi.AssertExpectations(t)
+}
+
+func TestStatusUpdates_FirstSnapshot(t *testing.T) {
+	user := newRecipient()
+	ctx := context.Background()
+
+	sub1 := domain.SubscriptionExtended{
+		Subscription:    domain.Subscription{MangaID: "manga_1", Language: "any"},
+		Recipients:      []domain.Recipient{user},
+		AlertRecipients: []domain.Recipient{user},
+	}
+	manga1 := domain.Manga{ID: "manga_1", Status: "ongoing"}
+
+	mdexApi := &mdexAPIMock{}
+	subRepo := &subRepoMock{}
+	s := New(mdexApi, subRepo)
+
+	subRepo.On("AllSubscriptions", ctx).Return([]domain.SubscriptionExtended{sub1}, nil)
+	mdexApi.On("Manga", ctx, sub1.MangaID).Return(manga1, nil)
+	subRepo.On("TopicSnapshot", ctx, sub1.Subscription).Return((*domain.MangaSnapshot)(nil), nil)
+	subRepo.On("SetTopicSnapshot", ctx, sub1.Subscription, manga1.Snapshot(false)).Return(nil)
+
+	updates, err := s.StatusUpdates(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, updates)
+	subRepo.AssertExpectations(t)
+	mdexApi.AssertExpectations(t)
+}
+
+func TestStatusUpdates_LastCycle(t *testing.T) {
+	user := newRecipient()
+	ctx := context.Background()
+
+	sub1 := domain.SubscriptionExtended{
+		Subscription:    domain.Subscription{MangaID: "manga_1", Language: "en"},
+		Recipients:      []domain.Recipient{user},
+		AlertRecipients: []domain.Recipient{user},
+	}
+	sub2 := domain.SubscriptionExtended{
+		Subscription:    domain.Subscription{MangaID: "manga_1", Language: "es"},
+		Recipients:      []domain.Recipient{user},
+		AlertRecipients: []domain.Recipient{user},
+	}
+	manga1 := domain.Manga{ID: "manga_1", Status: "completed", LastChapter: "10"}
+	prev := &domain.MangaSnapshot{Status: "completed", LastChapter: "10"}
+
+	mdexApi := &mdexAPIMock{}
+	subRepo := &subRepoMock{}
+	s := New(mdexApi, subRepo).(*service)
+	s.lastCycle = map[topicKey][]domain.Chapter{
+		{mangaID: "manga_1", lang: "en"}: {{ID: "ch_10", Chapter: "10"}},
+		{mangaID: "manga_1", lang: "es"}: {},
+	}
+
+	// the manga is requested once, chapters of the last cycle are used instead of ChapterPublished
+	subRepo.On("AllSubscriptions", ctx).Return([]domain.SubscriptionExtended{sub1, sub2}, nil)
+	mdexApi.On("Manga", ctx, manga1.ID).Return(manga1, nil).Once()
+	subRepo.On("TopicSnapshot", ctx, sub1.Subscription).Return(prev, nil)
+	subRepo.On("SetTopicSnapshot", ctx, sub1.Subscription, manga1.Snapshot(true)).Return(nil)
+	subRepo.On("TopicSnapshot", ctx, sub2.Subscription).Return(prev, nil)
+	subRepo.On("SetTopicSnapshot", ctx, sub2.Subscription, manga1.Snapshot(false)).Return(nil)
+
+	updates, err := s.StatusUpdates(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.StatusUpdate{{
+		MangaID:      "manga_1",
+		Language:     "en",
+		Recipients:   sub1.AlertRecipients,
+		FinalChapter: true,
+	}}, updates)
+	assert.Nil(t, s.lastCycle, "chapters of the last cycle are used once")
+	subRepo.AssertExpectations(t)
+	mdexApi.AssertExpectations(t)
+}
+
+func TestWatchLanguage(t *testing.T) {
+	user := newRecipient()
+	ctx := context.Background()
+
+	manga := domain.Manga{
+		ID:                   "manga_1",
+		Title:                map[string]string{"en": "manga 1"},
+		TranslationLanguages: []string{"en"},
+	}
+	expRes := domain.LanguageWatch{MangaID: manga.ID, MangaTitle: "manga 1", Language: "es"}
+
+	mdexApi := &mdexAPIMock{}
+	subRepo := &subRepoMock{}
+	s := New(mdexApi, subRepo)
+
+	calls := mockCalls{}
+
+	// mdex.Manga error
+	calls.Add(mdexApi.On("Manga", ctx, manga.ID).Return(domain.Manga{}, fmt.Errorf("error")))
+	_, err := s.WatchLanguage(ctx, user, manga.ID, "es")
+	assert.Error(t, err, "error from mdex.Manga expected")
+	mdexApi.AssertExpectations(t)
+	subRepo.AssertExpectations(t)
+	calls.Reset()
+
+	// ErrLanguageAvailable
+	calls.Add(mdexApi.On("Manga", ctx, manga.ID).Return(manga, nil))
+	_, err = s.WatchLanguage(ctx, user, manga.ID, "en")
+	assert.ErrorIs(t, err, ErrLanguageAvailable, "ErrLanguageAvailable error expected")
+	mdexApi.AssertExpectations(t)
+	subRepo.AssertExpectations(t)
+	calls.Reset()
+
+	// success
+	calls.Add(mdexApi.On("Manga", ctx, manga.ID).Return(manga, nil))
+	calls.Add(subRepo.On("SetLanguageWatch", ctx, user, expRes).Return(nil))
+	res, err := s.WatchLanguage(ctx, user, manga.ID, "es")
+	assert.NoError(t, err)
+	assert.Equal(t, expRes, res)
+	mdexApi.AssertExpectations(t)
+	subRepo.AssertExpectations(t)
+	calls.Reset()
+}
+
+func TestLanguageUpdates(t *testing.T) {
+	user1, user2 := newRecipient(), newRecipient()
+	ctx := context.Background()
+
+	watch1 := domain.LanguageWatchExtended{
+		LanguageWatch: domain.LanguageWatch{MangaID: "manga_1", Language: "es"},
+		Recipients:    []domain.Recipient{user1, user2},
+	}
+	watch2 := domain.LanguageWatchExtended{
+		LanguageWatch: domain.LanguageWatch{MangaID: "manga_1", Language: "ru"},
+		Recipients:    []domain.Recipient{user1},
+	}
+	// the manga fails to be fetched, its watch is kept for the next check
+	watch3 := domain.LanguageWatchExtended{
+		LanguageWatch: domain.LanguageWatch{MangaID: "manga_2", Language: "es"},
+		Recipients:    []domain.Recipient{user2},
+	}
+	watch4 := domain.LanguageWatchExtended{
+		LanguageWatch: domain.LanguageWatch{MangaID: "manga_2", Language: "ru"},
+		Recipients:    []domain.Recipient{user2},
+	}
+	// the manga is removed, its recipients are told the watch is deleted
+	watch5 := domain.LanguageWatchExtended{
+		LanguageWatch: domain.LanguageWatch{MangaID: "manga_3", Language: "es"},
+		Recipients:    []domain.Recipient{user1},
+	}
+	manga := domain.Manga{ID: "manga_1", TranslationLanguages: []string{"en", "es"}}
+
+	mdexApi := &mdexAPIMock{}
+	subRepo := &subRepoMock{}
+	s := New(mdexApi, subRepo)
+
+	subRepo.On("AllLanguageWatches", ctx).Return([]domain.LanguageWatchExtended{watch3, watch1, watch5, watch4, watch2}, nil)
+	mdexApi.On("Manga", ctx, manga.ID).Return(manga, nil).Once()
+	mdexApi.On("Manga", ctx, "manga_2").Return(domain.Manga{}, errors.New("timeout")).Once()
+	mdexApi.On("Manga", ctx, "manga_3").Return(domain.Manga{}, ErrMangaNotFound).Once()
+
+	// watches are deleted by UnwatchLanguage after the recipients are notified
+	updates, err := s.LanguageUpdates(ctx)
+	assert.NoError(t, err)
+	removed := watch5
+	removed.MangaRemoved = true
+	assert.Equal(t, []domain.LanguageWatchExtended{watch1, removed}, updates)
+	mdexApi.AssertExpectations(t)
+	subRepo.AssertExpectations(t)
+}
+
+func TestToggleFirstLanguageOnly(t *testing.T) {
+	user := newRecipient()
+	ctx := context.Background()
+
+	sub1 := domain.Subscription{MangaID: "manga_1", Language: "en"}
+	sub2 := domain.Subscription{MangaID: "manga_1", Language: "es", Priority: 1}
+
+	subRepo := &subRepoMock{}
+	s := New(nil, subRepo)
+
+	calls := mockCalls{}
+
+	// ErrNoSuchSubscription
+	calls.Add(subRepo.On("UserSubscriptions", ctx, user).Return([]domain.Subscription{sub1, sub2}, nil))
+	_, err := s.ToggleFirstLanguageOnly(ctx, user, "manga_2")
+	assert.ErrorIs(t, err, ErrNoSuchSubscription, "ErrNoSuchSubscription error expected")
+	subRepo.AssertExpectations(t)
+	calls.Reset()
+
+	// success
+	calls.Add(subRepo.On("UserSubscriptions", ctx, user).Return([]domain.Subscription{sub1, sub2}, nil))
+	calls.Add(subRepo.On("SetFirstLanguageOnly", ctx, user, "manga_1", true).Return(nil))
+	enabled, err := s.ToggleFirstLanguageOnly(ctx, user, "manga_1")
+	assert.NoError(t, err)
+	assert.True(t, enabled)
+	subRepo.AssertExpectations(t)
+	calls.Reset()
+}
+
+func TestQueueUpdates_FirstLanguageOnly(t *testing.T) {
+	user1, user2 := newRecipient(), newRecipient()
+	ctx := context.Background()
+
+	// user1 follows en, then es and wants a chapter only once, user2 follows es only
+	subEn := domain.SubscriptionExtended{
+		Subscription:      domain.Subscription{MangaID: "manga_1", Language: "en", MangaTitle: "manga 1"},
+		Recipients:        []domain.Recipient{user1},
+		FirstLanguageOnly: map[domain.Recipient]int{user1: 0},
+	}
+	subEs := domain.SubscriptionExtended{
+		Subscription:      domain.Subscription{MangaID: "manga_1", Language: "es", MangaTitle: "manga 1"},
+		Recipients:        []domain.Recipient{user1, user2},
+		FirstLanguageOnly: map[domain.Recipient]int{user1: 1},
+	}
+
+	en1 := domain.Chapter{ID: "en_1", Chapter: "1"}
+	en2 := domain.Chapter{ID: "en_2", Chapter: "2"}
+	es1 := domain.Chapter{ID: "es_1", Chapter: "1"}
+	es3 := domain.Chapter{ID: "es_3", Chapter: "3"}
+
+	expUpdates := []domain.Update{
+		{
+			MangaID:     "manga_1",
+			MangaTitle:  "manga 1",
+			Language:    "es",
+			NewChapters: []domain.Chapter{es1, es3},
+			Recipients:  []domain.Recipient{user2},
+			Unread:      map[domain.Recipient]int{user2: 2},
+		},
+		{
+			MangaID:     "manga_1",
+			MangaTitle:  "manga 1",
+			Language:    "en",
+			NewChapters: []domain.Chapter{en1},
+			Recipients:  []domain.Recipient{user1},
+			Unread:      map[domain.Recipient]int{user1: 1},
+		},
+		{
+			MangaID:     "manga_1",
+			MangaTitle:  "manga 1",
+			Language:    "es",
+			NewChapters: []domain.Chapter{es3},
+			Recipients:  []domain.Recipient{user1},
+			Unread:      map[domain.Recipient]int{user1: 1},
+		},
+	}
+
+	mdexApi := &mdexAPIMock{}
+	subRepo := &subRepoMock{}
+	s := New(mdexApi, subRepo)
+
+	subRepo.On("AllSubscriptions", ctx).Return([]domain.SubscriptionExtended{subEn, subEs}, nil)
+	subRepo.On("ChapterFilters", ctx).Return(map[domain.Recipient]domain.ChapterFilter{}, nil)
+	mdexApi.On("LastChapters", ctx, "manga_1", &subEn.Language, mock.Anything).Return([]domain.Chapter{en1, en2}, nil)
+	mdexApi.On("LastChapters", ctx, "manga_1", &subEs.Language, mock.Anything).Return([]domain.Chapter{es1, es3}, nil)
+	subRepo.On("IsChapterNotified", ctx, mock.Anything, mock.Anything).Return(false, nil)
+	subRepo.On("SetSubscriptionLastUpdate", ctx, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	subRepo.On("ReleasedChapters", ctx, mock.Anything, mock.Anything).Return(([]domain.Chapter)(nil), nil)
+	subRepo.On("UnreadCounts", ctx, mock.Anything).Return(map[domain.Recipient]int{}, nil)
+	subRepo.On("AllUserSettings", ctx).Return(map[domain.Recipient]domain.UserSettings{}, nil)
+	// chapter 2 has already been notified in es on the previous check
+	subRepo.On("IsChapterNotifiedToRecipient", ctx, user1, "manga_1", "1", mock.Anything, mock.Anything).Return(false, nil)
+	subRepo.On("IsChapterNotifiedToRecipient", ctx, user1, "manga_1", "2", "en_2", mock.Anything).Return(true, nil).Once()
+	subRepo.On("IsChapterNotifiedToRecipient", ctx, user1, "manga_1", "3", "es_3", mock.Anything).Return(false, nil)
+
+	updates, err := s.QueueUpdates(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, expUpdates, updates)
+	subRepo.AssertExpectations(t)
+	mdexApi.AssertExpectations(t)
+}
+
+func TestDedupeChapters(t *testing.T) {
+	user1, user2 := newRecipient(), newRecipient()
+
+	ch1 := domain.Chapter{ID: "ch_1", Chapter: "1"}
+	ch2 := domain.Chapter{ID: "ch_2", Chapter: "2"}
+
+	updates := []domain.Update{
+		{
+			MangaID:     "manga_1",
+			Language:    "any",
+			NewChapters: []domain.Chapter{ch1, ch2},
+			Recipients:  []domain.Recipient{user1, user2},
+			Unread:      map[domain.Recipient]int{user1: 2, user2: 2},
+		},
+		{
+			MangaID:     "manga_1",
+			Language:    "en",
+			NewChapters: []domain.Chapter{ch1},
+			Recipients:  []domain.Recipient{user1},
+			Unread:      map[domain.Recipient]int{user1: 1},
+		},
+	}
+
+	// user1 gets ch_1 by the "en" subscription and ch_2 by "any"
+	expUpdates := []domain.Update{
+		{
+			MangaID:     "manga_1",
+			Language:    "any",
+			NewChapters: []domain.Chapter{ch1, ch2},
+			Recipients:  []domain.Recipient{user2},
+			Unread:      map[domain.Recipient]int{user2: 2},
+		},
+		updates[1],
+		{
+			MangaID:     "manga_1",
+			Language:    "any",
+			NewChapters: []domain.Chapter{ch2},
+			Recipients:  []domain.Recipient{user1},
+			Unread:      map[domain.Recipient]int{user1: 2},
+		},
+	}
+
+	assert.Equal(t, expUpdates, dedupeChapters(updates))
+}
+
+func TestRecipientFailed(t *testing.T) {
+	recNew, recRecent, recOld, recLast := newRecipient(), newRecipient(), newRecipient(), newRecipient()
+	ctx := context.Background()
+	reason := fmt.Errorf("chat not found")
+
+	recent := &domain.RecipientFailure{Failures: 1, LastFailureAt: time.Now().UTC().Add(-time.Minute)}
+	old := &domain.RecipientFailure{Failures: 1, LastFailureAt: time.Now().UTC().Add(-RecipientFailureInterval * 2)}
+	last := &domain.RecipientFailure{Failures: MaxRecipientFailures - 1, LastFailureAt: time.Now().UTC().Add(-RecipientFailureInterval * 2)}
+
+	isFailure := func(failures int) interface{} {
+		return mock.MatchedBy(func(f domain.RecipientFailure) bool {
+			return f.Failures == failures && f.LastError == reason.Error()
+		})
+	}
+
+	subRepo := &subRepoMock{}
+	subRepo.On("RecipientFailure", ctx, recNew).Return((*domain.RecipientFailure)(nil), nil)
+	subRepo.On("SetRecipientFailure", ctx, recNew, isFailure(1)).Return(nil)
+	subRepo.On("RecipientFailure", ctx, recRecent).Return(recent, nil)
+	subRepo.On("RecipientFailure", ctx, recOld).Return(old, nil)
+	subRepo.On("SetRecipientFailure", ctx, recOld, isFailure(2)).Return(nil)
+	subRepo.On("RecipientFailure", ctx, recLast).Return(last, nil)
+	subRepo.On("DeleteAllSubscriptions", ctx, recLast).Return(nil)
+	subRepo.On("DeleteRecipientFailure", ctx, recLast).Return(nil)
+
+	s := New(nil, subRepo)
+
+	purged, err := s.RecipientFailed(ctx, recNew, reason)
+	assert.NoError(t, err)
+	assert.False(t, purged, "the first failure must not purge subscriptions")
+
+	purged, err = s.RecipientFailed(ctx, recRecent, reason)
+	assert.NoError(t, err)
+	assert.False(t, purged, "failures within the interval must be counted once")
+
+	purged, err = s.RecipientFailed(ctx, recOld, reason)
+	assert.NoError(t, err)
+	assert.False(t, purged)
+
+	purged, err = s.RecipientFailed(ctx, recLast, reason)
+	assert.NoError(t, err)
+	assert.True(t, purged, "subscriptions must be purged after MaxRecipientFailures")
+
+	subRepo.AssertExpectations(t)
+}
+
+func TestRecipientReachable(t *testing.T) {
+	recFailed, recOk, recNew := newRecipient(), newRecipient(), newRecipient()
+	ctx := context.Background()
+
+	subRepo := &subRepoMock{}
+	s := New(nil, subRepo)
+
+	// failed recipients are loaded once, failures are deleted only if they are recorded
+	subRepo.On("FailedRecipients", ctx).Return([]domain.Recipient{recFailed}, nil).Once()
+	subRepo.On("DeleteRecipientFailure", ctx, recFailed).Return(nil).Once()
+	subRepo.On("RecipientFailure", ctx, recNew).Return((*domain.RecipientFailure)(nil), nil)
+	subRepo.On("SetRecipientFailure", ctx, recNew, mock.Anything).Return(nil)
+	subRepo.On("DeleteRecipientFailure", ctx, recNew).Return(nil).Once()
+
+	assert.NoError(t, s.RecipientReachable(ctx, recFailed))
+	assert.NoError(t, s.RecipientReachable(ctx, recFailed))
+	assert.NoError(t, s.RecipientReachable(ctx, recOk))
+
+	_, err := s.RecipientFailed(ctx, recNew, errors.New("blocked"))
+	assert.NoError(t, err)
+	assert.NoError(t, s.RecipientReachable(ctx, recNew))
+	assert.NoError(t, s.RecipientReachable(ctx, recNew))
+
+	subRepo.AssertExpectations(t)
+}
+
+func TestMigrateRecipient(t *testing.T) {
+	from, to := newRecipient(), newRecipient()
+	ctx := context.Background()
+
+	subRepo := &subRepoMock{}
+	subRepo.On("MigrateRecipient", ctx, from, to).Return(nil)
+	subRepo.On("MigrateRecipient", ctx, to, from).Return(fmt.Errorf("error"))
+
+	s := New(nil, subRepo)
+
+	assert.NoError(t, s.MigrateRecipient(ctx, from, to))
+	assert.Error(t, s.MigrateRecipient(ctx, to, from), "error from storage.MigrateRecipient expected")
+
+	subRepo.AssertExpectations(t)
+}